@@ -0,0 +1,256 @@
+// Command snaphook-history queries and edits SnapHook's capture history.
+//
+// Usage:
+//
+//	snaphook-history list [-since 24h] [-mode region] [-tag t] [-no-dups] [-n 20] [-offset 0] [-json]
+//	snaphook-history show ID...
+//	snaphook-history tag ID TAG...
+//	snaphook-history untag ID TAG...
+//	snaphook-history pin ID...
+//	snaphook-history unpin ID...
+//	snaphook-history rm [-file] ID...
+//	snaphook-history compact
+//
+// It works while SnapHook is running; both share the index file.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"snaphook/internal/captureid"
+	"snaphook/internal/config"
+	"snaphook/internal/history"
+)
+
+func main() {
+	flag.Usage = usage
+	indexPath := flag.String("index", config.HistoryPath(), "history index file")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	store, err := history.Open(*indexPath)
+	if err != nil {
+		fatal(err)
+	}
+
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+	switch cmd {
+	case "list", "ls":
+		err = list(store, args)
+	case "show":
+		err = show(store, args)
+	case "tag":
+		err = tag(store, args, store.AddTags)
+	case "untag":
+		err = tag(store, args, store.RemoveTags)
+	case "pin":
+		err = pin(store, args, true)
+	case "unpin":
+		err = pin(store, args, false)
+	case "rm", "delete":
+		err = remove(store, args)
+	case "compact":
+		err = store.Compact()
+	default:
+		fmt.Fprintf(os.Stderr, "snaphook-history: unknown command %q\n", cmd)
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `Usage: snaphook-history [-index FILE] COMMAND [ARGS]
+
+Commands:
+  list [-since DURATION] [-mode MODE] [-tag TAG] [-no-dups] [-n N] [-offset N] [-json]
+                         list captures, newest first; FLAGS shows
+                         P for pinned and D for duplicates
+  show ID...             print captures as JSON
+  tag ID TAG...          add tags to a capture
+  untag ID TAG...        remove tags from a capture
+  pin ID...              exempt captures from retention policies
+  unpin ID...            subject captures to retention policies again
+  rm [-file] ID...       forget captures; -file also deletes the saved image
+  compact                rewrite the index without deleted entries
+`)
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "snaphook-history: %v\n", err)
+	os.Exit(1)
+}
+
+func list(store *history.Store, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	since := flags.Duration("since", 0, "only captures newer than this, e.g. 24h")
+	mode := flags.String("mode", "", "only this capture mode (monitor, region, all, window)")
+	tag := flags.String("tag", "", "only captures with this tag")
+	noDups := flags.Bool("no-dups", false, "leave out captures marked as duplicates")
+	limit := flags.Int("n", 0, "at most this many captures (0 for all)")
+	offset := flags.Int("offset", 0, "skip this many matching captures")
+	asJSON := flags.Bool("json", false, "print JSON instead of a table")
+	flags.Parse(args)
+
+	q := history.Query{Mode: *mode, Tag: *tag, SkipDuplicates: *noDups, Limit: *limit, Offset: *offset}
+	if *since > 0 {
+		q.Since = time.Now().Add(-*since)
+	}
+	entries, err := store.List(q)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		if entries == nil {
+			entries = []history.Entry{}
+		}
+		return printJSON(entries)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIME\tMODE\tMONITOR\tSIZE\tFLAGS\tTAGS\tPATH")
+	for _, e := range entries {
+		monitor := "all"
+		if e.Monitor >= 0 {
+			monitor = strconv.Itoa(e.Monitor + 1)
+		}
+		path := e.Path
+		if path == "" {
+			path = "-"
+		}
+		marks := ""
+		if e.Pinned {
+			marks += "P"
+		}
+		if e.Duplicate {
+			marks += "D"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%dx%d\t%s\t%s\t%s\n",
+			e.ID, e.Time.Local().Format("2006-01-02 15:04:05"), e.Mode, monitor,
+			e.Width, e.Height, marks, strings.Join(e.Tags, ","), path)
+	}
+	return w.Flush()
+}
+
+func show(store *history.Store, args []string) error {
+	ids, err := parseIDs(args)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		e, err := store.Get(id)
+		if err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+		if err := printJSON(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tag(store *history.Store, args []string, update func(string, ...string) (history.Entry, error)) error {
+	if len(args) < 2 {
+		return errors.New("need an ID and at least one tag")
+	}
+	ids, err := parseIDs(args[:1])
+	if err != nil {
+		return err
+	}
+
+	e, err := update(ids[0], args[1:]...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", ids[0], err)
+	}
+	fmt.Printf("%s: %s\n", e.ID, strings.Join(e.Tags, ","))
+	return nil
+}
+
+func pin(store *history.Store, args []string, pinned bool) error {
+	ids, err := parseIDs(args)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if _, err := store.SetPinned(id, pinned); err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func remove(store *history.Store, args []string) error {
+	flags := flag.NewFlagSet("rm", flag.ExitOnError)
+	deleteFile := flags.Bool("file", false, "also delete the saved image")
+	flags.Parse(args)
+
+	ids, err := parseIDs(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		e, err := store.Get(id)
+		if err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+		if *deleteFile && e.Path != "" {
+			if err := removeFile(e.Path); err != nil {
+				return fmt.Errorf("%s: %w", id, err)
+			}
+		}
+		if err := store.Delete(id); err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// removeFile deletes a saved image; one that is already gone is fine.
+func removeFile(path string) error {
+	err := os.Remove(filepath.Clean(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func parseIDs(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return nil, errors.New("need at least one ID")
+	}
+
+	ids := make([]string, len(args))
+	for i, arg := range args {
+		if !captureid.Valid(arg) {
+			return nil, fmt.Errorf("invalid ID %q", arg)
+		}
+		ids[i] = strings.ToUpper(arg)
+	}
+	return ids, nil
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"image"
+	"log"
+	"sync"
+
+	"snaphook/internal/capture"
+	"snaphook/internal/config"
+	"snaphook/internal/phash"
+)
+
+const (
+	duplicateMark = "mark"
+	duplicateSkip = "skip"
+	duplicateOff  = "off"
+)
+
+// maxRecentShots bounds how many captured areas are remembered for
+// duplicate detection. Only bounds and hashes are kept, not images.
+const maxRecentShots = 8
+
+var (
+	// duplicateAction and duplicateDistance come from the duplicates setting.
+	// Both are guarded by configMutex.
+	duplicateAction   = duplicateMark
+	duplicateDistance = 0
+
+	recentShots []*keptShot // newest last
+	recentMutex sync.Mutex
+)
+
+// keptShot is what duplicate detection remembers of a shot that was not a
+// duplicate itself.
+type keptShot struct {
+	bounds image.Rectangle
+	hash   phash.Hash
+	id     string
+}
+
+func applyDuplicates(cfg config.DuplicateConfig) {
+	action := cfg.Action
+	switch action {
+	case "":
+		action = duplicateMark
+	case duplicateMark, duplicateSkip, duplicateOff:
+	default:
+		log.Printf("Invalid duplicates.action %q, using %s", cfg.Action, duplicateMark)
+		action = duplicateMark
+	}
+
+	distance := cfg.MaxDistance
+	if distance < 0 || distance > 64 {
+		log.Printf("Invalid duplicates.max_distance %d, using 0", cfg.MaxDistance)
+		distance = 0
+	}
+
+	configMutex.Lock()
+	duplicateAction = action
+	duplicateDistance = distance
+	configMutex.Unlock()
+}
+
+// matchDuplicate compares shot with the last kept shot of the same area. If
+// their perceptual hashes are within maxDistance bits it returns that shot
+// and true; otherwise it remembers shot as the latest kept one and returns
+// its record and false.
+func matchDuplicate(shot *capture.Shot, maxDistance int) (*keptShot, bool) {
+	hash := shot.PerceptualHash()
+
+	recentMutex.Lock()
+	defer recentMutex.Unlock()
+
+	for i := len(recentShots) - 1; i >= 0; i-- {
+		prev := recentShots[i]
+		if prev.bounds != shot.Bounds {
+			continue
+		}
+		if prev.hash.Distance(hash) <= maxDistance {
+			return prev, true
+		}
+		// Only the latest shot of an area counts.
+		recentShots = append(recentShots[:i], recentShots[i+1:]...)
+		break
+	}
+
+	kept := &keptShot{bounds: shot.Bounds, hash: hash, id: shot.ID}
+	recentShots = append(recentShots, kept)
+	if len(recentShots) > maxRecentShots {
+		recentShots = recentShots[1:]
+	}
+	return kept, false
+}
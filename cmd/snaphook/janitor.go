@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"snaphook/internal/capture"
+	"snaphook/internal/config"
+	"snaphook/internal/history"
+	"snaphook/internal/retention"
+)
+
+const (
+	defaultJanitorInterval = time.Hour
+	defaultTempMaxAge      = 24 * time.Hour
+)
+
+// startJanitor applies the retention policies now and then every interval
+// until the process exits.
+func startJanitor(cfg config.RetentionConfig) {
+	temp := parseRetentionPolicy("retention.temp", cfg.Temp)
+	if cfg.Temp == (config.RetentionPolicy{}) {
+		temp = retention.Policy{MaxAge: defaultTempMaxAge}
+	}
+	saved := parseRetentionPolicy("retention.saved", cfg.Saved)
+
+	interval := defaultJanitorInterval
+	if cfg.Interval != "" {
+		d, err := time.ParseDuration(cfg.Interval)
+		if err != nil || d < time.Minute {
+			log.Printf("Invalid retention.interval %q, using %s", cfg.Interval, defaultJanitorInterval)
+		} else {
+			interval = d
+		}
+	}
+
+	log.Printf("Retention: temp files %s; saved files %s; every %s", temp, saved, interval)
+	if !saved.IsZero() && historyStore == nil {
+		log.Printf("Warning: retention.saved is set but the capture history could not be opened; saved screenshots will not be pruned, since the history records which files are SnapHook's")
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			runJanitor(temp, saved)
+			<-ticker.C
+		}
+	}()
+}
+
+// parseRetentionPolicy converts a configured policy, dropping any limit
+// that does not parse.
+func parseRetentionPolicy(name string, cfg config.RetentionPolicy) retention.Policy {
+	p := retention.Policy{MaxCount: max(cfg.MaxCount, 0)}
+
+	age, err := retention.ParseAge(cfg.MaxAge)
+	if err != nil {
+		log.Printf("Invalid %s.max_age, ignoring it: %v", name, err)
+	}
+	p.MaxAge = age
+
+	size, err := retention.ParseSize(cfg.MaxBytes)
+	if err != nil {
+		log.Printf("Invalid %s.max_bytes, ignoring it: %v", name, err)
+	}
+	p.MaxBytes = size
+
+	return p
+}
+
+func runJanitor(temp, saved retention.Policy) {
+	if n := capture.CleanupTempFiles(temp); n > 0 {
+		log.Printf("Retention: deleted %d temp files", n)
+	}
+
+	// The history says which files are SnapHook's, so without it nothing
+	// saved can be pruned; startJanitor has already warned about that.
+	if saved.IsZero() || historyStore == nil {
+		return
+	}
+
+	entries, err := historyStore.List(history.Query{})
+	if err != nil {
+		log.Printf("Retention: failed to read history: %v", err)
+		return
+	}
+
+	// Only files the history records as SnapHook's own are candidates, judged
+	// by their capture time and pin. Anything else in the auto-save folder,
+	// which may be a folder of the user's own photos, is never touched.
+	items := map[string]retention.Item{}
+	for _, e := range entries {
+		if e.Path == "" {
+			continue
+		}
+		info, err := os.Stat(e.Path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		items[e.Path] = retention.Item{
+			ID:     e.ID,
+			Path:   e.Path,
+			Time:   e.Time,
+			Size:   info.Size(),
+			Pinned: e.Pinned,
+		}
+	}
+
+	removed, forgotten := 0, 0
+	for _, item := range saved.Select(slices.Collect(maps.Values(items)), time.Now()) {
+		if err := os.Remove(item.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Retention: failed to delete %s: %v", item.Path, err)
+			continue
+		}
+		removed++
+
+		// A pruned file takes its history entry with it.
+		if err := historyStore.Delete(item.ID); err != nil {
+			if !errors.Is(err, history.ErrNotFound) {
+				log.Printf("Retention: failed to update history: %v", err)
+			}
+			continue
+		}
+		forgotten++
+	}
+	if removed > 0 {
+		log.Printf("Retention: deleted %d saved screenshots and %d history entries", removed, forgotten)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"snaphook/internal/config"
+	"snaphook/internal/history"
+	"snaphook/internal/retention"
+)
+
+// Only files the history records are pruned; the auto-save folder may be
+// one the user keeps their own images in.
+func TestJanitorPrunesRecordedFilesOnly(t *testing.T) {
+	dir := t.TempDir()
+	saveDir := filepath.Join(dir, "saved")
+	elsewhere := filepath.Join(dir, "old-folder")
+
+	old := time.Now().Add(-48 * time.Hour)
+	write := func(path string, mtime time.Time) string {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("image"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	foreign := write(filepath.Join(saveDir, "2024", "holiday.png"), old)
+	foreignJPEG := write(filepath.Join(saveDir, "photo.jpg"), old)
+	notes := write(filepath.Join(saveDir, "notes.txt"), old)
+	fresh := write(filepath.Join(saveDir, "fresh.png"), old)
+	recorded := write(filepath.Join(saveDir, "recorded.png"), time.Now())
+	pinned := write(filepath.Join(saveDir, "pinned.png"), old)
+	moved := write(filepath.Join(elsewhere, "moved.qoi"), time.Now())
+
+	store, err := history.Open(filepath.Join(dir, "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	add := func(path string, pin bool) history.Entry {
+		t.Helper()
+		e, err := store.Add(history.Entry{Path: path, Time: old, Pinned: pin})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	// Recorded files go by their capture time, not the file's.
+	recordedEntry := add(recorded, false)
+	movedEntry := add(moved, false)
+	pinnedEntry := add(pinned, true)
+	if _, err := store.Add(history.Entry{Path: fresh, Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	configMutex.Lock()
+	currentConfig, historyStore = &config.Config{SaveDir: saveDir}, store
+	configMutex.Unlock()
+	t.Cleanup(func() { historyStore = nil })
+
+	runJanitor(retention.Policy{}, retention.Policy{MaxAge: 24 * time.Hour})
+
+	for path, want := range map[string]bool{
+		foreign:     true,
+		foreignJPEG: true,
+		notes:       true,
+		recorded:    false,
+		moved:       false,
+		fresh:       true,
+		pinned:      true,
+	} {
+		_, err := os.Stat(path)
+		if got := err == nil; got != want {
+			t.Errorf("%s exists = %v, want %v", filepath.Base(path), got, want)
+		}
+	}
+
+	for _, id := range []string{recordedEntry.ID, movedEntry.ID} {
+		if _, err := store.Get(id); err != history.ErrNotFound {
+			t.Errorf("history entry of a pruned file: Get = %v, want ErrNotFound", err)
+		}
+	}
+	if _, err := store.Get(pinnedEntry.ID); err != nil {
+		t.Errorf("pinned entry: %v", err)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"log"
+	"runtime"
+)
+
+// The tray app is Windows-only; the capture pipeline in this package builds
+// everywhere so its tests run on any platform.
+func main() {
+	log.Fatalf("SnapHook's tray app is not supported on %s", runtime.GOOS)
+}
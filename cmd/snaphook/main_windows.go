@@ -0,0 +1,646 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/getlantern/systray"
+	"golang.org/x/sys/windows"
+
+	"snaphook/internal/assets"
+	"snaphook/internal/capture"
+	"snaphook/internal/config"
+	"snaphook/internal/history"
+	"snaphook/internal/hotkey"
+	"snaphook/internal/imageformat"
+	"snaphook/internal/localca"
+	"snaphook/internal/nametemplate"
+	"snaphook/internal/preview"
+	"snaphook/internal/shortcut"
+	"snaphook/internal/startup"
+)
+
+var instanceMutex windows.Handle
+
+func main() {
+	mutexName, err := syscall.UTF16PtrFromString("Global\\SnapHook-SingleInstance-Mutex")
+	if err != nil {
+		log.Fatalf("Failed to create mutex name: %v", err)
+	}
+
+	instanceMutex, err = windows.CreateMutex(nil, false, mutexName)
+	if err != nil {
+		lastErr := windows.GetLastError()
+		if lastErr == windows.ERROR_ALREADY_EXISTS || err.Error() == "Cannot create a file when that file already exists." {
+			log.Println("Another instance of SnapHook is already running")
+			os.Exit(1)
+		}
+		log.Fatalf("Failed to create mutex: %v", err)
+	}
+
+	defer windows.CloseHandle(instanceMutex)
+
+	systray.Run(onReady, onExit)
+}
+
+func onReady() {
+	var err error
+	currentConfig, err = config.Load()
+	if err != nil {
+		log.Printf("Failed to load config: %v, using defaults", err)
+		currentConfig = &config.Config{Hotkey: "Ctrl+Shift+S"}
+	}
+
+	if store, err := history.Open(config.HistoryPath()); err != nil {
+		log.Printf("Failed to open screenshot history: %v", err)
+	} else {
+		historyStore = store
+		preview.SetHistory(store)
+	}
+	startJanitor(currentConfig.Retention)
+
+	if err := preview.SetAddress(currentConfig.PreviewAddress, currentConfig.PreviewPort); err != nil {
+		log.Printf("Invalid preview_port, using the default: %v", err)
+		preview.SetAddress(currentConfig.PreviewAddress, 0)
+	}
+	if err := config.SavePreviewToken(preview.Token()); err != nil {
+		log.Printf("Failed to save preview token: %v", err)
+	}
+
+	systray.SetIcon(assets.IconData)
+	systray.SetTitle("SnapHook")
+	configMutex.RLock()
+	hotkeyStr := currentConfig.Hotkey
+	bindings := append([]config.Binding(nil), currentConfig.Bindings...)
+	enablePreview := currentConfig.EnablePreview
+	copyToClipboard := currentConfig.CopyToClipboard
+	autoSave := currentConfig.AutoSave
+	captureMode := capture.Mode(currentConfig.CaptureMode)
+	gapColor := currentConfig.GapColor
+	splitDisplays := currentConfig.SplitDisplays
+	captureDelay := currentConfig.CaptureDelay
+	windowOpts := capture.WindowOptions{
+		IncludeFrame:  currentConfig.WindowFrame,
+		IncludeShadow: currentConfig.WindowShadow,
+	}
+	saveFormat := currentConfig.SaveFormat
+	previewFormat := currentConfig.PreviewFormat
+	clipFormat := currentConfig.ClipboardFormat
+	filenameTemplate := currentConfig.FilenameTemplate
+	duplicates := currentConfig.Duplicates
+	configMutex.RUnlock()
+
+	if captureMode == "" {
+		captureMode = capture.ModeMonitor
+	}
+	applyAllDisplaysOptions(gapColor, splitDisplays)
+	capture.SetWindowOptions(windowOpts)
+	applyOutputFormats(saveFormat, previewFormat, clipFormat)
+	applyFilenameTemplate(filenameTemplate)
+	applyDuplicates(duplicates)
+
+	setTooltip = systray.SetTooltip
+	configMutex.Lock()
+	idleTooltip = hotkeyTooltip(hotkeyStr)
+	configMutex.Unlock()
+	systray.SetTooltip(hotkeyTooltip(hotkeyStr))
+
+	mHotkey := systray.AddMenuItem("Hotkey: "+hotkeyStr, "Current screenshot hotkey")
+	mHotkey.Disable()
+	if err := hotkey.Register(hotkeyStr, handleScreenshot); err != nil {
+		log.Printf("Warning: Failed to register hotkey: %v", err)
+		log.Println("The application will still run, but you'll need to manually configure the hotkey in your system settings.")
+		mHotkey.SetTitle("Hotkey: " + hotkeyStr + " (failed)")
+		mHotkey.SetTooltip(err.Error())
+	}
+	registerBindings(bindings)
+	mCaptureMode := systray.AddMenuItem("Capture Mode", "What the hotkey captures")
+	mModeMonitor := mCaptureMode.AddSubMenuItemCheckbox("Monitor Under Cursor", "Capture the monitor the cursor is on", captureMode == capture.ModeMonitor)
+	mModeRegion := mCaptureMode.AddSubMenuItemCheckbox("Select Region", "Drag a rectangle to capture", captureMode == capture.ModeRegion)
+	mModeAll := mCaptureMode.AddSubMenuItemCheckbox("All Monitors", "Capture every monitor in one event", captureMode == capture.ModeAllDisplays)
+	mModeWindow := mCaptureMode.AddSubMenuItemCheckbox("Active Window", "Capture the focused window", captureMode == capture.ModeWindow)
+	mSplitDisplays := mCaptureMode.AddSubMenuItemCheckbox("One File Per Monitor", "Save all-monitor captures as separate files", splitDisplays)
+	mWindowFrame := mCaptureMode.AddSubMenuItemCheckbox("Include Window Frame", "Include title bar and borders in window captures", windowOpts.IncludeFrame)
+	mWindowShadow := mCaptureMode.AddSubMenuItemCheckbox("Include Window Shadow", "Include the drop shadow in window captures", windowOpts.IncludeShadow)
+	modeItems := map[capture.Mode]*systray.MenuItem{
+		capture.ModeMonitor:     mModeMonitor,
+		capture.ModeRegion:      mModeRegion,
+		capture.ModeAllDisplays: mModeAll,
+		capture.ModeWindow:      mModeWindow,
+	}
+	mCaptureDelay := systray.AddMenuItem("Capture Delay", "Wait before capturing, e.g. to open a menu")
+	delayItems := map[int]*systray.MenuItem{}
+	for _, seconds := range []int{0, 3, 5, 10} {
+		title := fmt.Sprintf("%d Seconds", seconds)
+		if seconds == 0 {
+			title = "No Delay"
+		}
+		delayItems[seconds] = mCaptureDelay.AddSubMenuItemCheckbox(title, "Press the hotkey again to cancel a countdown", seconds == captureDelay)
+	}
+	for seconds, item := range delayItems {
+		go func() {
+			for range item.ClickedCh {
+				setCaptureDelay(seconds, delayItems)
+			}
+		}()
+	}
+	systray.AddSeparator()
+
+	mViewPreview := systray.AddMenuItem("View Preview", "Open preview window in browser")
+	mSettings := systray.AddMenuItem("Change Hotkey...", "Open the settings page to record a new hotkey")
+	mEnablePreview := systray.AddMenuItemCheckbox("Enable Preview", "Enable browser preview for screenshots", enablePreview)
+	systray.AddSeparator()
+
+	mCopyClipboard := systray.AddMenuItemCheckbox("Copy to Clipboard", "Copy screenshot to clipboard", copyToClipboard)
+	mAutoSave := systray.AddMenuItemCheckbox("Auto-Save", "Save screenshots automatically", autoSave)
+	systray.AddSeparator()
+
+	mStartup := systray.AddMenuItemCheckbox("Start on Boot", "Start SnapView when Windows starts", startup.IsEnabled())
+	systray.AddSeparator()
+
+	mQuit := systray.AddMenuItem("Quit", "Quit SnapView")
+
+	configMutex.Lock()
+	applyAutoSave(autoSave, mAutoSave)
+	configMutex.Unlock()
+
+	previewItems := previewMenu{enable: mEnablePreview, view: mViewPreview, settings: mSettings}
+	if enablePreview {
+		configMutex.RLock()
+		startPreview(previewItems)
+		configMutex.RUnlock()
+	} else {
+		mViewPreview.Disable()
+		mSettings.Disable()
+	}
+
+	hotkeyChanges := preview.GetHotkeyChangeChan()
+	saveDirChanges := preview.GetSaveDirChangeChan()
+	captureRequests := preview.GetCaptureRequestChan()
+	settingsChanges := preview.GetSettingsChangeChan()
+	preview.SetSettingsSource(currentSettings)
+	menu := settingsMenu{
+		hotkey:        mHotkey,
+		copyClipboard: mCopyClipboard,
+		autoSave:      mAutoSave,
+		modes:         modeItems,
+		delays:        delayItems,
+	}
+
+	go func() {
+		for {
+			select {
+			case <-mModeMonitor.ClickedCh:
+				setCaptureMode(capture.ModeMonitor, modeItems)
+			case <-mModeRegion.ClickedCh:
+				setCaptureMode(capture.ModeRegion, modeItems)
+			case <-mModeAll.ClickedCh:
+				setCaptureMode(capture.ModeAllDisplays, modeItems)
+			case <-mModeWindow.ClickedCh:
+				setCaptureMode(capture.ModeWindow, modeItems)
+			case <-mWindowFrame.ClickedCh:
+				configMutex.Lock()
+				if mWindowFrame.Checked() {
+					currentConfig.WindowFrame = false
+					mWindowFrame.Uncheck()
+				} else {
+					currentConfig.WindowFrame = true
+					mWindowFrame.Check()
+				}
+				applyWindowOptions()
+				if err := config.Save(currentConfig); err != nil {
+					log.Printf("Failed to save config: %v", err)
+				}
+				configMutex.Unlock()
+			case <-mWindowShadow.ClickedCh:
+				configMutex.Lock()
+				if mWindowShadow.Checked() {
+					currentConfig.WindowShadow = false
+					mWindowShadow.Uncheck()
+				} else {
+					currentConfig.WindowShadow = true
+					mWindowShadow.Check()
+				}
+				applyWindowOptions()
+				if err := config.Save(currentConfig); err != nil {
+					log.Printf("Failed to save config: %v", err)
+				}
+				configMutex.Unlock()
+			case <-mSplitDisplays.ClickedCh:
+				configMutex.Lock()
+				if mSplitDisplays.Checked() {
+					currentConfig.SplitDisplays = false
+					mSplitDisplays.Uncheck()
+				} else {
+					currentConfig.SplitDisplays = true
+					mSplitDisplays.Check()
+				}
+				applyAllDisplaysOptions(currentConfig.GapColor, currentConfig.SplitDisplays)
+				if err := config.Save(currentConfig); err != nil {
+					log.Printf("Failed to save config: %v", err)
+				}
+				configMutex.Unlock()
+			case <-mViewPreview.ClickedCh:
+				preview.OpenBrowser()
+			case <-mSettings.ClickedCh:
+				preview.OpenSettings()
+			case change := <-hotkeyChanges:
+				change.Result <- changeHotkey(change.Hotkey, mHotkey)
+			case change := <-saveDirChanges:
+				change.Result <- changeSaveDir(change.Dir, mAutoSave)
+			case change := <-settingsChanges:
+				change.Result <- changeSettings(change.Patch, menu)
+			case req := <-captureRequests:
+				mode := capture.Mode(req.Mode)
+				if mode == "" {
+					configMutex.RLock()
+					mode = capture.Mode(currentConfig.CaptureMode)
+					configMutex.RUnlock()
+				}
+				err := startCapture(mode)
+				if errors.Is(err, errCaptureInProgress) {
+					err = preview.ErrCaptureBusy
+				}
+				req.Result <- err
+			case <-mCopyClipboard.ClickedCh:
+				configMutex.Lock()
+				if mCopyClipboard.Checked() {
+					currentConfig.CopyToClipboard = false
+					mCopyClipboard.Uncheck()
+				} else {
+					currentConfig.CopyToClipboard = true
+					mCopyClipboard.Check()
+				}
+				if err := config.Save(currentConfig); err != nil {
+					log.Printf("Failed to save config: %v", err)
+				}
+				configMutex.Unlock()
+			case <-mAutoSave.ClickedCh:
+				configMutex.Lock()
+				if mAutoSave.Checked() {
+					currentConfig.AutoSave = false
+					applyAutoSave(false, mAutoSave)
+					mAutoSave.Uncheck()
+				} else if err := applyAutoSave(true, mAutoSave); err == nil {
+					currentConfig.AutoSave = true
+					mAutoSave.Check()
+				}
+				if err := config.Save(currentConfig); err != nil {
+					log.Printf("Failed to save config: %v", err)
+				}
+				configMutex.Unlock()
+			case <-mEnablePreview.ClickedCh:
+				configMutex.Lock()
+				if mEnablePreview.Checked() {
+					currentConfig.EnablePreview = false
+					mEnablePreview.Uncheck()
+					stopPreview(previewItems)
+				} else if err := startPreview(previewItems); err == nil {
+					currentConfig.EnablePreview = true
+					mEnablePreview.Check()
+				}
+				if err := config.Save(currentConfig); err != nil {
+					log.Printf("Failed to save config: %v", err)
+				}
+				configMutex.Unlock()
+			case <-mStartup.ClickedCh:
+				if mStartup.Checked() {
+					if err := startup.Disable(); err != nil {
+						log.Printf("Failed to disable startup: %v", err)
+					} else {
+						mStartup.Uncheck()
+					}
+				} else {
+					if err := startup.Enable(); err != nil {
+						log.Printf("Failed to enable startup: %v", err)
+					} else {
+						mStartup.Check()
+					}
+				}
+			case <-mQuit.ClickedCh:
+				systray.Quit()
+				return
+			}
+		}
+	}()
+}
+
+func onExit() {
+	preview.Shutdown()
+	os.Remove(config.PreviewTokenPath())
+	os.Remove(config.PreviewURLPath())
+	hotkey.Unregister()
+}
+
+// previewMenu holds the tray items that follow the preview server's state.
+type previewMenu struct {
+	enable   *systray.MenuItem
+	view     *systray.MenuItem
+	settings *systray.MenuItem
+}
+
+// startPreview starts the preview server and shows the outcome in the tray.
+// A server that cannot start leaves the preview items disabled and says why.
+// configMutex must be held.
+func startPreview(menu previewMenu) error {
+	err := applyPreviewTLS(currentConfig.PreviewTLS, currentConfig.PreviewAddress)
+	if err == nil {
+		err = preview.Start()
+	}
+	if err != nil {
+		log.Printf("Failed to start preview: %v", err)
+		menu.enable.SetTitle("Enable Preview (failed to start)")
+		menu.enable.SetTooltip(err.Error())
+		menu.view.Disable()
+		menu.settings.Disable()
+		return err
+	}
+
+	url := preview.URL()
+	log.Printf("Preview serving on %s", url)
+	if err := config.SavePreviewURL(url); err != nil {
+		log.Printf("Failed to save preview URL: %v", err)
+	}
+	menu.enable.SetTitle("Enable Preview")
+	menu.enable.SetTooltip("Enable browser preview for screenshots")
+	menu.view.SetTooltip("Open " + url + " in the browser")
+	menu.view.Enable()
+	menu.settings.Enable()
+	return nil
+}
+
+func stopPreview(menu previewMenu) {
+	preview.Shutdown()
+	os.Remove(config.PreviewURLPath())
+	menu.enable.SetTitle("Enable Preview")
+	menu.enable.SetTooltip("Enable browser preview for screenshots")
+	menu.view.Disable()
+	menu.settings.Disable()
+}
+
+// applyPreviewTLS hands the preview its HTTPS certificate, issuing one from
+// the local CA unless the user supplied their own.
+func applyPreviewTLS(cfg config.PreviewTLSConfig, address string) error {
+	if !cfg.Enabled {
+		preview.SetTLS("", "")
+		return nil
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return errors.New("preview_tls needs both cert_file and key_file")
+		}
+		preview.SetTLS(config.ExpandPath(cfg.CertFile), config.ExpandPath(cfg.KeyFile))
+		return nil
+	}
+
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if ip := net.ParseIP(address); address != "" && (ip == nil || !ip.IsUnspecified()) {
+		hosts = append(hosts, address)
+	}
+	for _, name := range cfg.Hostnames {
+		if name = strings.TrimSpace(name); name != "" {
+			hosts = append(hosts, name)
+		}
+	}
+	certFile, keyFile, newCA, err := localca.Ensure(config.Dir(), hosts)
+	if err != nil {
+		return fmt.Errorf("failed to issue preview certificate: %w", err)
+	}
+	if newCA {
+		log.Printf("Created a new preview CA; import %s on machines that open the preview", localca.CAPath(config.Dir()))
+	}
+	preview.SetTLS(certFile, keyFile)
+	return nil
+}
+
+func setCaptureMode(mode capture.Mode, items map[capture.Mode]*systray.MenuItem) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	currentConfig.CaptureMode = string(mode)
+	for m, item := range items {
+		if m == mode {
+			item.Check()
+		} else {
+			item.Uncheck()
+		}
+	}
+	if err := config.Save(currentConfig); err != nil {
+		log.Printf("Failed to save config: %v", err)
+	}
+}
+
+func applyAllDisplaysOptions(gap string, split bool) {
+	var fill color.Color = color.Black
+	if gap != "" {
+		c, err := capture.ParseColor(gap)
+		if err != nil {
+			log.Printf("Invalid gap_color, using black: %v", err)
+		} else {
+			fill = c
+		}
+	}
+	capture.SetAllDisplaysOptions(fill, split)
+}
+
+// applyWindowOptions pushes the window capture flags to the capture package.
+// configMutex must be held.
+func applyWindowOptions() {
+	capture.SetWindowOptions(capture.WindowOptions{
+		IncludeFrame:  currentConfig.WindowFrame,
+		IncludeShadow: currentConfig.WindowShadow,
+	})
+}
+
+// applyOutputFormats hands each sink its configured encoding. Invalid
+// settings fall back to the default fast PNG.
+func applyOutputFormats(save, previewFmt, clip config.OutputFormat) {
+	capture.SetAutoSaveFormat(parseOutputFormat("save_format", save))
+
+	f := parseOutputFormat("preview_format", previewFmt)
+	if err := preview.SetImageFormat(f); err != nil {
+		log.Printf("Invalid preview_format, using %s: %v", imageformat.Default, err)
+		preview.SetImageFormat(imageformat.Default)
+	}
+
+	configMutex.Lock()
+	clipboardFormat = parseOutputFormat("clipboard_format", clip)
+	configMutex.Unlock()
+}
+
+// applyAutoSave validates the configured folder and turns auto-save on or
+// off in the capture package. A folder that cannot be written to leaves
+// auto-save off and is reported in the tray and on preview pages.
+// configMutex must be held.
+func applyAutoSave(enabled bool, mAutoSave *systray.MenuItem) error {
+	dir := config.GetAutoSaveDir(currentConfig.SaveDir)
+	if !enabled {
+		capture.SetAutoSave(false, "")
+		mAutoSave.SetTitle("Auto-Save")
+		mAutoSave.SetTooltip("Save screenshots to " + dir)
+		preview.SetSaveDirStatus(dir, nil)
+		return nil
+	}
+
+	if err := config.EnsureAutoSaveDir(dir); err != nil {
+		log.Printf("Auto-save disabled: %v", err)
+		capture.SetAutoSave(false, "")
+		mAutoSave.SetTitle("Auto-Save (folder unavailable)")
+		mAutoSave.SetTooltip(err.Error())
+		preview.SetSaveDirStatus(dir, err)
+		return err
+	}
+
+	capture.SetAutoSave(true, dir)
+	mAutoSave.SetTitle("Auto-Save")
+	mAutoSave.SetTooltip("Save screenshots to " + dir)
+	preview.SetSaveDirStatus(dir, nil)
+	return nil
+}
+
+// changeSaveDir switches the auto-save folder to dir if it is writable, then
+// persists it. An unusable folder is rejected and the old one kept.
+func changeSaveDir(dir string, mAutoSave *systray.MenuItem) error {
+	dir = strings.TrimSpace(dir)
+	if err := config.EnsureAutoSaveDir(config.GetAutoSaveDir(dir)); err != nil {
+		log.Printf("Rejected auto-save folder %q: %v", dir, err)
+		return err
+	}
+
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	currentConfig.SaveDir = dir
+	applyAutoSave(currentConfig.AutoSave, mAutoSave)
+	log.Printf("Auto-save folder changed to %s", config.GetAutoSaveDir(dir))
+
+	if err := config.Save(currentConfig); err != nil {
+		log.Printf("Failed to save config: %v", err)
+		return fmt.Errorf("folder changed but could not be saved: %w", err)
+	}
+	return nil
+}
+
+func applyFilenameTemplate(s string) {
+	t, err := nametemplate.Parse(s)
+	if err != nil {
+		log.Printf("Invalid filename_template, using %s: %v", nametemplate.Default, err)
+		t = nil
+	}
+	capture.SetAutoSaveTemplate(t)
+}
+
+func parseOutputFormat(key string, f config.OutputFormat) imageformat.Format {
+	format, err := imageformat.Parse(f.Format, f.PNGLevel, f.JPEGQuality)
+	if err != nil {
+		log.Printf("Invalid %s, using %s: %v", key, imageformat.Default, err)
+		return imageformat.Default
+	}
+	return format
+}
+
+func setCaptureDelay(seconds int, items map[int]*systray.MenuItem) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	currentConfig.CaptureDelay = seconds
+	for s, item := range items {
+		if s == seconds {
+			item.Check()
+		} else {
+			item.Uncheck()
+		}
+	}
+	if err := config.Save(currentConfig); err != nil {
+		log.Printf("Failed to save config: %v", err)
+	}
+}
+
+var modeLabels = map[capture.Mode]string{
+	capture.ModeMonitor:     "Monitor Under Cursor",
+	capture.ModeRegion:      "Select Region",
+	capture.ModeAllDisplays: "All Monitors",
+	capture.ModeWindow:      "Active Window",
+}
+
+// registerBindings registers each configured extra hotkey on its own and
+// lists it in the tray, marking the ones that failed.
+func registerBindings(bindings []config.Binding) {
+	var valid []hotkey.Binding
+	actions := map[string]capture.Mode{}
+	for _, b := range bindings {
+		mode := capture.Mode(b.Action)
+		if !mode.Valid() {
+			log.Printf("Warning: Ignoring hotkey %s: unknown action %q", b.Hotkey, b.Action)
+			item := systray.AddMenuItem(fmt.Sprintf("%s: %s (invalid)", b.Hotkey, b.Action), "Unknown capture action")
+			item.Disable()
+			continue
+		}
+		actions[b.Hotkey] = mode
+		valid = append(valid, hotkey.Binding{Hotkey: b.Hotkey, Handler: captureHandler(mode)})
+	}
+
+	failed := map[string]error{}
+	for _, err := range hotkey.RegisterAll(valid) {
+		var bindingErr *hotkey.BindingError
+		if errors.As(err, &bindingErr) {
+			failed[bindingErr.Hotkey] = bindingErr.Err
+		}
+		log.Printf("Warning: Failed to register %v", err)
+	}
+
+	for _, b := range valid {
+		title := b.Hotkey + ": " + modeLabels[actions[b.Hotkey]]
+		tooltip := "Hotkey binding"
+		if err, ok := failed[b.Hotkey]; ok {
+			title += " (failed)"
+			tooltip = err.Error()
+		}
+		item := systray.AddMenuItem(title, tooltip)
+		item.Disable()
+	}
+}
+
+func hotkeyTooltip(hotkeyStr string) string {
+	return "SnapHook - Press " + hotkeyStr + " to capture"
+}
+
+// changeHotkey swaps the main hotkey for newHotkey, rolling back to the old
+// one if registration fails, then persists it and refreshes the tray.
+func changeHotkey(newHotkey string, mHotkey *systray.MenuItem) error {
+	normalized, err := shortcut.Normalize(newHotkey)
+	if err != nil {
+		return err
+	}
+
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	oldHotkey := currentConfig.Hotkey
+	if err := hotkey.ChangeHotkey(oldHotkey, normalized, handleScreenshot); err != nil {
+		log.Printf("Failed to change hotkey to %s, keeping %s: %v", normalized, oldHotkey, err)
+		return err
+	}
+	log.Printf("Hotkey changed from %s to %s", oldHotkey, normalized)
+
+	currentConfig.Hotkey = normalized
+	idleTooltip = hotkeyTooltip(normalized)
+	mHotkey.SetTitle("Hotkey: " + normalized)
+	mHotkey.SetTooltip("Current screenshot hotkey")
+	systray.SetTooltip(idleTooltip)
+
+	if err := config.Save(currentConfig); err != nil {
+		log.Printf("Failed to save config: %v", err)
+		return fmt.Errorf("hotkey changed but could not be saved: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"snaphook/internal/capture"
+	"snaphook/internal/clipboard"
+	"snaphook/internal/config"
+	"snaphook/internal/history"
+	"snaphook/internal/imageformat"
+	"snaphook/internal/preview"
+)
+
+var (
+	screenshotMutex      sync.Mutex
+	screenshotInProgress bool
+	countdownCancel      chan struct{}
+	currentConfig        *config.Config
+	configMutex          sync.RWMutex
+
+	// clipboardFormat encodes the file offered for file-paste targets. It is
+	// guarded by configMutex.
+	clipboardFormat = imageformat.Default
+
+	// historyStore records every capture. It is set once at startup and is
+	// nil if the index could not be opened.
+	historyStore *history.Store
+)
+
+// The capture pipeline reaches the platform only through these, so tests can
+// pair capture.SetBackend with recording sinks and run it headlessly.
+var (
+	captureScreen = capture.Capture
+	autoSave      = (*capture.Shot).AutoSave
+	copyImage     = clipboard.Copy
+	showPreview   = preview.Show
+	compactShot   = preview.Compact
+	showCountdown = preview.NotifyCountdown
+	setTooltip    = func(string) {}
+)
+
+// idleTooltip is the tray tooltip shown when no countdown is running. It is
+// guarded by configMutex because it follows the configured hotkey.
+var idleTooltip = "SnapHook"
+
+// handleScreenshot is bound to the main hotkey and captures in the mode
+// chosen in the tray.
+func handleScreenshot() {
+	configMutex.RLock()
+	mode := capture.Mode(currentConfig.CaptureMode)
+	configMutex.RUnlock()
+
+	handleCapture(mode)
+}
+
+// captureHandler returns a hotkey handler that always captures in mode.
+func captureHandler(mode capture.Mode) func() {
+	return func() {
+		handleCapture(mode)
+	}
+}
+
+// errCaptureInProgress is returned by startCapture while another capture or
+// its countdown is running.
+var errCaptureInProgress = errors.New("a capture is already in progress")
+
+// handleCapture runs a capture for a hotkey press. A press during a
+// countdown cancels it instead.
+func handleCapture(mode capture.Mode) {
+	log.Printf("Hotkey pressed - capturing (mode: %s)", mode)
+
+	if cancelCountdown() {
+		log.Println("Hotkey pressed during countdown - capture cancelled")
+		return
+	}
+	if err := startCapture(mode); err != nil {
+		log.Println("Screenshot already in progress, skipping")
+	}
+}
+
+// cancelCountdown cancels a running countdown and reports whether there was
+// one.
+func cancelCountdown() bool {
+	screenshotMutex.Lock()
+	defer screenshotMutex.Unlock()
+
+	if countdownCancel == nil {
+		return false
+	}
+	close(countdownCancel)
+	countdownCancel = nil
+	return true
+}
+
+// startCapture starts a capture in mode, after the configured delay, and
+// hands the shots to the sinks. It returns errCaptureInProgress if a capture
+// is already running.
+func startCapture(mode capture.Mode) error {
+	screenshotMutex.Lock()
+	if screenshotInProgress {
+		screenshotMutex.Unlock()
+		return errCaptureInProgress
+	}
+	screenshotInProgress = true
+
+	configMutex.RLock()
+	delay := currentConfig.CaptureDelay
+	configMutex.RUnlock()
+
+	var cancel chan struct{}
+	if delay > 0 {
+		cancel = make(chan struct{})
+		countdownCancel = cancel
+	}
+	screenshotMutex.Unlock()
+
+	log.Println("Starting screenshot capture")
+
+	go func() {
+		if cancel != nil && !runCountdown(delay, cancel) {
+			screenshotMutex.Lock()
+			screenshotInProgress = false
+			screenshotMutex.Unlock()
+			return
+		}
+
+		shots, err := captureScreen(mode)
+		if err != nil {
+			if errors.Is(err, capture.ErrSelectionCancelled) {
+				log.Println("Region selection cancelled")
+			} else {
+				log.Printf("Error capturing screen: %v", err)
+			}
+			screenshotMutex.Lock()
+			screenshotInProgress = false
+			screenshotMutex.Unlock()
+			return
+		}
+
+		screenshotMutex.Lock()
+		screenshotInProgress = false
+		screenshotMutex.Unlock()
+		log.Println("Screenshot captured - ready for next screenshot")
+
+		configMutex.RLock()
+		copyToClipboard := currentConfig.CopyToClipboard
+		enablePreview := currentConfig.EnablePreview
+		dupAction := duplicateAction
+		dupDistance := duplicateDistance
+		configMutex.RUnlock()
+
+		kept := make([]*keptShot, len(shots))
+		duplicate := make([]bool, len(shots))
+		if dupAction != duplicateOff {
+			for i, shot := range shots {
+				kept[i], duplicate[i] = matchDuplicate(shot, dupDistance)
+			}
+		}
+		// Skipped duplicates still reach the clipboard, since the user just
+		// asked for them, but are not saved, shown or recorded.
+		skip := func(i int) bool {
+			return dupAction == duplicateSkip && duplicate[i]
+		}
+		for i, shot := range shots {
+			if skip(i) {
+				log.Printf("Skipping capture %s: duplicate of %s", shot.ID, kept[i].id)
+			}
+		}
+
+		// Auto-save runs first so the clipboard's file entry can point at
+		// the saved copy rather than a temp file.
+		savedPaths := make([]string, len(shots))
+		for i, shot := range shots {
+			if skip(i) {
+				continue
+			}
+			path, err := autoSave(shot)
+			if err != nil {
+				log.Printf("Error auto-saving screenshot: %v", err)
+			} else if path != "" {
+				log.Printf("Screenshot saved to: %s", path)
+			}
+			savedPaths[i] = path
+		}
+
+		// Only one image fits on the clipboard; with one shot per monitor
+		// the first display wins.
+		var copying sync.WaitGroup
+		if copyToClipboard && len(shots) > 0 {
+			copying.Add(1)
+			go func() {
+				defer copying.Done()
+				copyShot(shots[0])
+			}()
+		}
+		if enablePreview {
+			for i, shot := range shots {
+				if !skip(i) {
+					showPreview(shot)
+				}
+			}
+		}
+
+		// Hashing a large capture takes a moment, so history comes last.
+		for i, shot := range shots {
+			if !skip(i) {
+				recordHistory(shot, savedPaths[i], kept[i], duplicate[i])
+			}
+		}
+
+		// The preview keeps its shots for the session; once every sink is
+		// done with the pixels, only the encoding it serves stays in memory.
+		copying.Wait()
+		if enablePreview {
+			for i, shot := range shots {
+				if skip(i) {
+					continue
+				}
+				if err := compactShot(shot); err != nil {
+					log.Printf("Error compacting screenshot: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// recordHistory adds shot to the history index. path is the auto-saved
+// file, or empty if the shot was not saved. kept is the shot's duplicate
+// detection record, or that of the shot it duplicates; it is nil when
+// detection is off.
+func recordHistory(shot *capture.Shot, path string, kept *keptShot, duplicate bool) {
+	if historyStore == nil {
+		return
+	}
+
+	bounds := shot.Image.Bounds()
+	entry := history.Entry{
+		ID:      shot.ID,
+		Path:    path,
+		Time:    shot.Time,
+		Mode:    string(shot.Mode),
+		Monitor: shot.Display,
+		Width:   bounds.Dx(),
+		Height:  bounds.Dy(),
+		Hash:    shot.Hash(),
+		PHash:   shot.PerceptualHash().String(),
+	}
+	if duplicate {
+		entry.Duplicate = true
+		entry.DuplicateOf = kept.id
+	}
+	if path != "" {
+		if info, err := os.Stat(path); err == nil {
+			entry.Size = info.Size()
+		}
+	}
+	entry, err := historyStore.Add(entry)
+	if err != nil {
+		log.Printf("Error recording screenshot history: %v", err)
+		return
+	}
+
+	// The shot may have been pinned in the preview before it was recorded.
+	if shot.Pinned() {
+		if _, err := historyStore.SetPinned(entry.ID, true); err != nil {
+			log.Printf("Error recording screenshot history: %v", err)
+		}
+	}
+}
+
+// copyShot puts shot on the clipboard. A file is needed for the file-list
+// format, so this writes a temp file unless the shot was auto-saved in the
+// clipboard format.
+func copyShot(shot *capture.Shot) {
+	data, err := shot.PNG()
+	if err != nil {
+		log.Printf("Error copying screenshot to clipboard: %v", err)
+		return
+	}
+
+	configMutex.RLock()
+	format := clipboardFormat
+	configMutex.RUnlock()
+
+	path, err := shot.File(format)
+	if err != nil {
+		log.Printf("Error copying screenshot to clipboard: %v", err)
+		return
+	}
+
+	if err := copyImage(shot.Image, data, path); err != nil {
+		log.Printf("Error copying screenshot to clipboard: %v", err)
+	}
+}
+
+// runCountdown ticks once a second for the given number of seconds, showing
+// the time left in the tray tooltip and on preview pages. It reports false if
+// cancel was closed first.
+func runCountdown(seconds int, cancel chan struct{}) bool {
+	configMutex.RLock()
+	enablePreview := currentConfig.EnablePreview
+	configMutex.RUnlock()
+
+	announce := func(remaining int) {
+		if remaining > 0 {
+			setTooltip(fmt.Sprintf("SnapHook - Capturing in %ds (press hotkey to cancel)", remaining))
+		} else {
+			configMutex.RLock()
+			tooltip := idleTooltip
+			configMutex.RUnlock()
+			setTooltip(tooltip)
+		}
+		if enablePreview {
+			showCountdown(remaining)
+		}
+	}
+	defer announce(0)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for remaining := seconds; remaining > 0; remaining-- {
+		announce(remaining)
+		select {
+		case <-cancel:
+			return false
+		case <-ticker.C:
+		}
+	}
+
+	// A cancel that raced the last tick has already cleared countdownCancel.
+	screenshotMutex.Lock()
+	defer screenshotMutex.Unlock()
+	if countdownCancel != cancel {
+		return false
+	}
+	countdownCancel = nil
+	return true
+}
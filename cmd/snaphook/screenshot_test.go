@@ -0,0 +1,364 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"snaphook/internal/capture"
+	"snaphook/internal/config"
+	"snaphook/internal/history"
+	"snaphook/internal/imageformat"
+)
+
+// sinks records what the capture pipeline hands to the clipboard and the
+// preview.
+type sinks struct {
+	mu     sync.Mutex
+	copies []copied
+	shown  []*capture.Shot
+	// shownPixel is a pixel of the first shot as the preview got it,
+	// before the pipeline compacted it.
+	shownPixel color.RGBA
+	compacted  []*capture.Shot
+	counts     []int
+	tooltip    string
+}
+
+type copied struct {
+	img  image.Image
+	png  []byte
+	path string
+}
+
+func (s *sinks) copyCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.copies)
+}
+
+// setupPipeline runs the pipeline against a fake backend, recording sinks,
+// a temporary auto-save folder and a temporary history.
+func setupPipeline(t *testing.T, cfg *config.Config) (*sinks, *capture.FakeBackend, string) {
+	t.Helper()
+
+	fake := capture.NewFakeBackend(image.Rect(0, 0, 320, 200), image.Rect(320, 0, 640, 200))
+	capture.SetBackend(fake)
+	t.Cleanup(func() { capture.SetBackend(nil) })
+
+	dir := t.TempDir()
+	saveDir := filepath.Join(dir, "saved")
+	if err := os.Mkdir(saveDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	capture.SetAutoSave(cfg.AutoSave, saveDir)
+	t.Cleanup(func() { capture.SetAutoSave(false, "") })
+
+	store, err := history.Open(filepath.Join(dir, "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &sinks{}
+	oldCopy, oldShow, oldCompact, oldCountdown, oldTooltip := copyImage, showPreview, compactShot, showCountdown, setTooltip
+	copyImage = func(img image.Image, png []byte, path string) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.copies = append(s.copies, copied{img, png, path})
+		return nil
+	}
+	showPreview = func(shot *capture.Shot) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if len(s.shown) == 0 {
+			s.shownPixel = shot.Image.RGBAAt(5, 7)
+		}
+		s.shown = append(s.shown, shot)
+		return nil
+	}
+	compactShot = func(shot *capture.Shot) error {
+		err := shot.Compact(imageformat.Default)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.compacted = append(s.compacted, shot)
+		return err
+	}
+	showCountdown = func(remaining int) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.counts = append(s.counts, remaining)
+	}
+	setTooltip = func(text string) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.tooltip = text
+	}
+
+	configMutex.Lock()
+	currentConfig = cfg
+	historyStore = store
+	duplicateAction = duplicateMark
+	duplicateDistance = 0
+	configMutex.Unlock()
+
+	recentMutex.Lock()
+	recentShots = nil
+	recentMutex.Unlock()
+
+	t.Cleanup(func() {
+		waitFor(t, "the capture to finish", func() bool {
+			screenshotMutex.Lock()
+			defer screenshotMutex.Unlock()
+			return !screenshotInProgress
+		})
+		copyImage, showPreview, compactShot, showCountdown, setTooltip = oldCopy, oldShow, oldCompact, oldCountdown, oldTooltip
+		historyStore = nil
+	})
+	return s, fake, saveDir
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func historyEntries(t *testing.T) []history.Entry {
+	t.Helper()
+	entries, err := historyStore.List(history.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestCapturePipeline(t *testing.T) {
+	s, fake, saveDir := setupPipeline(t, &config.Config{
+		CopyToClipboard: true,
+		EnablePreview:   true,
+		AutoSave:        true,
+	})
+	fake.SetCursor(400, 50) // second display
+
+	if err := startCapture(capture.ModeMonitor); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the capture to be recorded", func() bool {
+		return len(historyEntries(t)) == 1 && s.copyCount() == 1
+	})
+	waitFor(t, "the preview's shot to be compacted", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.compacted) == 1
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.shown) != 1 {
+		t.Fatalf("preview got %d shots, want 1", len(s.shown))
+	}
+	shot := s.shown[0]
+	if shot.Bounds != image.Rect(320, 0, 640, 200) || shot.Display != 1 || shot.Mode != capture.ModeMonitor {
+		t.Errorf("shot = %v display %d mode %s, want the second display", shot.Bounds, shot.Display, shot.Mode)
+	}
+	if got, want := s.shownPixel, capture.FakePixel(325, 7); got != want {
+		t.Errorf("pixel = %v, want %v", got, want)
+	}
+	if s.compacted[0] != shot || shot.Image != nil {
+		t.Error("the shown shot still holds its pixels after the pipeline")
+	}
+	if data, err := shot.Encode(imageformat.Default); err != nil || len(data) == 0 {
+		t.Errorf("compacted shot cannot be served: %v", err)
+	}
+
+	c := s.copies[0]
+	if c.img.Bounds().Size() != image.Pt(320, 200) || len(c.png) == 0 {
+		t.Errorf("clipboard got a %v image and %d PNG bytes", c.img.Bounds(), len(c.png))
+	}
+	if filepath.Dir(c.path) != saveDir {
+		t.Errorf("clipboard file %s is not the auto-saved copy in %s", c.path, saveDir)
+	}
+
+	e := historyEntries(t)[0]
+	if e.ID != shot.ID || e.Hash != shot.Hash() || e.Mode != "monitor" || e.Monitor != 1 {
+		t.Errorf("history entry = %+v, want the shown shot", e)
+	}
+	if e.Path != c.path || e.Size == 0 || e.Width != 320 || e.Height != 200 {
+		t.Errorf("history entry = %+v, want the saved file", e)
+	}
+	if e.Duplicate {
+		t.Error("first capture marked as duplicate")
+	}
+}
+
+func TestCapturePipelineSkipsDuplicates(t *testing.T) {
+	s, _, _ := setupPipeline(t, &config.Config{CopyToClipboard: true, EnablePreview: true})
+	duplicateAction = duplicateSkip
+
+	for i := 1; i <= 2; i++ {
+		if err := startCapture(capture.ModeMonitor); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, "the clipboard", func() bool { return s.copyCount() == i })
+		waitFor(t, "the capture to finish", func() bool {
+			screenshotMutex.Lock()
+			defer screenshotMutex.Unlock()
+			return !screenshotInProgress
+		})
+	}
+	// The second capture has identical pixels: copied, but not shown or
+	// recorded.
+	waitFor(t, "the first capture to be recorded", func() bool { return len(historyEntries(t)) == 1 })
+	time.Sleep(50 * time.Millisecond)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.shown) != 1 {
+		t.Errorf("preview got %d shots, want 1", len(s.shown))
+	}
+	if n := len(historyEntries(t)); n != 1 {
+		t.Errorf("history has %d entries, want 1", n)
+	}
+}
+
+func TestCapturePipelineSkipsNearDuplicates(t *testing.T) {
+	s, _, _ := setupPipeline(t, &config.Config{CopyToClipboard: true, EnablePreview: true})
+	duplicateAction = duplicateSkip
+	duplicateDistance = 2
+
+	// The second capture differs from the first in one pixel, which is
+	// within the distance, so it is skipped like an exact copy.
+	oldCapture := captureScreen
+	t.Cleanup(func() { captureScreen = oldCapture })
+	calls := 0
+	captureScreen = func(mode capture.Mode) ([]*capture.Shot, error) {
+		shots, err := oldCapture(mode)
+		if calls++; calls == 2 && err == nil {
+			shots[0].Image.Pix[0] ^= 0xff
+		}
+		return shots, err
+	}
+
+	for i := 1; i <= 2; i++ {
+		if err := startCapture(capture.ModeMonitor); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, "the clipboard", func() bool { return s.copyCount() == i })
+		waitFor(t, "the capture to finish", func() bool {
+			screenshotMutex.Lock()
+			defer screenshotMutex.Unlock()
+			return !screenshotInProgress
+		})
+	}
+	waitFor(t, "the first capture to be recorded", func() bool { return len(historyEntries(t)) == 1 })
+	time.Sleep(50 * time.Millisecond)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.shown) != 1 {
+		t.Errorf("preview got %d shots, want 1", len(s.shown))
+	}
+	if n := len(historyEntries(t)); n != 1 {
+		t.Errorf("history has %d entries, want 1", n)
+	}
+}
+
+// Beyond the distance a changed capture is kept.
+func TestCapturePipelineKeepsDistinctShots(t *testing.T) {
+	s, _, _ := setupPipeline(t, &config.Config{CopyToClipboard: true, EnablePreview: true})
+	duplicateAction = duplicateSkip
+
+	oldCapture := captureScreen
+	t.Cleanup(func() { captureScreen = oldCapture })
+	calls := 0
+	captureScreen = func(mode capture.Mode) ([]*capture.Shot, error) {
+		shots, err := oldCapture(mode)
+		if calls++; calls == 2 && err == nil {
+			invert(shots[0].Image)
+		}
+		return shots, err
+	}
+
+	for i := 1; i <= 2; i++ {
+		if err := startCapture(capture.ModeMonitor); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, "the capture to be recorded", func() bool { return len(historyEntries(t)) == i })
+	}
+	waitFor(t, "the pipeline to finish", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.copies) == 2 && len(s.compacted) == 2
+	})
+
+	entries := historyEntries(t)
+	if entries[0].Duplicate || entries[1].Duplicate {
+		t.Errorf("history = %+v, want neither capture marked as a duplicate", entries)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.shown) != 2 {
+		t.Errorf("preview got %d shots, want 2", len(s.shown))
+	}
+}
+
+// invert flips every colour in img, which reverses its gradients.
+func invert(img *image.RGBA) {
+	for i := range img.Pix {
+		if i%4 != 3 {
+			img.Pix[i] = ^img.Pix[i]
+		}
+	}
+}
+
+func TestCaptureCountdownCancel(t *testing.T) {
+	s, fake, _ := setupPipeline(t, &config.Config{CopyToClipboard: true, EnablePreview: true, CaptureDelay: 3})
+
+	if err := startCapture(capture.ModeMonitor); err != nil {
+		t.Fatal(err)
+	}
+	if err := startCapture(capture.ModeMonitor); err != errCaptureInProgress {
+		t.Errorf("second startCapture = %v, want errCaptureInProgress", err)
+	}
+	waitFor(t, "the countdown to start", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.counts) > 0
+	})
+	if !cancelCountdown() {
+		t.Fatal("cancelCountdown found no countdown")
+	}
+	waitFor(t, "the countdown to end", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.counts[len(s.counts)-1] == 0
+	})
+
+	if n := len(fake.Captures()); n != 0 {
+		t.Errorf("backend captured %d times after cancelling", n)
+	}
+	if n := s.copyCount(); n != 0 {
+		t.Errorf("clipboard got %d images after cancelling", n)
+	}
+	if n := len(historyEntries(t)); n != 0 {
+		t.Errorf("history has %d entries after cancelling", n)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counts[0] != 3 {
+		t.Errorf("countdown started at %d, want 3", s.counts[0])
+	}
+	if s.tooltip != idleTooltip {
+		t.Errorf("tooltip = %q, want it restored to %q", s.tooltip, idleTooltip)
+	}
+}
@@ -0,0 +1,135 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/getlantern/systray"
+
+	"snaphook/internal/capture"
+	"snaphook/internal/config"
+	"snaphook/internal/preview"
+	"snaphook/internal/shortcut"
+)
+
+// settingsMenu holds the tray items that settings changed through the
+// preview API must keep in step.
+type settingsMenu struct {
+	hotkey        *systray.MenuItem
+	copyClipboard *systray.MenuItem
+	autoSave      *systray.MenuItem
+	modes         map[capture.Mode]*systray.MenuItem
+	delays        map[int]*systray.MenuItem
+}
+
+// currentSettings reports the settings the preview API exposes.
+func currentSettings() preview.Settings {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	mode := currentConfig.CaptureMode
+	if mode == "" {
+		mode = string(capture.ModeMonitor)
+	}
+	return preview.Settings{
+		Hotkey:          currentConfig.Hotkey,
+		CaptureMode:     mode,
+		CaptureDelay:    currentConfig.CaptureDelay,
+		CopyToClipboard: currentConfig.CopyToClipboard,
+		AutoSave:        currentConfig.AutoSave,
+		SaveDir:         currentConfig.SaveDir,
+		AutoSaveDir:     config.GetAutoSaveDir(currentConfig.SaveDir),
+		EnablePreview:   currentConfig.EnablePreview,
+	}
+}
+
+// changeSettings applies a settings update from the preview API as if it
+// had been made in the tray. Fields are checked before anything changes, so
+// an invalid update changes nothing; a folder or hotkey that is rejected
+// when applied stops the update there. The hotkey goes last so that it is
+// only changed once everything else has been.
+func changeSettings(p preview.SettingsPatch, menu settingsMenu) error {
+	if err := validateSettings(p, menu); err != nil {
+		return &preview.InvalidSettingsError{Err: err}
+	}
+
+	if p.SaveDir != nil {
+		if err := changeSaveDir(*p.SaveDir, menu.autoSave); err != nil {
+			return err
+		}
+	}
+	if p.CaptureMode != nil {
+		setCaptureMode(capture.Mode(*p.CaptureMode), menu.modes)
+	}
+	if p.CaptureDelay != nil {
+		setCaptureDelay(*p.CaptureDelay, menu.delays)
+	}
+	if err := changeToggles(p, menu); err != nil {
+		return err
+	}
+	if p.Hotkey != nil {
+		return changeHotkey(*p.Hotkey, menu.hotkey)
+	}
+	return nil
+}
+
+// changeToggles applies the clipboard and auto-save switches of p.
+func changeToggles(p preview.SettingsPatch, menu settingsMenu) error {
+	if p.CopyToClipboard == nil && p.AutoSave == nil {
+		return nil
+	}
+
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	if p.CopyToClipboard != nil {
+		currentConfig.CopyToClipboard = *p.CopyToClipboard
+		if *p.CopyToClipboard {
+			menu.copyClipboard.Check()
+		} else {
+			menu.copyClipboard.Uncheck()
+		}
+	}
+	if p.AutoSave != nil {
+		if err := applyAutoSave(*p.AutoSave, menu.autoSave); err != nil {
+			return err
+		}
+		currentConfig.AutoSave = *p.AutoSave
+		if *p.AutoSave {
+			menu.autoSave.Check()
+		} else {
+			menu.autoSave.Uncheck()
+		}
+	}
+
+	if err := config.Save(currentConfig); err != nil {
+		log.Printf("Failed to save config: %v", err)
+		return fmt.Errorf("settings changed but could not be saved: %w", err)
+	}
+	return nil
+}
+
+// validateSettings checks a patch before changeSettings applies any of it.
+// It creates nothing, so a rejected patch leaves no new folder behind.
+func validateSettings(p preview.SettingsPatch, menu settingsMenu) error {
+	if p.Hotkey != nil {
+		if _, err := shortcut.Normalize(*p.Hotkey); err != nil {
+			return err
+		}
+	}
+	if p.CaptureMode != nil && !capture.Mode(*p.CaptureMode).Valid() {
+		return fmt.Errorf("unknown capture mode %q", *p.CaptureMode)
+	}
+	if p.CaptureDelay != nil && menu.delays[*p.CaptureDelay] == nil {
+		return errors.New("capture_delay must be 0, 3, 5 or 10")
+	}
+	if p.SaveDir != nil {
+		if err := config.CheckAutoSaveDir(config.GetAutoSaveDir(*p.SaveDir)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
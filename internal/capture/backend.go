@@ -0,0 +1,88 @@
+package capture
+
+import (
+	"fmt"
+	"image"
+	"sync"
+)
+
+// Backend is the platform layer capture is built on. Coordinates are in the
+// virtual desktop space shared by displays, cursor and capture rectangles.
+type Backend interface {
+	Displays() ([]image.Rectangle, error)
+	CursorPosition() (image.Point, error)
+	CaptureRect(rect image.Rectangle) (*image.RGBA, error)
+}
+
+var (
+	backend      Backend
+	backendMutex sync.RWMutex
+)
+
+// SetBackend replaces the backend used by all capture functions. Passing nil
+// restores the native backend for the current platform.
+func SetBackend(b Backend) {
+	backendMutex.Lock()
+	defer backendMutex.Unlock()
+	backend = b
+}
+
+func getBackend() Backend {
+	backendMutex.RLock()
+	b := backend
+	backendMutex.RUnlock()
+	if b != nil {
+		return b
+	}
+
+	backendMutex.Lock()
+	defer backendMutex.Unlock()
+	if backend == nil {
+		backend = newNativeBackend()
+	}
+	return backend
+}
+
+func getDisplays(b Backend) ([]image.Rectangle, error) {
+	displays, err := b.Displays()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list displays: %w", err)
+	}
+	if len(displays) == 0 {
+		return nil, fmt.Errorf("no active displays found")
+	}
+	return displays, nil
+}
+
+func getDisplayAtCursor(b Backend, displays []image.Rectangle) int {
+	pt, err := b.CursorPosition()
+	if err != nil {
+		return 0
+	}
+
+	for i, bounds := range displays {
+		if pt.In(bounds) {
+			return i
+		}
+	}
+
+	return 0
+}
+
+// getDisplayForRect returns the display holding the centre of rect, or -1 if
+// it falls between displays or they cannot be listed.
+func getDisplayForRect(b Backend, rect image.Rectangle) int {
+	displays, err := getDisplays(b)
+	if err != nil {
+		return -1
+	}
+
+	center := image.Pt((rect.Min.X+rect.Max.X)/2, (rect.Min.Y+rect.Max.Y)/2)
+	for i, bounds := range displays {
+		if center.In(bounds) {
+			return i
+		}
+	}
+
+	return -1
+}
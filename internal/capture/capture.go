@@ -1,14 +1,24 @@
 package capture
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"runtime"
 	"sync"
+	"time"
+
+	"snaphook/internal/imageformat"
+	"snaphook/internal/nametemplate"
+	"snaphook/internal/retention"
 )
 
 var (
-	autoSaveEnabled bool
-	autoSaveDir     string
-	autoSaveMutex   sync.RWMutex
+	autoSaveEnabled  bool
+	autoSaveDir      string
+	autoSaveFormat   = imageformat.Default
+	autoSaveTemplate = mustParseTemplate(nametemplate.Default)
+	autoSaveMutex    sync.RWMutex
 )
 
 func SetAutoSave(enabled bool, dir string) {
@@ -18,14 +28,137 @@ func SetAutoSave(enabled bool, dir string) {
 	autoSaveDir = dir
 }
 
-func getAutoSaveConfig() (bool, string) {
+// SetAutoSaveFormat sets the encoding, and so the extension, of auto-saved
+// files.
+func SetAutoSaveFormat(f imageformat.Format) {
+	autoSaveMutex.Lock()
+	defer autoSaveMutex.Unlock()
+	autoSaveFormat = f
+}
+
+// SetAutoSaveTemplate sets how auto-saved files are named; nil restores
+// nametemplate.Default.
+func SetAutoSaveTemplate(t *nametemplate.Template) {
+	if t == nil {
+		t = mustParseTemplate(nametemplate.Default)
+	}
+	autoSaveMutex.Lock()
+	defer autoSaveMutex.Unlock()
+	autoSaveTemplate = t
+}
+
+func getAutoSaveConfig() (bool, string, imageformat.Format, *nametemplate.Template) {
 	autoSaveMutex.RLock()
 	defer autoSaveMutex.RUnlock()
-	return autoSaveEnabled, autoSaveDir
+	return autoSaveEnabled, autoSaveDir, autoSaveFormat, autoSaveTemplate
+}
+
+func mustParseTemplate(s string) *nametemplate.Template {
+	t, err := nametemplate.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Mode selects what a hotkey capture grabs.
+type Mode string
+
+const (
+	ModeMonitor     Mode = "monitor"
+	ModeRegion      Mode = "region"
+	ModeAllDisplays Mode = "all"
+	ModeWindow      Mode = "window"
+)
+
+// Valid reports whether m is a mode Capture understands.
+func (m Mode) Valid() bool {
+	switch m {
+	case ModeMonitor, ModeRegion, ModeAllDisplays, ModeWindow:
+		return true
+	}
+	return false
 }
 
-func CaptureScreen() (string, error) {
-	return captureScreen()
+// Capture runs a capture in the given mode and returns the shots it took.
+// An empty mode captures the monitor under the cursor.
+func Capture(mode Mode) ([]*Shot, error) {
+	var shot *Shot
+	var err error
+
+	switch mode {
+	case ModeMonitor, "":
+		shot, err = CaptureScreen()
+	case ModeRegion:
+		shot, err = CaptureSelection()
+	case ModeAllDisplays:
+		return CaptureAllDisplays()
+	case ModeWindow:
+		shot, err = CaptureActiveWindow()
+	default:
+		return nil, fmt.Errorf("unknown capture mode: %s", mode)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return []*Shot{shot}, nil
+}
+
+// CaptureScreen captures the display under the cursor.
+func CaptureScreen() (*Shot, error) {
+	b := getBackend()
+	displays, err := getDisplays(b)
+	if err != nil {
+		return nil, err
+	}
+
+	displayIndex := getDisplayAtCursor(b, displays)
+	img, err := b.CaptureRect(displays[displayIndex])
+	if err != nil {
+		return nil, fmt.Errorf("screenshot capture failed: %w", err)
+	}
+
+	shot := newShot(img, displayIndex, displays[displayIndex])
+	shot.Mode = ModeMonitor
+	return shot, nil
+}
+
+// CleanupTempFiles deletes the temp files shots were written to for
+// file-paste targets, as far as p requires. Files of pinned shots are kept.
+// It returns how many files were deleted.
+func CleanupTempFiles(p retention.Policy) int {
+	if p.IsZero() {
+		return 0
+	}
+
+	matches, err := filepath.Glob(filepath.Join(os.TempDir(), "snapview-*"))
+	if err != nil {
+		return 0
+	}
+
+	pinned := pinnedTempPaths()
+	var items []retention.Item
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		items = append(items, retention.Item{
+			Path:   path,
+			Time:   info.ModTime(),
+			Size:   info.Size(),
+			Pinned: pinned[path],
+		})
+	}
+
+	removed := 0
+	for _, item := range p.Select(items, time.Now()) {
+		if os.Remove(item.Path) == nil {
+			removed++
+		}
+	}
+	return removed
 }
 
 func init() {
@@ -0,0 +1,157 @@
+//go:build linux
+
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"sync"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/randr"
+	"github.com/jezek/xgb/xproto"
+)
+
+// x11Backend shares one connection between all calls. A connection found
+// closed, as after an X server restart, is replaced and the call retried.
+type x11Backend struct {
+	mu   sync.Mutex
+	conn *xgb.Conn
+}
+
+func newNativeBackend() Backend {
+	return &x11Backend{}
+}
+
+func (b *x11Backend) withX11(fn func(conn *xgb.Conn, screen *xproto.ScreenInfo) error) error {
+	conn, err := b.connect()
+	if err != nil {
+		return err
+	}
+	err = fn(conn, xproto.Setup(conn).DefaultScreen(conn))
+	if !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	b.disconnect(conn)
+	conn, err = b.connect()
+	if err != nil {
+		return err
+	}
+	return fn(conn, xproto.Setup(conn).DefaultScreen(conn))
+}
+
+func (b *x11Backend) connect() (*xgb.Conn, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn != nil {
+		return b.conn, nil
+	}
+	conn, err := xgb.NewConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to X server: %w", err)
+	}
+	b.conn = conn
+	return conn, nil
+}
+
+// disconnect drops conn unless another call has already replaced it.
+func (b *x11Backend) disconnect(conn *xgb.Conn) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == conn {
+		b.conn = nil
+	}
+	conn.Close()
+}
+
+func (b *x11Backend) Displays() ([]image.Rectangle, error) {
+	var monitors []image.Rectangle
+	err := b.withX11(func(conn *xgb.Conn, screen *xproto.ScreenInfo) error {
+		monitors = getMonitorBounds(conn, screen)
+		return nil
+	})
+	return monitors, err
+}
+
+func (b *x11Backend) CursorPosition() (image.Point, error) {
+	var pt image.Point
+	err := b.withX11(func(conn *xgb.Conn, screen *xproto.ScreenInfo) error {
+		reply, err := xproto.QueryPointer(conn, screen.Root).Reply()
+		if err != nil {
+			return err
+		}
+		pt = image.Pt(int(reply.RootX), int(reply.RootY))
+		return nil
+	})
+	return pt, err
+}
+
+func (b *x11Backend) CaptureRect(rect image.Rectangle) (*image.RGBA, error) {
+	var img *image.RGBA
+	err := b.withX11(func(conn *xgb.Conn, screen *xproto.ScreenInfo) error {
+		var err error
+		img, err = captureRoot(conn, screen, rect)
+		return err
+	})
+	return img, err
+}
+
+// getMonitorBounds returns the geometry of every active RandR monitor in
+// root window coordinates. When RandR is unavailable the whole root window
+// is treated as a single monitor.
+func getMonitorBounds(conn *xgb.Conn, screen *xproto.ScreenInfo) []image.Rectangle {
+	rootBounds := image.Rect(0, 0, int(screen.WidthInPixels), int(screen.HeightInPixels))
+
+	if err := randr.Init(conn); err != nil {
+		return []image.Rectangle{rootBounds}
+	}
+
+	reply, err := randr.GetMonitors(conn, screen.Root, true).Reply()
+	if err != nil || len(reply.Monitors) == 0 {
+		return []image.Rectangle{rootBounds}
+	}
+
+	monitors := make([]image.Rectangle, 0, len(reply.Monitors))
+	for _, m := range reply.Monitors {
+		x, y := int(m.X), int(m.Y)
+		monitors = append(monitors, image.Rect(x, y, x+int(m.Width), y+int(m.Height)))
+	}
+	return monitors
+}
+
+// captureRoot reads rect from the root window. The server returns 32-bit
+// BGRX pixels for 24 and 32 bit visuals, which are swizzled to RGBA.
+func captureRoot(conn *xgb.Conn, screen *xproto.ScreenInfo, rect image.Rectangle) (*image.RGBA, error) {
+	rootBounds := image.Rect(0, 0, int(screen.WidthInPixels), int(screen.HeightInPixels))
+	rect = rect.Intersect(rootBounds)
+	if rect.Empty() {
+		return nil, fmt.Errorf("capture area is outside the screen")
+	}
+
+	reply, err := xproto.GetImage(conn, xproto.ImageFormatZPixmap, xproto.Drawable(screen.Root),
+		int16(rect.Min.X), int16(rect.Min.Y), uint16(rect.Dx()), uint16(rect.Dy()), 0xffffffff).Reply()
+	if err != nil {
+		return nil, err
+	}
+	if reply.Depth != 24 && reply.Depth != 32 {
+		return nil, fmt.Errorf("unsupported screen depth: %d", reply.Depth)
+	}
+
+	width, height := rect.Dx(), rect.Dy()
+	if len(reply.Data) < width*height*4 {
+		return nil, fmt.Errorf("short image data: got %d bytes", len(reply.Data))
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < width*height*4; i += 4 {
+		img.Pix[i] = reply.Data[i+2]
+		img.Pix[i+1] = reply.Data[i+1]
+		img.Pix[i+2] = reply.Data[i]
+		img.Pix[i+3] = 255
+	}
+
+	return img, nil
+}
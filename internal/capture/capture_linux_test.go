@@ -0,0 +1,140 @@
+//go:build linux
+
+package capture
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"testing"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// connectX11 connects to the X server in DISPLAY, such as Xvfb, or skips
+// the test when there is none.
+func connectX11(t *testing.T) (*xgb.Conn, *xproto.ScreenInfo) {
+	t.Helper()
+	if os.Getenv("DISPLAY") == "" {
+		t.Skip("DISPLAY is not set; run under Xvfb")
+	}
+	conn, err := xgb.NewConn()
+	if err != nil {
+		t.Skipf("cannot connect to the X server: %v", err)
+	}
+	t.Cleanup(conn.Close)
+
+	screen := xproto.Setup(conn).DefaultScreen(conn)
+	if screen.RootDepth != 24 && screen.RootDepth != 32 {
+		t.Skipf("unsupported root depth %d", screen.RootDepth)
+	}
+	return conn, screen
+}
+
+// rootVisual returns the screen's default visual, whose masks give the pixel
+// values of pure colours.
+func rootVisual(t *testing.T, screen *xproto.ScreenInfo) xproto.VisualInfo {
+	t.Helper()
+	for _, depth := range screen.AllowedDepths {
+		for _, v := range depth.Visuals {
+			if v.VisualId == screen.RootVisual {
+				return v
+			}
+		}
+	}
+	t.Fatal("root visual not found")
+	return xproto.VisualInfo{}
+}
+
+// showPattern maps a window over rect whose left half is red and right half
+// blue, and waits until the server has drawn it.
+func showPattern(t *testing.T, conn *xgb.Conn, screen *xproto.ScreenInfo, rect image.Rectangle) {
+	t.Helper()
+	visual := rootVisual(t, screen)
+
+	win, err := xproto.NewWindowId(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = xproto.CreateWindowChecked(conn, screen.RootDepth, win, screen.Root,
+		int16(rect.Min.X), int16(rect.Min.Y), uint16(rect.Dx()), uint16(rect.Dy()), 0,
+		xproto.WindowClassInputOutput, screen.RootVisual,
+		xproto.CwBackPixel|xproto.CwOverrideRedirect, []uint32{visual.RedMask, 1}).Check()
+	if err != nil {
+		t.Fatalf("CreateWindow: %v", err)
+	}
+	t.Cleanup(func() { xproto.DestroyWindow(conn, win) })
+
+	if err := xproto.MapWindowChecked(conn, win).Check(); err != nil {
+		t.Fatalf("MapWindow: %v", err)
+	}
+
+	gc, err := xproto.NewGcontextId(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xproto.CreateGCChecked(conn, gc, xproto.Drawable(win), xproto.GcForeground, []uint32{visual.BlueMask}).Check(); err != nil {
+		t.Fatalf("CreateGC: %v", err)
+	}
+	defer xproto.FreeGC(conn, gc)
+
+	half := xproto.Rectangle{X: int16(rect.Dx() / 2), Width: uint16(rect.Dx() - rect.Dx()/2), Height: uint16(rect.Dy())}
+	if err := xproto.PolyFillRectangleChecked(conn, xproto.Drawable(win), gc, []xproto.Rectangle{half}).Check(); err != nil {
+		t.Fatalf("PolyFillRectangle: %v", err)
+	}
+
+	// A round trip makes sure every request above has been processed.
+	if _, err := xproto.GetInputFocus(conn).Reply(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestX11CaptureRect(t *testing.T) {
+	conn, screen := connectX11(t)
+
+	rect := image.Rect(40, 30, 104, 62)
+	showPattern(t, conn, screen, rect)
+
+	img, err := newNativeBackend().CaptureRect(rect)
+	if err != nil {
+		t.Fatalf("CaptureRect: %v", err)
+	}
+	if got := img.Bounds(); got != image.Rect(0, 0, rect.Dx(), rect.Dy()) {
+		t.Fatalf("bounds = %v, want %dx%d", got, rect.Dx(), rect.Dy())
+	}
+
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+	for _, tc := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{0, 0, red},
+		{rect.Dx()/2 - 1, rect.Dy() - 1, red},
+		{rect.Dx() / 2, 0, blue},
+		{rect.Dx() - 1, rect.Dy() - 1, blue},
+	} {
+		if got := img.RGBAAt(tc.x, tc.y); got != tc.want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", tc.x, tc.y, got, tc.want)
+		}
+	}
+}
+
+func TestX11Displays(t *testing.T) {
+	_, screen := connectX11(t)
+
+	displays, err := newNativeBackend().Displays()
+	if err != nil {
+		t.Fatalf("Displays: %v", err)
+	}
+	if len(displays) == 0 {
+		t.Fatal("no displays")
+	}
+	root := image.Rect(0, 0, int(screen.WidthInPixels), int(screen.HeightInPixels))
+	for _, d := range displays {
+		if d.Empty() || !d.In(root) {
+			t.Errorf("display %v is not inside the root window %v", d, root)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package capture
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sync"
+)
+
+// FakeBackend is an in-memory Backend that serves synthetic images, so the
+// capture pipeline can run without a display.
+type FakeBackend struct {
+	mu       sync.Mutex
+	displays []image.Rectangle
+	cursor   image.Point
+	captures []image.Rectangle
+
+	selection    image.Rectangle
+	selectionErr error
+	window       image.Rectangle
+}
+
+func NewFakeBackend(displays ...image.Rectangle) *FakeBackend {
+	if len(displays) == 0 {
+		displays = []image.Rectangle{image.Rect(0, 0, 1920, 1080)}
+	}
+	return &FakeBackend{displays: displays}
+}
+
+func (f *FakeBackend) Displays() ([]image.Rectangle, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]image.Rectangle(nil), f.displays...), nil
+}
+
+func (f *FakeBackend) SetCursor(x, y int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cursor = image.Pt(x, y)
+}
+
+func (f *FakeBackend) CursorPosition() (image.Point, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cursor, nil
+}
+
+// SetSelection sets what SelectRegion reports, as if the user had dragged out
+// rect. A non-nil err, such as ErrSelectionCancelled, is returned instead.
+func (f *FakeBackend) SetSelection(rect image.Rectangle, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.selection = rect
+	f.selectionErr = err
+}
+
+func (f *FakeBackend) SelectRegion() (image.Rectangle, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.selectionErr != nil {
+		return image.Rectangle{}, f.selectionErr
+	}
+	return f.selection, nil
+}
+
+// SetActiveWindow sets the rectangle ActiveWindowBounds reports. The fake
+// has no decorations, so WindowOptions do not change the result.
+func (f *FakeBackend) SetActiveWindow(rect image.Rectangle) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.window = rect
+}
+
+func (f *FakeBackend) ActiveWindowBounds(opts WindowOptions) (image.Rectangle, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.window.Empty() {
+		return image.Rectangle{}, fmt.Errorf("no active window")
+	}
+	return f.window, nil
+}
+
+// CaptureRect returns an image whose pixels are FakePixel of their virtual
+// desktop coordinates, and records the request.
+func (f *FakeBackend) CaptureRect(rect image.Rectangle) (*image.RGBA, error) {
+	if rect.Empty() {
+		return nil, fmt.Errorf("empty capture rectangle")
+	}
+
+	f.mu.Lock()
+	f.captures = append(f.captures, rect)
+	f.mu.Unlock()
+
+	img := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	for y := 0; y < rect.Dy(); y++ {
+		for x := 0; x < rect.Dx(); x++ {
+			img.SetRGBA(x, y, FakePixel(rect.Min.X+x, rect.Min.Y+y))
+		}
+	}
+	return img, nil
+}
+
+// Captures returns every rectangle passed to CaptureRect so far.
+func (f *FakeBackend) Captures() []image.Rectangle {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]image.Rectangle(nil), f.captures...)
+}
+
+// FakePixel is the colour FakeBackend reports at virtual desktop point (x, y).
+func FakePixel(x, y int) color.RGBA {
+	return color.RGBA{R: uint8(x), G: uint8(y), B: uint8(x>>8 ^ y>>8), A: 255}
+}
@@ -0,0 +1,52 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// ErrSelectionCancelled is returned by CaptureSelection when the user
+// dismisses the overlay without selecting anything.
+var ErrSelectionCancelled = errors.New("region selection cancelled")
+
+// RegionSelector is implemented by backends that can let the user drag out a
+// rectangle on screen. The result is in virtual desktop coordinates.
+type RegionSelector interface {
+	SelectRegion() (image.Rectangle, error)
+}
+
+// CaptureRegion captures rect, given in virtual desktop coordinates, without
+// any user interaction.
+func CaptureRegion(rect image.Rectangle) (*Shot, error) {
+	rect = rect.Canon()
+	if rect.Empty() {
+		return nil, fmt.Errorf("capture region is empty")
+	}
+
+	b := getBackend()
+	img, err := b.CaptureRect(rect)
+	if err != nil {
+		return nil, fmt.Errorf("screenshot capture failed: %w", err)
+	}
+
+	shot := newShot(img, getDisplayForRect(b, rect), rect)
+	shot.Mode = ModeRegion
+	return shot, nil
+}
+
+// CaptureSelection shows the selection overlay and captures the rectangle the
+// user drags out.
+func CaptureSelection() (*Shot, error) {
+	selector, ok := getBackend().(RegionSelector)
+	if !ok {
+		return nil, fmt.Errorf("region selection is not supported on this platform")
+	}
+
+	rect, err := selector.SelectRegion()
+	if err != nil {
+		return nil, err
+	}
+
+	return CaptureRegion(rect)
+}
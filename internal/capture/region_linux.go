@@ -0,0 +1,352 @@
+//go:build linux
+
+package capture
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// xcCrosshair is the crosshair glyph in the standard X cursor font.
+const xcCrosshair = 34
+
+// SelectRegion dims the screen with a translucent overlay and shows the
+// selection clear while the user drags. Any key or the right button cancels.
+func (b *x11Backend) SelectRegion() (image.Rectangle, error) {
+	var rect image.Rectangle
+	err := b.withX11(func(conn *xgb.Conn, screen *xproto.ScreenInfo) error {
+		var err error
+		rect, err = selectRegion(conn, screen)
+		return err
+	})
+	return rect, err
+}
+
+func selectRegion(conn *xgb.Conn, screen *xproto.ScreenInfo) (image.Rectangle, error) {
+	// The connection is shared; events left from an earlier selection must
+	// not end this one.
+	for {
+		ev, xerr := conn.PollForEvent()
+		if ev == nil && xerr == nil {
+			break
+		}
+	}
+
+	cursor, err := createCrosshairCursor(conn)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	defer xproto.FreeCursor(conn, cursor)
+
+	// Without a compositing manager the alpha channel is ignored and the
+	// overlay would black out the screen, so the band is drawn in XOR on the
+	// root window instead.
+	if visual, ok := argbVisual(screen); ok && compositing(conn) {
+		p, err := newOverlayPainter(conn, screen, visual)
+		if err != nil {
+			return image.Rectangle{}, err
+		}
+		defer p.close()
+		return trackSelection(conn, p.win, cursor, p)
+	}
+
+	p, err := newXORPainter(conn, screen)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	defer p.close()
+	return trackSelection(conn, screen.Root, cursor, p)
+}
+
+// bandPainter shows the selection while the user drags.
+type bandPainter interface {
+	// show draws band, which is empty before the drag starts. It is called
+	// again with the same band when the overlay needs repainting.
+	show(band image.Rectangle)
+	close()
+}
+
+// trackSelection grabs the pointer and keyboard on win and follows a drag
+// with the left button. Any key or another button cancels.
+func trackSelection(conn *xgb.Conn, win xproto.Window, cursor xproto.Cursor, p bandPainter) (image.Rectangle, error) {
+	pointerMask := uint16(xproto.EventMaskButtonPress | xproto.EventMaskButtonRelease | xproto.EventMaskPointerMotion)
+	grab, err := xproto.GrabPointer(conn, false, win, pointerMask,
+		xproto.GrabModeAsync, xproto.GrabModeAsync, xproto.WindowNone, cursor, xproto.TimeCurrentTime).Reply()
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("failed to grab pointer: %w", err)
+	}
+	if grab.Status != xproto.GrabStatusSuccess {
+		return image.Rectangle{}, fmt.Errorf("failed to grab pointer: status %d", grab.Status)
+	}
+	defer xproto.UngrabPointer(conn, xproto.TimeCurrentTime)
+
+	kbd, err := xproto.GrabKeyboard(conn, false, win, xproto.TimeCurrentTime,
+		xproto.GrabModeAsync, xproto.GrabModeAsync).Reply()
+	if err == nil && kbd.Status == xproto.GrabStatusSuccess {
+		defer xproto.UngrabKeyboard(conn, xproto.TimeCurrentTime)
+	}
+
+	var start image.Point
+	var band image.Rectangle
+	dragging := false
+	p.show(band)
+
+	for {
+		ev, xerr := conn.WaitForEvent()
+		if ev == nil && xerr == nil {
+			return image.Rectangle{}, fmt.Errorf("X connection closed during selection")
+		}
+		if xerr != nil {
+			continue
+		}
+
+		switch e := ev.(type) {
+		case xproto.ExposeEvent:
+			if e.Count == 0 {
+				p.show(band)
+			}
+		case xproto.KeyPressEvent:
+			return image.Rectangle{}, ErrSelectionCancelled
+		case xproto.ButtonPressEvent:
+			if e.Detail != xproto.ButtonIndex1 {
+				return image.Rectangle{}, ErrSelectionCancelled
+			}
+			start = image.Pt(int(e.RootX), int(e.RootY))
+			dragging = true
+		case xproto.MotionNotifyEvent:
+			if !dragging {
+				continue
+			}
+			band = image.Rectangle{Min: start, Max: image.Pt(int(e.RootX), int(e.RootY))}.Canon()
+			p.show(band)
+		case xproto.ButtonReleaseEvent:
+			if !dragging || e.Detail != xproto.ButtonIndex1 {
+				continue
+			}
+			end := image.Pt(int(e.RootX), int(e.RootY))
+			rect := image.Rectangle{Min: start, Max: end}.Canon()
+			if rect.Empty() {
+				return image.Rectangle{}, ErrSelectionCancelled
+			}
+			return rect, nil
+		}
+	}
+}
+
+// Overlay pixels are premultiplied ARGB.
+const (
+	overlayDim    = 0x80000000 // half-transparent black
+	overlayClear  = 0x00000000
+	overlayBorder = 0xffffffff
+)
+
+// overlayPainter dims the screen with an override-redirect window of a
+// 32-bit visual, leaving the selection clear with a white border.
+type overlayPainter struct {
+	conn *xgb.Conn
+	win  xproto.Window
+	cmap xproto.Colormap
+	gc   xproto.Gcontext
+	size image.Rectangle
+}
+
+func newOverlayPainter(conn *xgb.Conn, screen *xproto.ScreenInfo, visual xproto.VisualInfo) (*overlayPainter, error) {
+	p := &overlayPainter{
+		conn: conn,
+		size: image.Rect(0, 0, int(screen.WidthInPixels), int(screen.HeightInPixels)),
+	}
+
+	var err error
+	if p.cmap, err = xproto.NewColormapId(conn); err != nil {
+		return nil, err
+	}
+	if err := xproto.CreateColormapChecked(conn, xproto.ColormapAllocNone, p.cmap, screen.Root, visual.VisualId).Check(); err != nil {
+		return nil, fmt.Errorf("failed to create overlay colormap: %w", err)
+	}
+
+	if p.win, err = xproto.NewWindowId(conn); err != nil {
+		xproto.FreeColormap(conn, p.cmap)
+		return nil, err
+	}
+	// A window whose depth differs from its parent's must set its border
+	// pixel and colormap.
+	err = xproto.CreateWindowChecked(conn, 32, p.win, screen.Root,
+		0, 0, uint16(p.size.Dx()), uint16(p.size.Dy()), 0,
+		xproto.WindowClassInputOutput, visual.VisualId,
+		xproto.CwBackPixel|xproto.CwBorderPixel|xproto.CwOverrideRedirect|xproto.CwEventMask|xproto.CwColormap,
+		[]uint32{overlayDim, 0, 1, xproto.EventMaskExposure, uint32(p.cmap)}).Check()
+	if err != nil {
+		xproto.FreeColormap(conn, p.cmap)
+		return nil, fmt.Errorf("failed to create overlay window: %w", err)
+	}
+
+	if p.gc, err = xproto.NewGcontextId(conn); err == nil {
+		err = xproto.CreateGCChecked(conn, p.gc, xproto.Drawable(p.win),
+			xproto.GcForeground|xproto.GcLineWidth, []uint32{overlayDim, 1}).Check()
+	}
+	if err != nil {
+		xproto.DestroyWindow(conn, p.win)
+		xproto.FreeColormap(conn, p.cmap)
+		return nil, fmt.Errorf("failed to create graphics context: %w", err)
+	}
+
+	xproto.MapWindow(conn, p.win)
+	// The window must be viewable before the pointer can be grabbed on it.
+	xproto.GetInputFocus(conn).Reply()
+	return p, nil
+}
+
+func (p *overlayPainter) show(band image.Rectangle) {
+	band = band.Intersect(p.size)
+	w, h := p.size.Dx(), p.size.Dy()
+
+	dim := []image.Rectangle{p.size}
+	if !band.Empty() {
+		dim = []image.Rectangle{
+			image.Rect(0, 0, w, band.Min.Y),
+			image.Rect(0, band.Max.Y, w, h),
+			image.Rect(0, band.Min.Y, band.Min.X, band.Max.Y),
+			image.Rect(band.Max.X, band.Min.Y, w, band.Max.Y),
+		}
+	}
+	p.fill(overlayDim, dim...)
+
+	if !band.Empty() {
+		p.fill(overlayClear, band)
+		xproto.ChangeGC(p.conn, p.gc, xproto.GcForeground, []uint32{overlayBorder})
+		xproto.PolyRectangle(p.conn, xproto.Drawable(p.win), p.gc, []xproto.Rectangle{outline(band)})
+	}
+	p.conn.Sync()
+}
+
+func (p *overlayPainter) fill(pixel uint32, rects ...image.Rectangle) {
+	var xrects []xproto.Rectangle
+	for _, r := range rects {
+		if !r.Empty() {
+			xrects = append(xrects, xproto.Rectangle{
+				X: int16(r.Min.X), Y: int16(r.Min.Y), Width: uint16(r.Dx()), Height: uint16(r.Dy()),
+			})
+		}
+	}
+	if len(xrects) == 0 {
+		return
+	}
+	xproto.ChangeGC(p.conn, p.gc, xproto.GcForeground, []uint32{pixel})
+	xproto.PolyFillRectangle(p.conn, xproto.Drawable(p.win), p.gc, xrects)
+}
+
+// close removes the overlay and waits until the server has done so, so the
+// capture that follows cannot include it.
+func (p *overlayPainter) close() {
+	xproto.FreeGC(p.conn, p.gc)
+	xproto.DestroyWindow(p.conn, p.win)
+	xproto.FreeColormap(p.conn, p.cmap)
+	xproto.GetInputFocus(p.conn).Reply()
+}
+
+// xorPainter draws the band in XOR on the root window, so drawing it again
+// erases it.
+type xorPainter struct {
+	conn *xgb.Conn
+	root xproto.Window
+	gc   xproto.Gcontext
+	band image.Rectangle
+}
+
+func newXORPainter(conn *xgb.Conn, screen *xproto.ScreenInfo) (*xorPainter, error) {
+	gc, err := xproto.NewGcontextId(conn)
+	if err != nil {
+		return nil, err
+	}
+	err = xproto.CreateGCChecked(conn, gc, xproto.Drawable(screen.Root),
+		xproto.GcFunction|xproto.GcForeground|xproto.GcLineWidth|xproto.GcSubwindowMode,
+		[]uint32{xproto.GxXor, screen.WhitePixel ^ screen.BlackPixel, 1, xproto.SubwindowModeIncludeInferiors}).Check()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create graphics context: %w", err)
+	}
+	return &xorPainter{conn: conn, root: screen.Root, gc: gc}, nil
+}
+
+func (p *xorPainter) show(band image.Rectangle) {
+	if band == p.band {
+		return
+	}
+	p.draw(p.band)
+	p.band = band
+	p.draw(p.band)
+	p.conn.Sync()
+}
+
+func (p *xorPainter) draw(r image.Rectangle) {
+	if r.Empty() {
+		return
+	}
+	xproto.PolyRectangle(p.conn, xproto.Drawable(p.root), p.gc, []xproto.Rectangle{outline(r)})
+}
+
+func (p *xorPainter) close() {
+	p.draw(p.band)
+	xproto.FreeGC(p.conn, p.gc)
+	p.conn.Sync()
+}
+
+// outline is the rectangle PolyRectangle draws just inside r.
+func outline(r image.Rectangle) xproto.Rectangle {
+	return xproto.Rectangle{
+		X: int16(r.Min.X), Y: int16(r.Min.Y),
+		Width: uint16(r.Dx() - 1), Height: uint16(r.Dy() - 1),
+	}
+}
+
+// argbVisual finds a 32-bit TrueColor visual with an alpha channel.
+func argbVisual(screen *xproto.ScreenInfo) (xproto.VisualInfo, bool) {
+	for _, depth := range screen.AllowedDepths {
+		if depth.Depth != 32 {
+			continue
+		}
+		for _, v := range depth.Visuals {
+			if v.Class == xproto.VisualClassTrueColor &&
+				v.RedMask == 0xff0000 && v.GreenMask == 0xff00 && v.BlueMask == 0xff {
+				return v, true
+			}
+		}
+	}
+	return xproto.VisualInfo{}, false
+}
+
+// compositing reports whether a compositing manager runs on the default
+// screen, which it announces by owning the _NET_WM_CM_Sn selection.
+func compositing(conn *xgb.Conn) bool {
+	atom, err := internAtom(conn, fmt.Sprintf("_NET_WM_CM_S%d", conn.DefaultScreen))
+	if err != nil || atom == xproto.AtomNone {
+		return false
+	}
+	reply, err := xproto.GetSelectionOwner(conn, atom).Reply()
+	return err == nil && reply.Owner != xproto.WindowNone
+}
+
+func createCrosshairCursor(conn *xgb.Conn) (xproto.Cursor, error) {
+	font, err := xproto.NewFontId(conn)
+	if err != nil {
+		return 0, err
+	}
+	const fontName = "cursor"
+	if err := xproto.OpenFontChecked(conn, font, uint16(len(fontName)), fontName).Check(); err != nil {
+		return 0, fmt.Errorf("failed to open cursor font: %w", err)
+	}
+	defer xproto.CloseFont(conn, font)
+
+	cursor, err := xproto.NewCursorId(conn)
+	if err != nil {
+		return 0, err
+	}
+	err = xproto.CreateGlyphCursorChecked(conn, cursor, font, font, xcCrosshair, xcCrosshair+1,
+		0, 0, 0, 0xffff, 0xffff, 0xffff).Check()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create cursor: %w", err)
+	}
+	return cursor, nil
+}
@@ -0,0 +1,275 @@
+//go:build windows
+
+package capture
+
+import (
+	"fmt"
+	"image"
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	WS_POPUP         = 0x80000000
+	WS_EX_TOPMOST    = 0x00000008
+	WS_EX_TOOLWINDOW = 0x00000080
+	WS_EX_LAYERED    = 0x00080000
+
+	WM_DESTROY     = 0x0002
+	WM_PAINT       = 0x000F
+	WM_ERASEBKGND  = 0x0014
+	WM_KEYDOWN     = 0x0100
+	WM_MOUSEMOVE   = 0x0200
+	WM_LBUTTONDOWN = 0x0201
+	WM_LBUTTONUP   = 0x0202
+	WM_RBUTTONUP   = 0x0205
+
+	SM_XVIRTUALSCREEN  = 76
+	SM_YVIRTUALSCREEN  = 77
+	SM_CXVIRTUALSCREEN = 78
+	SM_CYVIRTUALSCREEN = 79
+
+	LWA_COLORKEY = 0x1
+	LWA_ALPHA    = 0x2
+
+	SW_SHOW    = 5
+	IDC_CROSS  = 32515
+	VK_ESCAPE  = 0x1B
+	overlayKey = 0x00FF00FF // magenta, made fully transparent
+)
+
+var (
+	gdi32 = windows.NewLazySystemDLL("gdi32.dll")
+
+	procGetModuleHandle            = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetModuleHandleW")
+	procRegisterClassEx            = user32.NewProc("RegisterClassExW")
+	procCreateWindowEx             = user32.NewProc("CreateWindowExW")
+	procDestroyWindow              = user32.NewProc("DestroyWindow")
+	procDefWindowProc              = user32.NewProc("DefWindowProcW")
+	procShowWindow                 = user32.NewProc("ShowWindow")
+	procSetForegroundWindow        = user32.NewProc("SetForegroundWindow")
+	procSetLayeredWindowAttributes = user32.NewProc("SetLayeredWindowAttributes")
+	procGetSystemMetrics           = user32.NewProc("GetSystemMetrics")
+	procLoadCursor                 = user32.NewProc("LoadCursorW")
+	procSetCapture                 = user32.NewProc("SetCapture")
+	procReleaseCapture             = user32.NewProc("ReleaseCapture")
+	procInvalidateRect             = user32.NewProc("InvalidateRect")
+	procBeginPaint                 = user32.NewProc("BeginPaint")
+	procEndPaint                   = user32.NewProc("EndPaint")
+	procFillRect                   = user32.NewProc("FillRect")
+	procGetMessage                 = user32.NewProc("GetMessageW")
+	procTranslateMessage           = user32.NewProc("TranslateMessage")
+	procDispatchMessage            = user32.NewProc("DispatchMessageW")
+	procPostQuitMessage            = user32.NewProc("PostQuitMessage")
+	procCreateSolidBrush           = gdi32.NewProc("CreateSolidBrush")
+	procDeleteObject               = gdi32.NewProc("DeleteObject")
+)
+
+type RECT struct {
+	Left, Top, Right, Bottom int32
+}
+
+type MSG struct {
+	HWND    uintptr
+	Message uint32
+	WParam  uintptr
+	LParam  uintptr
+	Time    uint32
+	Pt      POINT
+}
+
+type PAINTSTRUCT struct {
+	HDC         uintptr
+	Erase       int32
+	Paint       RECT
+	Restore     int32
+	IncUpdate   int32
+	RGBReserved [32]byte
+}
+
+type WNDCLASSEX struct {
+	Size       uint32
+	Style      uint32
+	WndProc    uintptr
+	ClsExtra   int32
+	WndExtra   int32
+	Instance   uintptr
+	Icon       uintptr
+	Cursor     uintptr
+	Background uintptr
+	MenuName   *uint16
+	ClassName  *uint16
+	IconSm     uintptr
+}
+
+// overlay holds the state of the one selection window that can exist at a
+// time. It is only touched from the overlay's own locked thread.
+var (
+	overlay struct {
+		origin   image.Point
+		start    image.Point
+		current  image.Point
+		dragging bool
+		result   image.Rectangle
+		err      error
+	}
+	overlayMutex     sync.Mutex
+	overlayClassOnce sync.Once
+	overlayClassErr  error
+	overlayClassName = windows.StringToUTF16Ptr("SnapHookRegionOverlay")
+)
+
+func registerOverlayClass() error {
+	overlayClassOnce.Do(func() {
+		instance, _, _ := procGetModuleHandle.Call(0)
+		cursor, _, _ := procLoadCursor.Call(0, IDC_CROSS)
+		wc := WNDCLASSEX{
+			WndProc:   windows.NewCallback(overlayWndProc),
+			Instance:  instance,
+			Cursor:    cursor,
+			ClassName: overlayClassName,
+		}
+		wc.Size = uint32(unsafe.Sizeof(wc))
+		if ret, _, err := procRegisterClassEx.Call(uintptr(unsafe.Pointer(&wc))); ret == 0 {
+			overlayClassErr = fmt.Errorf("failed to register overlay class: %v", err)
+		}
+	})
+	return overlayClassErr
+}
+
+// SelectRegion covers the virtual desktop with a dimmed, topmost window and
+// lets the user drag a rectangle. Escape or the right button cancels.
+func (windowsBackend) SelectRegion() (image.Rectangle, error) {
+	overlayMutex.Lock()
+	defer overlayMutex.Unlock()
+
+	if err := registerOverlayClass(); err != nil {
+		return image.Rectangle{}, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		runOverlay()
+	}()
+	<-done
+
+	return overlay.result, overlay.err
+}
+
+func runOverlay() {
+	x, _, _ := procGetSystemMetrics.Call(SM_XVIRTUALSCREEN)
+	y, _, _ := procGetSystemMetrics.Call(SM_YVIRTUALSCREEN)
+	w, _, _ := procGetSystemMetrics.Call(SM_CXVIRTUALSCREEN)
+	h, _, _ := procGetSystemMetrics.Call(SM_CYVIRTUALSCREEN)
+
+	overlay.origin = image.Pt(int(int32(x)), int(int32(y)))
+	overlay.dragging = false
+	overlay.result = image.Rectangle{}
+	overlay.err = ErrSelectionCancelled
+
+	instance, _, _ := procGetModuleHandle.Call(0)
+	hwnd, _, err := procCreateWindowEx.Call(
+		WS_EX_TOPMOST|WS_EX_TOOLWINDOW|WS_EX_LAYERED,
+		uintptr(unsafe.Pointer(overlayClassName)),
+		0,
+		WS_POPUP,
+		x, y, w, h,
+		0, 0, instance, 0,
+	)
+	if hwnd == 0 {
+		overlay.err = fmt.Errorf("failed to create overlay window: %v", err)
+		return
+	}
+
+	procSetLayeredWindowAttributes.Call(hwnd, overlayKey, 96, LWA_COLORKEY|LWA_ALPHA)
+	procShowWindow.Call(hwnd, SW_SHOW)
+	procSetForegroundWindow.Call(hwnd)
+
+	msg := &MSG{}
+	for {
+		ret, _, _ := procGetMessage.Call(uintptr(unsafe.Pointer(msg)), 0, 0, 0)
+		if ret == 0 || int32(ret) == -1 {
+			return
+		}
+		procTranslateMessage.Call(uintptr(unsafe.Pointer(msg)))
+		procDispatchMessage.Call(uintptr(unsafe.Pointer(msg)))
+	}
+}
+
+func overlayWndProc(hwnd, msg, wParam, lParam uintptr) uintptr {
+	pt := image.Pt(int(int16(lParam&0xFFFF)), int(int16((lParam>>16)&0xFFFF)))
+
+	switch msg {
+	case WM_LBUTTONDOWN:
+		overlay.start = pt
+		overlay.current = pt
+		overlay.dragging = true
+		procSetCapture.Call(hwnd)
+		return 0
+	case WM_MOUSEMOVE:
+		if overlay.dragging {
+			overlay.current = pt
+			procInvalidateRect.Call(hwnd, 0, 0)
+		}
+		return 0
+	case WM_LBUTTONUP:
+		if overlay.dragging {
+			overlay.dragging = false
+			procReleaseCapture.Call()
+			rect := image.Rectangle{Min: overlay.start, Max: pt}.Canon()
+			if !rect.Empty() {
+				overlay.result = rect.Add(overlay.origin)
+				overlay.err = nil
+			}
+			procDestroyWindow.Call(hwnd)
+		}
+		return 0
+	case WM_RBUTTONUP:
+		procDestroyWindow.Call(hwnd)
+		return 0
+	case WM_KEYDOWN:
+		if wParam == VK_ESCAPE {
+			procDestroyWindow.Call(hwnd)
+		}
+		return 0
+	case WM_ERASEBKGND:
+		return 1
+	case WM_PAINT:
+		paintOverlay(hwnd)
+		return 0
+	case WM_DESTROY:
+		procPostQuitMessage.Call(0)
+		return 0
+	}
+
+	ret, _, _ := procDefWindowProc.Call(hwnd, msg, wParam, lParam)
+	return ret
+}
+
+// paintOverlay dims the whole window and punches the selection out with the
+// colour key, so the area being captured shows through undimmed.
+func paintOverlay(hwnd uintptr) {
+	var ps PAINTSTRUCT
+	hdc, _, _ := procBeginPaint.Call(hwnd, uintptr(unsafe.Pointer(&ps)))
+	defer procEndPaint.Call(hwnd, uintptr(unsafe.Pointer(&ps)))
+
+	dim, _, _ := procCreateSolidBrush.Call(0)
+	defer procDeleteObject.Call(dim)
+	procFillRect.Call(hdc, uintptr(unsafe.Pointer(&ps.Paint)), dim)
+
+	if !overlay.dragging {
+		return
+	}
+
+	sel := image.Rectangle{Min: overlay.start, Max: overlay.current}.Canon()
+	rc := RECT{Left: int32(sel.Min.X), Top: int32(sel.Min.Y), Right: int32(sel.Max.X), Bottom: int32(sel.Max.Y)}
+	hole, _, _ := procCreateSolidBrush.Call(overlayKey)
+	defer procDeleteObject.Call(hole)
+	procFillRect.Call(hdc, uintptr(unsafe.Pointer(&rc)), hole)
+}
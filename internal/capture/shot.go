@@ -0,0 +1,385 @@
+package capture
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"snaphook/internal/captureid"
+	"snaphook/internal/imageformat"
+	"snaphook/internal/nametemplate"
+	"snaphook/internal/phash"
+)
+
+// Shot is one captured image on its way to the sinks (clipboard, preview,
+// auto-save). It stays in memory; each format is encoded at most once, on
+// the first request, and shared, and a file is written only when a sink asks
+// for one. Once the sinks are done, Compact drops the pixels of a shot that
+// is kept around.
+type Shot struct {
+	// ID names the shot in preview URLs and the capture history; see
+	// package captureid.
+	ID string
+	// Image is nil once the shot has been compacted.
+	Image *image.RGBA
+	Time  time.Time
+	Mode  Mode
+	// Display is the index of the display the shot came from, or -1 when
+	// it spans several displays.
+	Display int
+	// Bounds is the captured rectangle in virtual desktop coordinates.
+	Bounds image.Rectangle
+
+	mu          sync.Mutex
+	encoded     map[imageformat.Format][]byte
+	tempPaths   map[imageformat.Format]string
+	savedPath   string
+	savedFormat imageformat.Format
+	hash        string
+	phash       phash.Hash
+	phashDone   bool
+	pinned      bool
+}
+
+func newShot(img *image.RGBA, display int, bounds image.Rectangle) *Shot {
+	now := time.Now()
+	return &Shot{
+		ID:        captureid.New(now),
+		Image:     img,
+		Time:      now,
+		Display:   display,
+		Bounds:    bounds,
+		encoded:   map[imageformat.Format][]byte{},
+		tempPaths: map[imageformat.Format]string{},
+	}
+}
+
+// PNG returns the image as a fast PNG, the form the clipboard always offers.
+func (s *Shot) PNG() ([]byte, error) {
+	return s.Encode(imageformat.Default)
+}
+
+// Encode returns the image in format f. Concurrent callers share one
+// encoding pass per format.
+func (s *Shot) Encode(f imageformat.Format) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encodeLocked(f)
+}
+
+func (s *Shot) encodeLocked(f imageformat.Format) ([]byte, error) {
+	if data, ok := s.encoded[f]; ok {
+		return data, nil
+	}
+
+	var img image.Image = s.Image
+	if s.Image == nil {
+		// Compacted: the encoding that was kept is all that is left.
+		var err error
+		if img, err = s.decodeKeptLocked(); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := f.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode image as %s: %w", f, err)
+	}
+	s.encoded[f] = buf.Bytes()
+	return s.encoded[f], nil
+}
+
+// decodeKeptLocked decodes a lossless encoding kept by Compact.
+func (s *Shot) decodeKeptLocked() (image.Image, error) {
+	for f, data := range s.encoded {
+		if !f.Lossless() {
+			continue
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the kept %s: %w", f, err)
+		}
+		return img, nil
+	}
+	return nil, errors.New("shot has neither pixels nor a lossless encoding")
+}
+
+// Compact encodes the shot in keep and computes its hashes, then drops the
+// pixels and every other encoding, so a shot held after the sinks are done
+// with it costs only its encoded size. When keep is lossy, a fast PNG is
+// kept too, and other formats requested later are re-encoded from that
+// rather than from lossy pixels.
+func (s *Shot) Compact(keep imageformat.Format) error {
+	s.Hash()
+	s.PerceptualHash()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := map[imageformat.Format][]byte{}
+	formats := []imageformat.Format{keep}
+	if !keep.Lossless() {
+		formats = append(formats, imageformat.Default)
+	}
+	for _, f := range formats {
+		data, err := s.encodeLocked(f)
+		if err != nil {
+			return err
+		}
+		kept[f] = data
+	}
+	s.encoded = kept
+	s.Image = nil
+	return nil
+}
+
+// Size returns the bytes the shot holds in memory: its pixels, until it is
+// compacted, and its encodings.
+func (s *Shot) Size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	if s.Image != nil {
+		n = len(s.Image.Pix)
+	}
+	for _, data := range s.encoded {
+		n += len(data)
+	}
+	return n
+}
+
+// Hash returns the hex SHA-256 of the shot's pixels, which identifies the
+// content whatever format it is saved in.
+func (s *Shot) Hash() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hash == "" {
+		h := sha256.New()
+		b := s.Image.Rect
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			i := s.Image.PixOffset(b.Min.X, y)
+			h.Write(s.Image.Pix[i : i+b.Dx()*4])
+		}
+		s.hash = hex.EncodeToString(h.Sum(nil))
+	}
+	return s.hash
+}
+
+// PerceptualHash returns the shot's difference hash, which is close to that
+// of any near-identical shot.
+func (s *Shot) PerceptualHash() phash.Hash {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.phashDone {
+		s.phash = phash.DHash(s.Image)
+		s.phashDone = true
+	}
+	return s.phash
+}
+
+// File returns a file holding the shot in format f: the auto-saved copy if
+// it was saved in that format, otherwise a temp file written on the first
+// call.
+func (s *Shot) File(f imageformat.Format) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.savedPath != "" && s.savedFormat == f {
+		return s.savedPath, nil
+	}
+	// The janitor may have deleted an old temp file; write it again.
+	if path, ok := s.tempPaths[f]; ok {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	data, err := s.encodeLocked(f)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(os.TempDir(), "snapview-"+s.ID+f.Ext())
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to create image file: %w", err)
+	}
+	s.tempPaths[f] = path
+	return path, nil
+}
+
+// AutoSave writes the shot to the auto-save directory in the auto-save
+// format when auto-save is enabled and returns the path, or "" when it is
+// disabled.
+func (s *Shot) AutoSave() (string, error) {
+	enabled, saveDir, format, tmpl := getAutoSaveConfig()
+	if !enabled || saveDir == "" {
+		return "", nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.savedPath != "" {
+		return s.savedPath, nil
+	}
+
+	data, err := s.encodeLocked(format)
+	if err != nil {
+		return "", err
+	}
+
+	vars := nametemplate.Vars{
+		Time:    s.Time,
+		Mode:    string(s.Mode),
+		Monitor: s.Display,
+		Host:    hostname(),
+		Ext:     strings.TrimPrefix(format.Ext(), "."),
+	}
+	file, path, err := createUnique(saveDir, tmpl, vars)
+	if err != nil {
+		return "", fmt.Errorf("failed to save screenshot: %w", err)
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to save screenshot: %w", err)
+	}
+	s.savedPath = path
+	s.savedFormat = format
+	return path, nil
+}
+
+// createUnique creates the file tmpl names under dir with the sequence
+// number after the highest one already used for the name, found with one
+// scan. O_EXCL makes the check and the create one step, so a concurrent save
+// that takes the same number just moves this one to the next.
+func createUnique(dir string, tmpl *nametemplate.Template, vars nametemplate.Vars) (*os.File, string, error) {
+	for seq := nextSequence(dir, tmpl, vars); ; seq++ {
+		rel := tmpl.Expand(vars, seq)
+		if rel == "" {
+			return nil, "", fmt.Errorf("filename template %q expands to an empty name", tmpl)
+		}
+
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, "", err
+		}
+
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return file, path, nil
+	}
+}
+
+// nextSequence returns one more than the highest sequence number of the
+// files tmpl names under dir for vars, or 1 if there are none.
+func nextSequence(dir string, tmpl *nametemplate.Template, vars nametemplate.Vars) int {
+	matches, _ := filepath.Glob(filepath.Join(dir, filepath.FromSlash(tmpl.Glob(vars))))
+	next := 1
+	for _, match := range matches {
+		rel, err := filepath.Rel(dir, match)
+		if err != nil {
+			continue
+		}
+		if seq, ok := tmpl.Match(vars, filepath.ToSlash(rel)); ok && seq >= next {
+			next = seq + 1
+		}
+	}
+	return next
+}
+
+var (
+	hostnameOnce  sync.Once
+	hostnameValue string
+)
+
+func hostname() string {
+	hostnameOnce.Do(func() {
+		hostnameValue, _ = os.Hostname()
+	})
+	return hostnameValue
+}
+
+// Release deletes the shot's temp files, if any were written, and unpins
+// it. Auto-saved files are kept.
+func (s *Shot) Release() error {
+	s.SetPinned(false)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for f, path := range s.tempPaths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+		delete(s.tempPaths, f)
+	}
+	return errors.Join(errs...)
+}
+
+// SetPinned pins or unpins the shot. CleanupTempFiles keeps the temp files
+// of pinned shots.
+func (s *Shot) SetPinned(pinned bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pinned = pinned
+
+	pinnedMutex.Lock()
+	defer pinnedMutex.Unlock()
+	if pinned {
+		pinnedShots[s] = struct{}{}
+	} else {
+		delete(pinnedShots, s)
+	}
+}
+
+// Pinned reports whether the shot is pinned.
+func (s *Shot) Pinned() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pinned
+}
+
+var (
+	pinnedShots = map[*Shot]struct{}{}
+	pinnedMutex sync.Mutex
+)
+
+func pinnedTempPaths() map[string]bool {
+	pinnedMutex.Lock()
+	shots := make([]*Shot, 0, len(pinnedShots))
+	for s := range pinnedShots {
+		shots = append(shots, s)
+	}
+	pinnedMutex.Unlock()
+
+	paths := map[string]bool{}
+	for _, s := range shots {
+		s.mu.Lock()
+		for _, path := range s.tempPaths {
+			paths[path] = true
+		}
+		s.mu.Unlock()
+	}
+	return paths
+}
@@ -0,0 +1,199 @@
+package capture
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"snaphook/internal/imageformat"
+	"snaphook/internal/nametemplate"
+)
+
+func testImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	return img
+}
+
+func TestShotCompact(t *testing.T) {
+	img := testImage()
+	shot := newShot(img, 0, img.Rect)
+	hash, phash := shot.Hash(), shot.PerceptualHash()
+
+	jpeg, err := imageformat.Parse("jpeg", "", 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shot.Encode(jpeg); err != nil {
+		t.Fatal(err)
+	}
+	before := shot.Size()
+
+	if err := shot.Compact(imageformat.Default); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if shot.Image != nil {
+		t.Error("Compact kept the pixels")
+	}
+	if after := shot.Size(); after >= before || after >= len(img.Pix) {
+		t.Errorf("Size = %d after compacting, was %d with %d bytes of pixels", after, before, len(img.Pix))
+	}
+	if shot.Hash() != hash || shot.PerceptualHash() != phash {
+		t.Error("hashes changed after compacting")
+	}
+
+	// The kept PNG is lossless, so it still decodes to the captured pixels.
+	data, err := shot.PNG()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := color.RGBAModel.Convert(decoded.At(10, 20)), img.RGBAAt(10, 20); got != want {
+		t.Errorf("pixel = %v, want %v", got, want)
+	}
+
+	// Formats dropped by Compact are encoded again from the one kept.
+	if data, err := shot.Encode(jpeg); err != nil || len(data) == 0 {
+		t.Errorf("Encode(jpeg) after compacting = %d bytes, %v", len(data), err)
+	}
+}
+
+// A shot compacted to a lossy preview must still export its exact pixels.
+func TestShotCompactLossyKeepsPixels(t *testing.T) {
+	img := testImage()
+	shot := newShot(img, 0, img.Rect)
+
+	jpeg, err := imageformat.Parse("jpeg", "", 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shot.Compact(jpeg); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	best, err := imageformat.Parse("png", "best", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := shot.Encode(best)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if got, want := color.RGBAModel.Convert(decoded.At(x, y)), img.RGBAAt(x, y); got != want {
+				t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+// Shots split from one capture share a timestamp; their temp files must
+// not.
+func TestShotFileNamesAreUnique(t *testing.T) {
+	img := testImage()
+	a := newShot(img, 0, img.Rect)
+	b := newShot(img, 1, img.Rect)
+	b.Time = a.Time
+	t.Cleanup(func() {
+		a.Release()
+		b.Release()
+	})
+
+	pathA, err := a.File(imageformat.Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pathB, err := b.File(imageformat.Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pathA == pathB {
+		t.Errorf("both shots were written to %s", pathA)
+	}
+}
+
+// A shot compacted to QOI must decode it again for other formats.
+func TestShotCompactQOI(t *testing.T) {
+	img := testImage()
+	shot := newShot(img, 0, img.Rect)
+
+	qoi, err := imageformat.Parse("qoi", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shot.Compact(qoi); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	data, err := shot.PNG()
+	if err != nil {
+		t.Fatalf("PNG after compacting to QOI: %v", err)
+	}
+	decoded, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := color.RGBAModel.Convert(decoded.At(10, 20)), img.RGBAAt(10, 20); got != want {
+		t.Errorf("pixel = %v, want %v", got, want)
+	}
+}
+
+func TestCreateUniqueContinuesSequence(t *testing.T) {
+	vars := nametemplate.Vars{Time: time.Date(2026, 3, 7, 9, 5, 4, 0, time.UTC), Ext: "png"}
+	tests := []struct {
+		tmpl     string
+		existing []string
+		want     string
+	}{
+		{"shot", nil, "shot.png"},
+		{"shot", []string{"shot.png"}, "shot_2.png"},
+		{"shot", []string{"shot.png", "shot_5.png", "other_9.png"}, "shot_6.png"},
+		{"{date}/{seq:3}", []string{"2026-03-07/001.png", "2026-03-07/002.png"}, "2026-03-07/003.png"},
+		// There is no cap on the sequence number.
+		{"run-{seq}", []string{"run-10000.png"}, "run-10001.png"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		for _, name := range tt.existing {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tmpl, err := nametemplate.Parse(tt.tmpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file, path, err := createUnique(dir, tmpl, vars)
+		if err != nil {
+			t.Errorf("%q: createUnique: %v", tt.tmpl, err)
+			continue
+		}
+		file.Close()
+		if want := filepath.Join(dir, filepath.FromSlash(tt.want)); path != want {
+			t.Errorf("%q with %v: created %s, want %s", tt.tmpl, tt.existing, path, want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package capture
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	gapColor       color.Color = color.Black
+	splitDisplays  bool
+	stitchSetMutex sync.RWMutex
+)
+
+// SetAllDisplaysOptions configures ModeAllDisplays. gap fills the parts of
+// the virtual desktop no display covers; split writes one file per display
+// instead of a single stitched image.
+func SetAllDisplaysOptions(gap color.Color, split bool) {
+	stitchSetMutex.Lock()
+	defer stitchSetMutex.Unlock()
+	if gap == nil {
+		gap = color.Black
+	}
+	gapColor = gap
+	splitDisplays = split
+}
+
+func getAllDisplaysOptions() (color.Color, bool) {
+	stitchSetMutex.RLock()
+	defer stitchSetMutex.RUnlock()
+	return gapColor, splitDisplays
+}
+
+// CaptureAllDisplays captures every display in one capture event. Depending on
+// SetAllDisplaysOptions it returns a single stitched image covering the
+// union of all display bounds, or one shot per display in display order.
+func CaptureAllDisplays() ([]*Shot, error) {
+	b := getBackend()
+	displays, err := getDisplays(b)
+	if err != nil {
+		return nil, err
+	}
+
+	gap, split := getAllDisplaysOptions()
+
+	images := make([]*image.RGBA, len(displays))
+	for i, bounds := range displays {
+		img, err := b.CaptureRect(bounds)
+		if err != nil {
+			return nil, fmt.Errorf("screenshot capture of display %d failed: %w", i, err)
+		}
+		images[i] = img
+	}
+
+	if split {
+		shots := make([]*Shot, 0, len(images))
+		for i, img := range images {
+			shot := newShot(img, i, displays[i])
+			shot.Mode = ModeAllDisplays
+			shots = append(shots, shot)
+		}
+		return shots, nil
+	}
+
+	canvas, union := stitch(displays, images, gap)
+	shot := newShot(canvas, -1, union)
+	shot.Mode = ModeAllDisplays
+	return []*Shot{shot}, nil
+}
+
+// stitch places each image at its display's offset within the union of all
+// display bounds, and returns the canvas along with that union.
+func stitch(displays []image.Rectangle, images []*image.RGBA, gap color.Color) (*image.RGBA, image.Rectangle) {
+	var union image.Rectangle
+	for _, bounds := range displays {
+		union = union.Union(bounds)
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, union.Dx(), union.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(gap), image.Point{}, draw.Src)
+
+	for i, img := range images {
+		dst := displays[i].Sub(union.Min)
+		draw.Draw(canvas, dst, img, img.Bounds().Min, draw.Src)
+	}
+
+	return canvas, union
+}
+
+// ParseColor parses a CSS-style hex colour, "#rgb" or "#rrggbb".
+func ParseColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid colour: %q", s)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid colour: %q", s)
+	}
+
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
@@ -0,0 +1,59 @@
+package capture
+
+import (
+	"fmt"
+	"image"
+	"sync"
+)
+
+// WindowOptions controls how much of the active window ModeWindow captures.
+// IncludeFrame adds the title bar and borders; IncludeShadow additionally
+// keeps the drop shadow some window managers draw around the frame.
+type WindowOptions struct {
+	IncludeFrame  bool
+	IncludeShadow bool
+}
+
+// WindowLocator is implemented by backends that can find the focused window.
+// The result is in virtual desktop coordinates.
+type WindowLocator interface {
+	ActiveWindowBounds(opts WindowOptions) (image.Rectangle, error)
+}
+
+var (
+	windowOptions      = WindowOptions{IncludeFrame: true}
+	windowOptionsMutex sync.RWMutex
+)
+
+func SetWindowOptions(opts WindowOptions) {
+	windowOptionsMutex.Lock()
+	defer windowOptionsMutex.Unlock()
+	windowOptions = opts
+}
+
+func getWindowOptions() WindowOptions {
+	windowOptionsMutex.RLock()
+	defer windowOptionsMutex.RUnlock()
+	return windowOptions
+}
+
+// CaptureActiveWindow captures the focused window's rectangle.
+func CaptureActiveWindow() (*Shot, error) {
+	b := getBackend()
+	locator, ok := b.(WindowLocator)
+	if !ok {
+		return nil, fmt.Errorf("window capture is not supported on this platform")
+	}
+
+	rect, err := locator.ActiveWindowBounds(getWindowOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate active window: %w", err)
+	}
+
+	shot, err := CaptureRegion(rect)
+	if err != nil {
+		return nil, err
+	}
+	shot.Mode = ModeWindow
+	return shot, nil
+}
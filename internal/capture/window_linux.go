@@ -0,0 +1,122 @@
+//go:build linux
+
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// ActiveWindowBounds reads _NET_ACTIVE_WINDOW from the root window and
+// adjusts the client geometry by _GTK_FRAME_EXTENTS (client-side shadows)
+// and _NET_FRAME_EXTENTS (window manager decorations).
+func (b *x11Backend) ActiveWindowBounds(opts WindowOptions) (image.Rectangle, error) {
+	var rect image.Rectangle
+	err := b.withX11(func(conn *xgb.Conn, screen *xproto.ScreenInfo) error {
+		active, err := getActiveWindow(conn, screen.Root)
+		if err != nil {
+			return err
+		}
+
+		rect, err = getWindowRect(conn, screen.Root, active)
+		if err != nil {
+			return err
+		}
+
+		if !opts.IncludeShadow {
+			if ext, ok := getFrameExtents(conn, active, "_GTK_FRAME_EXTENTS"); ok {
+				rect = shrink(rect, ext)
+			}
+		}
+		if opts.IncludeFrame {
+			if ext, ok := getFrameExtents(conn, active, "_NET_FRAME_EXTENTS"); ok {
+				rect = grow(rect, ext)
+			}
+		}
+		return nil
+	})
+	return rect, err
+}
+
+func internAtom(conn *xgb.Conn, name string) (xproto.Atom, error) {
+	reply, err := xproto.InternAtom(conn, true, uint16(len(name)), name).Reply()
+	if err != nil {
+		return 0, err
+	}
+	return reply.Atom, nil
+}
+
+// getCardinals reads a 32-bit property as a list of values.
+func getCardinals(conn *xgb.Conn, win xproto.Window, name string, typ xproto.Atom) ([]uint32, error) {
+	atom, err := internAtom(conn, name)
+	if err != nil {
+		return nil, err
+	}
+	if atom == xproto.AtomNone {
+		return nil, fmt.Errorf("%s is not supported by the window manager", name)
+	}
+
+	reply, err := xproto.GetProperty(conn, false, win, atom, typ, 0, 16).Reply()
+	if err != nil {
+		return nil, err
+	}
+	if reply.Format != 32 {
+		return nil, fmt.Errorf("%s is not set", name)
+	}
+
+	values := make([]uint32, reply.ValueLen)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint32(reply.Value[i*4:])
+	}
+	return values, nil
+}
+
+func getActiveWindow(conn *xgb.Conn, root xproto.Window) (xproto.Window, error) {
+	values, err := getCardinals(conn, root, "_NET_ACTIVE_WINDOW", xproto.AtomWindow)
+	if err != nil {
+		return 0, err
+	}
+	if len(values) == 0 || values[0] == 0 {
+		return 0, fmt.Errorf("no window has focus")
+	}
+	return xproto.Window(values[0]), nil
+}
+
+func getWindowRect(conn *xgb.Conn, root, win xproto.Window) (image.Rectangle, error) {
+	geom, err := xproto.GetGeometry(conn, xproto.Drawable(win)).Reply()
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+
+	pos, err := xproto.TranslateCoordinates(conn, win, root, 0, 0).Reply()
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+
+	x, y := int(pos.DstX), int(pos.DstY)
+	return image.Rect(x, y, x+int(geom.Width), y+int(geom.Height)), nil
+}
+
+// frameExtents are left, right, top and bottom widths, in the order the
+// _NET_FRAME_EXTENTS and _GTK_FRAME_EXTENTS properties store them.
+type frameExtents [4]int
+
+func getFrameExtents(conn *xgb.Conn, win xproto.Window, name string) (frameExtents, bool) {
+	values, err := getCardinals(conn, win, name, xproto.AtomCardinal)
+	if err != nil || len(values) != 4 {
+		return frameExtents{}, false
+	}
+	return frameExtents{int(values[0]), int(values[1]), int(values[2]), int(values[3])}, true
+}
+
+func grow(r image.Rectangle, ext frameExtents) image.Rectangle {
+	return image.Rect(r.Min.X-ext[0], r.Min.Y-ext[2], r.Max.X+ext[1], r.Max.Y+ext[3])
+}
+
+func shrink(r image.Rectangle, ext frameExtents) image.Rectangle {
+	return image.Rect(r.Min.X+ext[0], r.Min.Y+ext[2], r.Max.X-ext[1], r.Max.Y-ext[3])
+}
@@ -0,0 +1,140 @@
+//go:build linux
+
+package capture
+
+import (
+	"image"
+	"testing"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// fakeWM plays a reparenting window manager: it wraps a client window in a
+// frame, sets the frame extents on the client and marks it active.
+type fakeWM struct {
+	conn   *xgb.Conn
+	root   xproto.Window
+	client xproto.Window
+}
+
+func newFakeWM(t *testing.T, frame image.Rectangle, client image.Rectangle) *fakeWM {
+	t.Helper()
+	conn, screen := connectX11(t)
+	wm := &fakeWM{conn: conn, root: screen.Root}
+
+	frameWin := wm.createWindow(t, screen.Root, frame)
+	wm.client = wm.createWindow(t, frameWin, client.Sub(frame.Min))
+
+	wm.setCardinals(t, screen.Root, "_NET_ACTIVE_WINDOW", xproto.AtomWindow, uint32(wm.client))
+	t.Cleanup(func() {
+		atom := wm.atom(t, "_NET_ACTIVE_WINDOW")
+		xproto.DeleteProperty(conn, screen.Root, atom)
+		wm.sync(t)
+	})
+	return wm
+}
+
+func (wm *fakeWM) createWindow(t *testing.T, parent xproto.Window, r image.Rectangle) xproto.Window {
+	t.Helper()
+	win, err := xproto.NewWindowId(wm.conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = xproto.CreateWindowChecked(wm.conn, 0, win, parent,
+		int16(r.Min.X), int16(r.Min.Y), uint16(r.Dx()), uint16(r.Dy()), 0,
+		xproto.WindowClassInputOutput, 0, xproto.CwOverrideRedirect, []uint32{1}).Check()
+	if err != nil {
+		t.Fatalf("CreateWindow: %v", err)
+	}
+	t.Cleanup(func() { xproto.DestroyWindow(wm.conn, win) })
+	if err := xproto.MapWindowChecked(wm.conn, win).Check(); err != nil {
+		t.Fatalf("MapWindow: %v", err)
+	}
+	return win
+}
+
+func (wm *fakeWM) atom(t *testing.T, name string) xproto.Atom {
+	t.Helper()
+	reply, err := xproto.InternAtom(wm.conn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reply.Atom
+}
+
+func (wm *fakeWM) setCardinals(t *testing.T, win xproto.Window, name string, typ xproto.Atom, values ...uint32) {
+	t.Helper()
+	data := make([]byte, 4*len(values))
+	for i, v := range values {
+		xgb.Put32(data[i*4:], v)
+	}
+	err := xproto.ChangePropertyChecked(wm.conn, xproto.PropModeReplace, win, wm.atom(t, name),
+		typ, 32, uint32(len(values)), data).Check()
+	if err != nil {
+		t.Fatalf("ChangeProperty %s: %v", name, err)
+	}
+	wm.sync(t)
+}
+
+// sync waits until the server has processed every request.
+func (wm *fakeWM) sync(t *testing.T) {
+	t.Helper()
+	if _, err := xproto.GetInputFocus(wm.conn).Reply(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestX11ActiveWindowBounds(t *testing.T) {
+	frame := image.Rect(100, 80, 320, 240)
+	client := image.Rect(110, 110, 310, 230)
+	wm := newFakeWM(t, frame, client)
+
+	// Decorations of 10 pixels with a 30-pixel title bar, and a client-side
+	// shadow of 4 pixels inside the client window.
+	wm.setCardinals(t, wm.client, "_NET_FRAME_EXTENTS", xproto.AtomCardinal, 10, 10, 30, 10)
+	wm.setCardinals(t, wm.client, "_GTK_FRAME_EXTENTS", xproto.AtomCardinal, 4, 4, 4, 4)
+
+	tests := []struct {
+		opts WindowOptions
+		want image.Rectangle
+	}{
+		{WindowOptions{IncludeFrame: true, IncludeShadow: true}, frame},
+		{WindowOptions{IncludeFrame: true}, image.Rect(104, 84, 316, 236)},
+		{WindowOptions{IncludeShadow: true}, client},
+		{WindowOptions{}, image.Rect(114, 114, 306, 226)},
+	}
+	for _, tt := range tests {
+		got, err := newNativeBackend().(WindowLocator).ActiveWindowBounds(tt.opts)
+		if err != nil {
+			t.Fatalf("ActiveWindowBounds(%+v): %v", tt.opts, err)
+		}
+		if got != tt.want {
+			t.Errorf("ActiveWindowBounds(%+v) = %v, want %v", tt.opts, got, tt.want)
+		}
+	}
+}
+
+// Without frame extents, as under a window manager that does not set them,
+// the client window is captured as it is.
+func TestX11ActiveWindowBoundsWithoutExtents(t *testing.T) {
+	client := image.Rect(60, 50, 160, 130)
+	newFakeWM(t, client, client)
+
+	got, err := newNativeBackend().(WindowLocator).ActiveWindowBounds(WindowOptions{IncludeFrame: true})
+	if err != nil {
+		t.Fatalf("ActiveWindowBounds: %v", err)
+	}
+	if got != client {
+		t.Errorf("ActiveWindowBounds = %v, want %v", got, client)
+	}
+}
+
+func TestX11ActiveWindowBoundsNoFocus(t *testing.T) {
+	wm := newFakeWM(t, image.Rect(0, 0, 10, 10), image.Rect(0, 0, 10, 10))
+	wm.setCardinals(t, wm.root, "_NET_ACTIVE_WINDOW", xproto.AtomWindow, 0)
+
+	if _, err := newNativeBackend().(WindowLocator).ActiveWindowBounds(WindowOptions{}); err == nil {
+		t.Error("ActiveWindowBounds succeeded with no active window")
+	}
+}
@@ -0,0 +1,61 @@
+//go:build windows
+
+package capture
+
+import (
+	"fmt"
+	"image"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const DWMWA_EXTENDED_FRAME_BOUNDS = 9
+
+var (
+	dwmapi                    = windows.NewLazySystemDLL("dwmapi.dll")
+	procDwmGetWindowAttribute = dwmapi.NewProc("DwmGetWindowAttribute")
+	procGetForegroundWindow   = user32.NewProc("GetForegroundWindow")
+	procGetWindowRect         = user32.NewProc("GetWindowRect")
+	procGetClientRect         = user32.NewProc("GetClientRect")
+	procClientToScreen        = user32.NewProc("ClientToScreen")
+)
+
+// ActiveWindowBounds uses GetWindowRect when shadows are wanted, the DWM
+// extended frame bounds for the visible frame alone, and the client area when
+// decorations are excluded.
+func (windowsBackend) ActiveWindowBounds(opts WindowOptions) (image.Rectangle, error) {
+	hwnd, _, _ := procGetForegroundWindow.Call()
+	if hwnd == 0 {
+		return image.Rectangle{}, fmt.Errorf("no window has focus")
+	}
+
+	var rc RECT
+	switch {
+	case !opts.IncludeFrame:
+		if ret, _, err := procGetClientRect.Call(hwnd, uintptr(unsafe.Pointer(&rc))); ret == 0 {
+			return image.Rectangle{}, fmt.Errorf("GetClientRect failed: %v", err)
+		}
+		var origin POINT
+		if ret, _, err := procClientToScreen.Call(hwnd, uintptr(unsafe.Pointer(&origin))); ret == 0 {
+			return image.Rectangle{}, fmt.Errorf("ClientToScreen failed: %v", err)
+		}
+		rc.Left += origin.X
+		rc.Right += origin.X
+		rc.Top += origin.Y
+		rc.Bottom += origin.Y
+	case !opts.IncludeShadow:
+		hr, _, _ := procDwmGetWindowAttribute.Call(hwnd, DWMWA_EXTENDED_FRAME_BOUNDS,
+			uintptr(unsafe.Pointer(&rc)), unsafe.Sizeof(rc))
+		if hr == 0 {
+			break
+		}
+		fallthrough
+	default:
+		if ret, _, err := procGetWindowRect.Call(hwnd, uintptr(unsafe.Pointer(&rc))); ret == 0 {
+			return image.Rectangle{}, fmt.Errorf("GetWindowRect failed: %v", err)
+		}
+	}
+
+	return image.Rect(int(rc.Left), int(rc.Top), int(rc.Right), int(rc.Bottom)), nil
+}
@@ -0,0 +1,56 @@
+// Package captureid makes the IDs that name captures everywhere: in preview
+// URLs, the JSON API and the history index. IDs are ULIDs: 48 bits of
+// millisecond time and 80 random bits in Crockford base32, so they sort by
+// capture time, never change and cannot be guessed from one another.
+package captureid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"strings"
+	"time"
+)
+
+// Len is the length of an ID.
+const Len = 26
+
+const alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// New returns a fresh ID for a capture taken at t.
+func New(t time.Time) string {
+	var b [16]byte
+	ms := uint64(t.UnixMilli())
+	binary.BigEndian.PutUint16(b[0:], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:], uint32(ms))
+	rand.Read(b[6:])
+	return encode(b)
+}
+
+// encode writes the 128 bits of b as 26 base32 digits, the first of which
+// carries only 3 bits.
+func encode(b [16]byte) string {
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	var out [Len]byte
+	for i := Len - 1; i >= 0; i-- {
+		out[i] = alphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// Valid reports whether s looks like an ID. Lowercase is accepted, as
+// Crockford base32 is case-insensitive.
+func Valid(s string) bool {
+	if len(s) != Len || s[0] > '7' {
+		return false
+	}
+	for _, c := range strings.ToUpper(s) {
+		if !strings.ContainsRune(alphabet, c) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,5 +1,22 @@
 package clipboard
 
+import (
+	"image"
+
+	"snaphook/internal/clipformat"
+)
+
+// CopyImage places the PNG at imagePath on the clipboard.
 func CopyImage(imagePath string) error {
-	return copyImage(imagePath)
+	payload, err := clipformat.Load(imagePath)
+	if err != nil {
+		return err
+	}
+	return copyPayload(payload)
+}
+
+// Copy places an in-memory image on the clipboard. pngData is its encoding
+// and imagePath a file holding it, for apps that paste files.
+func Copy(img image.Image, pngData []byte, imagePath string) error {
+	return copyPayload(clipformat.New(img, pngData, imagePath))
 }
@@ -0,0 +1,397 @@
+//go:build linux
+
+package clipboard
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+
+	"snaphook/internal/clipformat"
+)
+
+// X11 has no clipboard storage: the owner of the CLIPBOARD selection keeps
+// the data and answers every paste itself. Each copy starts an owner with its
+// own connection and hidden window that serves requests until another client
+// takes the selection.
+
+// maxChunk caps a single property write; larger payloads use the INCR
+// protocol. 256 KiB stays well under any server's request limit.
+const maxChunk = 256 * 1024
+
+type atoms struct {
+	clipboard, targets, incr, timestamp, multiple, atomPair xproto.Atom
+}
+
+// target is one representation offered to requestors. Conversions run on
+// the first request for them; the payload caches the result.
+type target struct {
+	name string
+	atom xproto.Atom
+	data func() ([]byte, error)
+}
+
+// transfer is an INCR transfer in progress to one requestor property.
+type transfer struct {
+	target xproto.Atom
+	data   []byte
+	offset int
+}
+
+type transferKey struct {
+	window   xproto.Window
+	property xproto.Atom
+}
+
+type owner struct {
+	conn   *xgb.Conn
+	window xproto.Window
+	atoms  atoms
+	chunk  int
+	// time is when the selection was taken, which TIMESTAMP reports and
+	// older requests are refused by.
+	time xproto.Timestamp
+
+	targets []*target
+
+	transfers map[transferKey]*transfer
+	// incrWindows counts the transfers to each requestor window, so its
+	// event mask is only reset when the last one ends.
+	incrWindows map[xproto.Window]int
+	done        chan struct{}
+}
+
+var (
+	currentOwner *owner
+	ownerMutex   sync.Mutex
+)
+
+func copyPayload(payload *clipformat.Payload) error {
+	o, err := newOwner(payload)
+	if err != nil {
+		return err
+	}
+
+	ownerMutex.Lock()
+	previous := currentOwner
+	currentOwner = o
+	ownerMutex.Unlock()
+
+	// The new owner already holds the selection, so the old one has been
+	// sent SelectionClear; closing it here just makes that prompt.
+	if previous != nil {
+		previous.conn.Close()
+	}
+
+	go o.serve()
+	return nil
+}
+
+func internAtom(conn *xgb.Conn, name string) (xproto.Atom, error) {
+	reply, err := xproto.InternAtom(conn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		return 0, fmt.Errorf("failed to intern %s: %w", name, err)
+	}
+	return reply.Atom, nil
+}
+
+func newOwner(payload *clipformat.Payload) (*owner, error) {
+	conn, err := xgb.NewConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to X server: %w", err)
+	}
+
+	o := &owner{
+		conn:        conn,
+		transfers:   map[transferKey]*transfer{},
+		incrWindows: map[xproto.Window]int{},
+		done:        make(chan struct{}),
+	}
+
+	setup := xproto.Setup(conn)
+	o.chunk = maxChunk
+	if limit := int(setup.MaximumRequestLength)*4 - 1024; limit < o.chunk {
+		o.chunk = limit
+	}
+
+	for _, a := range []struct {
+		dst  *xproto.Atom
+		name string
+	}{
+		{&o.atoms.clipboard, "CLIPBOARD"},
+		{&o.atoms.targets, "TARGETS"},
+		{&o.atoms.incr, "INCR"},
+		{&o.atoms.timestamp, "TIMESTAMP"},
+		{&o.atoms.multiple, "MULTIPLE"},
+		{&o.atoms.atomPair, "ATOM_PAIR"},
+	} {
+		if *a.dst, err = internAtom(conn, a.name); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	files := []string{payload.Path}
+	o.targets = []*target{
+		{name: "image/png", data: func() ([]byte, error) { return payload.PNG, nil }},
+		{name: "image/bmp", data: payload.BMP},
+		{name: "text/uri-list", data: func() ([]byte, error) { return clipformat.URIList(files), nil }},
+		{name: "x-special/gnome-copied-files", data: func() ([]byte, error) { return clipformat.GnomeCopiedFiles(files), nil }},
+		{name: "text/html", data: func() ([]byte, error) { return []byte(payload.HTML()), nil }},
+	}
+	for _, t := range o.targets {
+		if t.atom, err = internAtom(conn, t.name); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	screen := setup.DefaultScreen(conn)
+	o.window, err = xproto.NewWindowId(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	err = xproto.CreateWindowChecked(conn, screen.RootDepth, o.window, screen.Root,
+		0, 0, 1, 1, 0, xproto.WindowClassInputOnly, screen.RootVisual,
+		xproto.CwEventMask, []uint32{xproto.EventMaskPropertyChange}).Check()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create clipboard window: %w", err)
+	}
+
+	// The ICCCM asks owners for a real timestamp rather than CurrentTime.
+	if o.time, err = serverTime(conn, o.window); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to set clipboard data: %w", err)
+	}
+	xproto.SetSelectionOwner(conn, o.window, o.atoms.clipboard, o.time)
+	reply, err := xproto.GetSelectionOwner(conn, o.atoms.clipboard).Reply()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to set clipboard data: %w", err)
+	}
+	if reply.Owner != o.window {
+		conn.Close()
+		return nil, fmt.Errorf("failed to set clipboard data: another client kept the selection")
+	}
+
+	return o, nil
+}
+
+// serverTime gets the server's current time the way the ICCCM suggests: a
+// zero-length append to a property of win, whose PropertyNotify carries the
+// time. win must select PropertyChange events.
+func serverTime(conn *xgb.Conn, win xproto.Window) (xproto.Timestamp, error) {
+	err := xproto.ChangePropertyChecked(conn, xproto.PropModeAppend, win,
+		xproto.AtomWmName, xproto.AtomString, 8, 0, nil).Check()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		ev, err := conn.WaitForEvent()
+		if ev == nil && err == nil {
+			return 0, fmt.Errorf("X connection closed")
+		}
+		if e, ok := ev.(xproto.PropertyNotifyEvent); ok && e.Window == win {
+			return e.Time, nil
+		}
+	}
+}
+
+// serve answers selection requests until another client takes ownership or
+// the connection is closed.
+func (o *owner) serve() {
+	defer close(o.done)
+	defer o.conn.Close()
+
+	for {
+		ev, err := o.conn.WaitForEvent()
+		if ev == nil && err == nil {
+			return
+		}
+		if err != nil {
+			log.Printf("X error while serving clipboard: %v", err)
+			continue
+		}
+
+		switch e := ev.(type) {
+		case xproto.SelectionRequestEvent:
+			o.handleRequest(e)
+		case xproto.PropertyNotifyEvent:
+			if e.Window != o.window {
+				o.continueTransfer(e)
+			}
+		case xproto.SelectionClearEvent:
+			ownerMutex.Lock()
+			if currentOwner == o {
+				currentOwner = nil
+			}
+			ownerMutex.Unlock()
+			return
+		}
+	}
+}
+
+func (o *owner) handleRequest(e xproto.SelectionRequestEvent) {
+	property := e.Property
+	if property == xproto.AtomNone {
+		// Obsolete clients pass None and expect the target name to be used.
+		property = e.Target
+	}
+
+	switch {
+	case e.Time != xproto.TimeCurrentTime && e.Time < o.time:
+		// The request is for an earlier owner's selection.
+		property = xproto.AtomNone
+	case e.Target == o.atoms.multiple:
+		if !o.convertMultiple(e.Requestor, e.Property) {
+			property = xproto.AtomNone
+		}
+	case !o.convert(e.Requestor, property, e.Target):
+		property = xproto.AtomNone
+	}
+
+	notify := xproto.SelectionNotifyEvent{
+		Time:      e.Time,
+		Requestor: e.Requestor,
+		Selection: e.Selection,
+		Target:    e.Target,
+		Property:  property,
+	}
+	xproto.SendEvent(o.conn, false, e.Requestor, xproto.EventMaskNoEvent, string(notify.Bytes()))
+}
+
+// convert writes target to the requestor's property and reports whether it
+// could.
+func (o *owner) convert(requestor xproto.Window, property, target xproto.Atom) bool {
+	switch target {
+	case o.atoms.targets:
+		list := []xproto.Atom{o.atoms.targets, o.atoms.timestamp, o.atoms.multiple}
+		for _, t := range o.targets {
+			list = append(list, t.atom)
+		}
+		buf := make([]byte, 4*len(list))
+		for i, a := range list {
+			xgb.Put32(buf[i*4:], uint32(a))
+		}
+		xproto.ChangeProperty(o.conn, xproto.PropModeReplace, requestor, property,
+			xproto.AtomAtom, 32, uint32(len(list)), buf)
+		return true
+	case o.atoms.timestamp:
+		buf := make([]byte, 4)
+		xgb.Put32(buf, uint32(o.time))
+		xproto.ChangeProperty(o.conn, xproto.PropModeReplace, requestor, property,
+			xproto.AtomInteger, 32, 1, buf)
+		return true
+	}
+
+	t := o.findTarget(target)
+	if t == nil {
+		return false
+	}
+	data, err := t.data()
+	if err != nil {
+		log.Printf("Failed to convert clipboard image to %s: %v", t.name, err)
+		return false
+	}
+	o.send(requestor, property, target, data)
+	return true
+}
+
+// convertMultiple answers a MULTIPLE request, whose property lists target
+// and property pairs. Pairs that cannot be converted get None as their
+// property, and the list is written back.
+func (o *owner) convertMultiple(requestor xproto.Window, property xproto.Atom) bool {
+	if property == xproto.AtomNone {
+		return false
+	}
+	reply, err := xproto.GetProperty(o.conn, false, requestor, property,
+		xproto.GetPropertyTypeAny, 0, 1<<16).Reply()
+	if err != nil || reply.Format != 32 {
+		return false
+	}
+
+	pairs := reply.Value[:len(reply.Value)/8*8]
+	for i := 0; i < len(pairs); i += 8 {
+		target := xproto.Atom(xgb.Get32(pairs[i:]))
+		prop := xproto.Atom(xgb.Get32(pairs[i+4:]))
+		if target == o.atoms.multiple || prop == xproto.AtomNone || !o.convert(requestor, prop, target) {
+			xgb.Put32(pairs[i+4:], uint32(xproto.AtomNone))
+		}
+	}
+	xproto.ChangeProperty(o.conn, xproto.PropModeReplace, requestor, property,
+		o.atoms.atomPair, 32, uint32(len(pairs)/4), pairs)
+	return true
+}
+
+func (o *owner) findTarget(atom xproto.Atom) *target {
+	for _, t := range o.targets {
+		if t.atom == atom {
+			return t
+		}
+	}
+	return nil
+}
+
+// send writes data to the requestor's property, switching to INCR when it
+// does not fit in one request.
+func (o *owner) send(requestor xproto.Window, property, target xproto.Atom, data []byte) {
+	if len(data) <= o.chunk {
+		xproto.ChangeProperty(o.conn, xproto.PropModeReplace, requestor, property,
+			target, 8, uint32(len(data)), data)
+		return
+	}
+
+	// The requestor deletes the property after reading each chunk; watch
+	// for that to write the next one.
+	if o.incrWindows[requestor] == 0 {
+		xproto.ChangeWindowAttributes(o.conn, requestor, xproto.CwEventMask,
+			[]uint32{xproto.EventMaskPropertyChange})
+	}
+
+	size := make([]byte, 4)
+	xgb.Put32(size, uint32(len(data)))
+	xproto.ChangeProperty(o.conn, xproto.PropModeReplace, requestor, property,
+		o.atoms.incr, 32, 1, size)
+
+	key := transferKey{requestor, property}
+	if _, ok := o.transfers[key]; !ok {
+		o.incrWindows[requestor]++
+	}
+	o.transfers[key] = &transfer{target: target, data: data}
+}
+
+func (o *owner) continueTransfer(e xproto.PropertyNotifyEvent) {
+	if e.State != xproto.PropertyDelete {
+		return
+	}
+
+	key := transferKey{e.Window, e.Atom}
+	t, ok := o.transfers[key]
+	if !ok {
+		return
+	}
+
+	end := t.offset + o.chunk
+	if end > len(t.data) {
+		end = len(t.data)
+	}
+	chunk := t.data[t.offset:end]
+	t.offset = end
+
+	// A zero-length write marks the end of the transfer.
+	xproto.ChangeProperty(o.conn, xproto.PropModeReplace, e.Window, e.Atom,
+		t.target, 8, uint32(len(chunk)), chunk)
+	if len(chunk) == 0 {
+		delete(o.transfers, key)
+		o.incrWindows[e.Window]--
+		if o.incrWindows[e.Window] == 0 {
+			delete(o.incrWindows, e.Window)
+			xproto.ChangeWindowAttributes(o.conn, e.Window, xproto.CwEventMask, []uint32{0})
+		}
+	}
+}
@@ -0,0 +1,367 @@
+//go:build linux
+
+package clipboard
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+
+	"snaphook/internal/clipformat"
+)
+
+// pasteClient reads the CLIPBOARD selection the way a pasting application
+// does, including INCR transfers.
+type pasteClient struct {
+	conn      *xgb.Conn
+	window    xproto.Window
+	clipboard xproto.Atom
+	property  xproto.Atom
+	incr      xproto.Atom
+	events    chan xgb.Event
+}
+
+// newPasteClient connects to the X server in DISPLAY, such as Xvfb, or
+// skips the test when there is none.
+func newPasteClient(t *testing.T) *pasteClient {
+	t.Helper()
+	if os.Getenv("DISPLAY") == "" {
+		t.Skip("DISPLAY is not set; run under Xvfb")
+	}
+	conn, err := xgb.NewConn()
+	if err != nil {
+		t.Skipf("cannot connect to the X server: %v", err)
+	}
+	t.Cleanup(conn.Close)
+
+	c := &pasteClient{conn: conn, events: make(chan xgb.Event, 16)}
+	for _, a := range []struct {
+		dst  *xproto.Atom
+		name string
+	}{
+		{&c.clipboard, "CLIPBOARD"},
+		{&c.property, "SNAPHOOK_TEST_PASTE"},
+		{&c.incr, "INCR"},
+	} {
+		if *a.dst, err = internAtom(conn, a.name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	screen := xproto.Setup(conn).DefaultScreen(conn)
+	if c.window, err = xproto.NewWindowId(conn); err != nil {
+		t.Fatal(err)
+	}
+	err = xproto.CreateWindowChecked(conn, screen.RootDepth, c.window, screen.Root,
+		0, 0, 1, 1, 0, xproto.WindowClassInputOnly, screen.RootVisual,
+		xproto.CwEventMask, []uint32{xproto.EventMaskPropertyChange}).Check()
+	if err != nil {
+		t.Fatalf("CreateWindow: %v", err)
+	}
+
+	go func() {
+		for {
+			ev, err := conn.WaitForEvent()
+			if ev == nil && err == nil {
+				close(c.events)
+				return
+			}
+			if ev != nil {
+				c.events <- ev
+			}
+		}
+	}()
+	return c
+}
+
+func (c *pasteClient) nextEvent(t *testing.T) xgb.Event {
+	t.Helper()
+	select {
+	case ev, ok := <-c.events:
+		if !ok {
+			t.Fatal("X connection closed")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the clipboard owner")
+	}
+	return nil
+}
+
+// takeProperty reads and deletes the paste property.
+func (c *pasteClient) takeProperty(t *testing.T) *xproto.GetPropertyReply {
+	t.Helper()
+	reply, err := xproto.GetProperty(c.conn, true, c.window, c.property,
+		xproto.GetPropertyTypeAny, 0, 1<<30).Reply()
+	if err != nil {
+		t.Fatalf("GetProperty: %v", err)
+	}
+	return reply
+}
+
+// paste converts the selection to target and returns the data and whether
+// it came by INCR.
+func (c *pasteClient) paste(t *testing.T, target string) ([]byte, bool) {
+	t.Helper()
+	targetAtom, err := internAtom(c.conn, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xproto.ConvertSelection(c.conn, c.window, c.clipboard, targetAtom, c.property, xproto.TimeCurrentTime)
+
+	for {
+		notify, ok := c.nextEvent(t).(xproto.SelectionNotifyEvent)
+		if !ok {
+			continue
+		}
+		if notify.Property == xproto.AtomNone {
+			t.Fatalf("the owner refused to convert to %s", target)
+		}
+		break
+	}
+
+	reply := c.takeProperty(t)
+	if reply.Type != c.incr {
+		return reply.Value, false
+	}
+
+	// Deleting the INCR property asks for the first chunk; each chunk is
+	// announced by a new value and the empty one ends the transfer.
+	var data []byte
+	for {
+		ev, ok := c.nextEvent(t).(xproto.PropertyNotifyEvent)
+		if !ok || ev.Atom != c.property || ev.State != xproto.PropertyNewValue {
+			continue
+		}
+		chunk := c.takeProperty(t)
+		if chunk.ValueLen == 0 {
+			return data, true
+		}
+		data = append(data, chunk.Value...)
+	}
+}
+
+// cleanupOwner ends the clipboard owner when the test finishes.
+func cleanupOwner(t *testing.T) {
+	t.Cleanup(func() {
+		ownerMutex.Lock()
+		o := currentOwner
+		currentOwner = nil
+		ownerMutex.Unlock()
+		if o != nil {
+			o.conn.Close()
+			<-o.done
+		}
+	})
+}
+
+// noise returns an image that PNG cannot compress, so its encoding is as
+// large as its pixels.
+func noise(w, h int) *image.RGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255})
+		}
+	}
+	return img
+}
+
+func copyNoise(t *testing.T, w, h int) (*clipformat.Payload, []byte) {
+	t.Helper()
+	img := noise(w, h)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "shot.png")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cleanupOwner(t)
+	if err := Copy(img, buf.Bytes(), path); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	return clipformat.New(img, buf.Bytes(), path), buf.Bytes()
+}
+
+func TestX11PasteSmall(t *testing.T) {
+	c := newPasteClient(t)
+	payload, pngData := copyNoise(t, 16, 16)
+
+	got, incr := c.paste(t, "image/png")
+	if incr {
+		t.Error("a small image was sent with INCR")
+	}
+	if !bytes.Equal(got, pngData) {
+		t.Errorf("image/png: got %d bytes, want the %d copied", len(got), len(pngData))
+	}
+
+	got, _ = c.paste(t, "text/uri-list")
+	if want := clipformat.URIList([]string{payload.Path}); !bytes.Equal(got, want) {
+		t.Errorf("text/uri-list = %q, want %q", got, want)
+	}
+}
+
+func TestX11PasteTargets(t *testing.T) {
+	c := newPasteClient(t)
+	copyNoise(t, 4, 4)
+
+	got, _ := c.paste(t, "TARGETS")
+	names := map[string]bool{}
+	for i := 0; i+4 <= len(got); i += 4 {
+		reply, err := xproto.GetAtomName(c.conn, xproto.Atom(xgb.Get32(got[i:]))).Reply()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names[reply.Name] = true
+	}
+	for _, want := range []string{"TARGETS", "TIMESTAMP", "MULTIPLE", "image/png", "image/bmp", "text/uri-list", "x-special/gnome-copied-files", "text/html"} {
+		if !names[want] {
+			t.Errorf("TARGETS lacks %s", want)
+		}
+	}
+}
+
+// An image larger than the server's maximum request cannot be written in
+// one property and must arrive by INCR, byte for byte.
+func TestX11PasteIncremental(t *testing.T) {
+	c := newPasteClient(t)
+	maxRequest := int(xproto.Setup(c.conn).MaximumRequestLength) * 4
+	side := 256
+	for side*side*4 <= 2*maxRequest {
+		side *= 2
+	}
+	payload, pngData := copyNoise(t, side, side)
+	if len(pngData) <= maxRequest {
+		t.Fatalf("test image is %d bytes, not larger than the %d-byte request limit", len(pngData), maxRequest)
+	}
+
+	got, incr := c.paste(t, "image/png")
+	if !incr {
+		t.Error("image/png was not sent with INCR")
+	}
+	if !bytes.Equal(got, pngData) {
+		t.Errorf("image/png: got %d bytes, want the %d copied", len(got), len(pngData))
+	}
+
+	want, err := payload.BMP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, incr = c.paste(t, "image/bmp")
+	if !incr {
+		t.Error("image/bmp was not sent with INCR")
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("image/bmp: got %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestX11PasteTimestamp(t *testing.T) {
+	c := newPasteClient(t)
+	copyNoise(t, 4, 4)
+
+	got, _ := c.paste(t, "TIMESTAMP")
+	if len(got) != 4 || xgb.Get32(got) == uint32(xproto.TimeCurrentTime) {
+		t.Errorf("TIMESTAMP = %v, want the time the selection was taken", got)
+	}
+}
+
+// A MULTIPLE request for two images too large for one property starts two
+// INCR transfers to the same window at once; both must complete.
+func TestX11PasteMultiple(t *testing.T) {
+	c := newPasteClient(t)
+	maxRequest := int(xproto.Setup(c.conn).MaximumRequestLength) * 4
+	side := 256
+	for side*side*4 <= 2*maxRequest {
+		side *= 2
+	}
+	payload, pngData := copyNoise(t, side, side)
+	bmpData, err := payload.BMP()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	atom := func(name string) xproto.Atom {
+		a, err := internAtom(c.conn, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	pngProp, bmpProp, missingProp := atom("SNAPHOOK_TEST_PNG"), atom("SNAPHOOK_TEST_BMP"), atom("SNAPHOOK_TEST_MISSING")
+	pairs := []xproto.Atom{atom("image/png"), pngProp, atom("image/bmp"), bmpProp, atom("image/x-unknown"), missingProp}
+	buf := make([]byte, 4*len(pairs))
+	for i, a := range pairs {
+		xgb.Put32(buf[i*4:], uint32(a))
+	}
+	xproto.ChangeProperty(c.conn, xproto.PropModeReplace, c.window, c.property,
+		atom("ATOM_PAIR"), 32, uint32(len(pairs)), buf)
+	xproto.ConvertSelection(c.conn, c.window, c.clipboard, atom("MULTIPLE"), c.property, xproto.TimeCurrentTime)
+
+	for {
+		notify, ok := c.nextEvent(t).(xproto.SelectionNotifyEvent)
+		if !ok {
+			continue
+		}
+		if notify.Property == xproto.AtomNone {
+			t.Fatal("the owner refused MULTIPLE")
+		}
+		break
+	}
+	reply := c.takeProperty(t)
+	if len(reply.Value) != len(buf) {
+		t.Fatalf("MULTIPLE answered %d bytes of pairs, want %d", len(reply.Value), len(buf))
+	}
+	if got := xproto.Atom(xgb.Get32(reply.Value[20:])); got != xproto.AtomNone {
+		t.Errorf("the unknown target's property = %d, want None", got)
+	}
+
+	// Start both transfers, then serve their chunks as they come.
+	received := map[xproto.Atom][]byte{}
+	pending := map[xproto.Atom]bool{}
+	for _, prop := range []xproto.Atom{pngProp, bmpProp} {
+		r, err := xproto.GetProperty(c.conn, true, c.window, prop, xproto.GetPropertyTypeAny, 0, 1<<30).Reply()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Type != c.incr {
+			t.Fatalf("property %d was not sent with INCR", prop)
+		}
+		pending[prop] = true
+	}
+	for len(pending) > 0 {
+		ev, ok := c.nextEvent(t).(xproto.PropertyNotifyEvent)
+		if !ok || !pending[ev.Atom] || ev.State != xproto.PropertyNewValue {
+			continue
+		}
+		chunk, err := xproto.GetProperty(c.conn, true, c.window, ev.Atom, xproto.GetPropertyTypeAny, 0, 1<<30).Reply()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chunk.ValueLen == 0 {
+			delete(pending, ev.Atom)
+			continue
+		}
+		received[ev.Atom] = append(received[ev.Atom], chunk.Value...)
+	}
+
+	if !bytes.Equal(received[pngProp], pngData) {
+		t.Errorf("image/png: got %d bytes, want %d", len(received[pngProp]), len(pngData))
+	}
+	if !bytes.Equal(received[bmpProp], bmpData) {
+		t.Errorf("image/bmp: got %d bytes, want %d", len(received[bmpProp]), len(bmpData))
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows && !linux
+
+package clipboard
+
+import (
+	"fmt"
+	"runtime"
+
+	"snaphook/internal/clipformat"
+)
+
+func copyPayload(payload *clipformat.Payload) error {
+	return fmt.Errorf("clipboard is not supported on %s", runtime.GOOS)
+}
@@ -3,64 +3,82 @@
 package clipboard
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
-	"image"
-	"image/png"
-	"os"
 	"unsafe"
 
 	"golang.org/x/sys/windows"
+
+	"snaphook/internal/clipformat"
 )
 
 var (
-	user32               = windows.NewLazySystemDLL("user32.dll")
-	kernel32             = windows.NewLazySystemDLL("kernel32.dll")
-	procOpenClipboard    = user32.NewProc("OpenClipboard")
-	procCloseClipboard   = user32.NewProc("CloseClipboard")
-	procEmptyClipboard   = user32.NewProc("EmptyClipboard")
-	procSetClipboardData = user32.NewProc("SetClipboardData")
-	procGlobalAlloc      = kernel32.NewProc("GlobalAlloc")
-	procGlobalLock       = kernel32.NewProc("GlobalLock")
-	procGlobalUnlock     = kernel32.NewProc("GlobalUnlock")
-	procGlobalFree       = kernel32.NewProc("GlobalFree")
+	user32                       = windows.NewLazySystemDLL("user32.dll")
+	kernel32                     = windows.NewLazySystemDLL("kernel32.dll")
+	procOpenClipboard            = user32.NewProc("OpenClipboard")
+	procCloseClipboard           = user32.NewProc("CloseClipboard")
+	procEmptyClipboard           = user32.NewProc("EmptyClipboard")
+	procSetClipboardData         = user32.NewProc("SetClipboardData")
+	procRegisterClipboardFormatW = user32.NewProc("RegisterClipboardFormatW")
+	procGlobalAlloc              = kernel32.NewProc("GlobalAlloc")
+	procGlobalLock               = kernel32.NewProc("GlobalLock")
+	procGlobalUnlock             = kernel32.NewProc("GlobalUnlock")
+	procGlobalFree               = kernel32.NewProc("GlobalFree")
 )
 
 const (
 	CF_DIB        = 8
+	CF_HDROP      = 15
+	CF_DIBV5      = 17
 	GMEM_MOVEABLE = 0x0002
 )
 
-type BITMAPINFOHEADER struct {
-	Size          uint32
-	Width         int32
-	Height        int32
-	Planes        uint16
-	BitCount      uint16
-	Compression   uint32
-	SizeImage     uint32
-	XPelsPerMeter int32
-	YPelsPerMeter int32
-	ClrUsed       uint32
-	ClrImportant  uint32
+// clipFormat is one representation placed on the clipboard.
+type clipFormat struct {
+	name string
+	id   uintptr
+	data func() ([]byte, error)
 }
 
-func copyImage(imagePath string) error {
-	file, err := os.Open(imagePath)
+func registerFormat(name string) (uintptr, error) {
+	namePtr, err := windows.UTF16PtrFromString(name)
 	if err != nil {
-		return fmt.Errorf("failed to open image: %w", err)
+		return 0, err
+	}
+	id, _, _ := procRegisterClipboardFormatW.Call(uintptr(unsafe.Pointer(namePtr)))
+	if id == 0 {
+		return 0, fmt.Errorf("failed to register clipboard format %s", name)
 	}
-	defer file.Close()
+	return id, nil
+}
 
-	img, err := png.Decode(file)
+func copyPayload(payload *clipformat.Payload) error {
+	pngFormat, err := registerFormat("PNG")
 	if err != nil {
-		return fmt.Errorf("failed to decode PNG: %w", err)
+		return err
 	}
-
-	dibData, err := imageToDIB(img)
+	htmlFormat, err := registerFormat("HTML Format")
 	if err != nil {
-		return fmt.Errorf("failed to convert to DIB: %w", err)
+		return err
+	}
+
+	// Convert everything before opening the clipboard so it is held as
+	// briefly as possible.
+	formats := []clipFormat{
+		{"PNG", pngFormat, func() ([]byte, error) { return payload.PNG, nil }},
+		{"CF_DIBV5", CF_DIBV5, payload.DIBV5},
+		{"CF_DIB", CF_DIB, payload.DIB},
+		{"CF_HDROP", CF_HDROP, func() ([]byte, error) {
+			return clipformat.DropFiles([]string{payload.Path}), nil
+		}},
+		{"HTML Format", htmlFormat, func() ([]byte, error) {
+			return clipformat.CFHTML(payload.HTML()), nil
+		}},
+	}
+	data := make([][]byte, len(formats))
+	for i, f := range formats {
+		if data[i], err = f.data(); err != nil {
+			return fmt.Errorf("failed to convert to %s: %w", f.name, err)
+		}
 	}
 
 	ret, _, _ := procOpenClipboard.Call(0)
@@ -71,65 +89,38 @@ func copyImage(imagePath string) error {
 
 	procEmptyClipboard.Call()
 
-	hMem, _, _ := procGlobalAlloc.Call(GMEM_MOVEABLE, uintptr(len(dibData)))
+	for i, f := range formats {
+		if err := setClipboardData(f.id, data[i]); err != nil {
+			return fmt.Errorf("failed to set %s clipboard data: %w", f.name, err)
+		}
+	}
+
+	return nil
+}
+
+// setClipboardData copies data into a movable global block and hands it to
+// the open clipboard, which takes ownership on success.
+func setClipboardData(format uintptr, data []byte) error {
+	hMem, _, _ := procGlobalAlloc.Call(GMEM_MOVEABLE, uintptr(len(data)))
 	if hMem == 0 {
 		return fmt.Errorf("failed to allocate memory")
 	}
 
 	pMem, _, _ := procGlobalLock.Call(hMem)
 	if pMem == 0 {
+		procGlobalFree.Call(hMem)
 		return fmt.Errorf("failed to lock memory")
 	}
 
-	dest := unsafe.Slice((*byte)(unsafe.Pointer(pMem)), len(dibData))
-	copy(dest, dibData)
+	dest := unsafe.Slice((*byte)(unsafe.Pointer(pMem)), len(data))
+	copy(dest, data)
 	procGlobalUnlock.Call(hMem)
 
-	ret, _, _ = procSetClipboardData.Call(CF_DIB, hMem)
+	ret, _, _ := procSetClipboardData.Call(format, hMem)
 	if ret == 0 {
 		procGlobalFree.Call(hMem)
-		return fmt.Errorf("failed to set clipboard data")
+		return fmt.Errorf("SetClipboardData failed")
 	}
 
 	return nil
 }
-
-func imageToDIB(img image.Image) ([]byte, error) {
-	bounds := img.Bounds()
-	width := bounds.Dx()
-	height := bounds.Dy()
-
-	rowSize := ((width*3 + 3) / 4) * 4
-	imageSize := rowSize * height
-
-	header := BITMAPINFOHEADER{
-		Size:          40,
-		Width:         int32(width),
-		Height:        int32(height),
-		Planes:        1,
-		BitCount:      24,
-		Compression:   0,
-		SizeImage:     uint32(imageSize),
-		XPelsPerMeter: 0,
-		YPelsPerMeter: 0,
-		ClrUsed:       0,
-		ClrImportant:  0,
-	}
-
-	buf := new(bytes.Buffer)
-	binary.Write(buf, binary.LittleEndian, header)
-
-	pixels := make([]byte, imageSize)
-	for y := height - 1; y >= 0; y-- {
-		for x := 0; x < width; x++ {
-			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
-			offset := (height-1-y)*rowSize + x*3
-			pixels[offset] = byte(b >> 8)
-			pixels[offset+1] = byte(g >> 8)
-			pixels[offset+2] = byte(r >> 8)
-		}
-	}
-
-	buf.Write(pixels)
-	return buf.Bytes(), nil
-}
@@ -0,0 +1,116 @@
+// Package clipformat builds the representations of a screenshot that the
+// clipboard backends publish together: the PNG itself, DIBs for Windows
+// apps, a file-list entry for the file on disk and an HTML <img> fragment.
+// It does no I/O beyond reading the source file, so every conversion can be
+// used from any platform.
+package clipformat
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// Payload is one screenshot ready to be placed on the clipboard. The
+// conversions are computed on demand and cached, so a backend only pays for
+// the formats it is actually asked for. A Payload is not safe for concurrent
+// use.
+type Payload struct {
+	// PNG is the encoded file exactly as written by capture.
+	PNG []byte
+	// Path is the absolute path of that file.
+	Path string
+
+	img   image.Image
+	dib   []byte
+	dibV5 []byte
+	bmp   []byte
+}
+
+// Load reads the PNG at path. The image is decoded only if a conversion
+// needs it.
+func Load(path string) (*Payload, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve image path: %w", err)
+	}
+
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %w", err)
+	}
+	if _, err := png.DecodeConfig(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("failed to decode PNG: %w", err)
+	}
+
+	return &Payload{PNG: data, Path: abs}, nil
+}
+
+// New builds a payload for an image that is already in memory and encoded,
+// such as a fresh capture, so nothing is read or decoded again. path is a
+// file holding pngData, used for the file-list entry.
+func New(img image.Image, pngData []byte, path string) *Payload {
+	return &Payload{PNG: pngData, Path: path, img: img}
+}
+
+// Image returns the decoded screenshot.
+func (p *Payload) Image() (image.Image, error) {
+	if p.img == nil {
+		img, err := png.Decode(bytes.NewReader(p.PNG))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode PNG: %w", err)
+		}
+		p.img = img
+	}
+	return p.img, nil
+}
+
+// DIB returns a 24-bit bottom-up DIB (BITMAPINFOHEADER followed by pixels),
+// the CF_DIB layout. Alpha is dropped.
+func (p *Payload) DIB() ([]byte, error) {
+	if p.dib == nil {
+		img, err := p.Image()
+		if err != nil {
+			return nil, err
+		}
+		if p.dib, err = DIB(img); err != nil {
+			return nil, err
+		}
+	}
+	return p.dib, nil
+}
+
+// DIBV5 returns a 32-bit DIB with a BITMAPV5HEADER and straight alpha, the
+// CF_DIBV5 layout.
+func (p *Payload) DIBV5() ([]byte, error) {
+	if p.dibV5 == nil {
+		img, err := p.Image()
+		if err != nil {
+			return nil, err
+		}
+		if p.dibV5, err = DIBV5(img); err != nil {
+			return nil, err
+		}
+	}
+	return p.dibV5, nil
+}
+
+// BMP returns a standalone .bmp file, as served for the image/bmp target.
+func (p *Payload) BMP() ([]byte, error) {
+	if p.bmp == nil {
+		dib, err := p.DIB()
+		if err != nil {
+			return nil, err
+		}
+		p.bmp = BMP(dib)
+	}
+	return p.bmp, nil
+}
+
+// HTML returns an <img> fragment embedding the PNG as a data URI.
+func (p *Payload) HTML() string {
+	return HTMLFragment(p.PNG)
+}
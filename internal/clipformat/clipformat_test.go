@@ -0,0 +1,46 @@
+package clipformat
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// checkGolden compares got with testdata/name, or rewrites the file with
+// -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s:\ngot  % x\nwant % x", path, got, want)
+	}
+}
+
+// pattern is a small image whose pixels are all different, with a width
+// that needs row padding in a 24-bit DIB and a translucent pixel.
+func pattern() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.SetRGBA(0, 0, color.RGBA{0xff, 0x00, 0x00, 0xff})
+	img.SetRGBA(1, 0, color.RGBA{0x00, 0xff, 0x00, 0xff})
+	img.SetRGBA(2, 0, color.RGBA{0x00, 0x00, 0xff, 0xff})
+	img.SetRGBA(0, 1, color.RGBA{0x10, 0x20, 0x30, 0xff})
+	img.SetRGBA(1, 1, color.RGBA{0x40, 0x20, 0x00, 0x80})
+	img.SetRGBA(2, 1, color.RGBA{0x00, 0x00, 0x00, 0x00})
+	return img
+}
@@ -0,0 +1,218 @@
+package clipformat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"runtime"
+	"sync"
+)
+
+const (
+	biRGB       = 0
+	biBitfields = 3
+
+	lcsSRGB       = 0x73524742 // 'sRGB'
+	lcsGMImages   = 4
+	bmpHeaderSize = 14
+)
+
+type BITMAPINFOHEADER struct {
+	Size          uint32
+	Width         int32
+	Height        int32
+	Planes        uint16
+	BitCount      uint16
+	Compression   uint32
+	SizeImage     uint32
+	XPelsPerMeter int32
+	YPelsPerMeter int32
+	ClrUsed       uint32
+	ClrImportant  uint32
+}
+
+type BITMAPV5HEADER struct {
+	BITMAPINFOHEADER
+	RedMask     uint32
+	GreenMask   uint32
+	BlueMask    uint32
+	AlphaMask   uint32
+	CSType      uint32
+	Endpoints   [9]int32 // CIEXYZTRIPLE, unused for sRGB
+	GammaRed    uint32
+	GammaGreen  uint32
+	GammaBlue   uint32
+	Intent      uint32
+	ProfileData uint32
+	ProfileSize uint32
+	Reserved    uint32
+}
+
+// minBandRows keeps parallel bands large enough that goroutine startup does
+// not dominate on small images.
+const minBandRows = 64
+
+// DIB converts img to a 24-bit bottom-up DIB.
+func DIB(img image.Image) ([]byte, error) {
+	src := toRGBA(img)
+	width := src.Rect.Dx()
+	height := src.Rect.Dy()
+
+	rowSize := ((width*3 + 3) / 4) * 4
+	imageSize := rowSize * height
+
+	header := BITMAPINFOHEADER{
+		Size:        40,
+		Width:       int32(width),
+		Height:      int32(height),
+		Planes:      1,
+		BitCount:    24,
+		Compression: biRGB,
+		SizeImage:   uint32(imageSize),
+	}
+
+	out := make([]byte, 40+imageSize)
+	binary.Encode(out, binary.LittleEndian, header)
+	pixels := out[40:]
+
+	parallelRows(height, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			off := src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y+y)
+			row := src.Pix[off : off+width*4]
+			dst := pixels[(height-1-y)*rowSize : (height-1-y)*rowSize+width*3]
+			for x, i := 0, 0; x < len(row); x, i = x+4, i+3 {
+				dst[i] = row[x+2]
+				dst[i+1] = row[x+1]
+				dst[i+2] = row[x]
+			}
+		}
+	})
+
+	return out, nil
+}
+
+// DIBV5 converts img to a 32-bit bottom-up DIB with BGRA bitfields and
+// straight (non-premultiplied) alpha, which is what CF_DIBV5 readers expect.
+func DIBV5(img image.Image) ([]byte, error) {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	imageSize := width * 4 * height
+
+	header := BITMAPV5HEADER{
+		BITMAPINFOHEADER: BITMAPINFOHEADER{
+			Size:        124,
+			Width:       int32(width),
+			Height:      int32(height),
+			Planes:      1,
+			BitCount:    32,
+			Compression: biBitfields,
+			SizeImage:   uint32(imageSize),
+		},
+		RedMask:   0x00ff0000,
+		GreenMask: 0x0000ff00,
+		BlueMask:  0x000000ff,
+		AlphaMask: 0xff000000,
+		CSType:    lcsSRGB,
+		Intent:    lcsGMImages,
+	}
+
+	out := make([]byte, 124+imageSize)
+	binary.Encode(out, binary.LittleEndian, header)
+	pixels := out[124:]
+	stride := width * 4
+
+	// NRGBA already holds straight alpha; anything else goes through RGBA
+	// and is un-premultiplied per pixel.
+	if src, ok := img.(*image.NRGBA); ok {
+		parallelRows(height, func(y0, y1 int) {
+			for y := y0; y < y1; y++ {
+				off := src.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+				row := src.Pix[off : off+stride]
+				dst := pixels[(height-1-y)*stride : (height-y)*stride]
+				for x := 0; x < len(row); x += 4 {
+					dst[x] = row[x+2]
+					dst[x+1] = row[x+1]
+					dst[x+2] = row[x]
+					dst[x+3] = row[x+3]
+				}
+			}
+		})
+		return out, nil
+	}
+
+	src := toRGBA(img)
+	parallelRows(height, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			off := src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y+y)
+			row := src.Pix[off : off+stride]
+			dst := pixels[(height-1-y)*stride : (height-y)*stride]
+			for x := 0; x < len(row); x += 4 {
+				r, g, b, a := row[x], row[x+1], row[x+2], row[x+3]
+				if a != 0xff && a != 0 {
+					r, g, b = unpremultiply(r, a), unpremultiply(g, a), unpremultiply(b, a)
+				}
+				dst[x] = b
+				dst[x+1] = g
+				dst[x+2] = r
+				dst[x+3] = a
+			}
+		}
+	})
+	return out, nil
+}
+
+// unpremultiply matches color.NRGBAModel's rounding for 8-bit channels.
+func unpremultiply(c, a uint8) uint8 {
+	return uint8((uint32(c) * 0xffff / uint32(a)) >> 8)
+}
+
+// toRGBA returns img as an *image.RGBA, converting only when it is some
+// other type. Captures are already RGBA, so this is free on the hot path.
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// parallelRows splits rows [0, height) into bands and runs fn on each band
+// in its own goroutine, returning once all have finished.
+func parallelRows(height int, fn func(y0, y1 int)) {
+	bands := runtime.GOMAXPROCS(0)
+	if limit := height / minBandRows; bands > limit {
+		bands = limit
+	}
+	if bands <= 1 {
+		fn(0, height)
+		return
+	}
+
+	var wg sync.WaitGroup
+	per := (height + bands - 1) / bands
+	for y0 := 0; y0 < height; y0 += per {
+		y1 := min(y0+per, height)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(y0, y1)
+		}()
+	}
+	wg.Wait()
+}
+
+// BMP wraps a DIB produced by DIB in a BITMAPFILEHEADER.
+func BMP(dib []byte) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("BM")
+	binary.Write(buf, binary.LittleEndian, uint32(bmpHeaderSize+len(dib)))
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	binary.Write(buf, binary.LittleEndian, uint32(bmpHeaderSize+40))
+	buf.Write(dib)
+	return buf.Bytes()
+}
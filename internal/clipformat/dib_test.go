@@ -0,0 +1,359 @@
+package clipformat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func readInfoHeader(t *testing.T, data []byte) BITMAPINFOHEADER {
+	t.Helper()
+	var h BITMAPINFOHEADER
+	if _, err := binary.Decode(data, binary.LittleEndian, &h); err != nil {
+		t.Fatalf("decoding header: %v", err)
+	}
+	return h
+}
+
+func TestDIBHeader(t *testing.T) {
+	tests := []struct {
+		width, height int
+		rowSize       int
+	}{
+		{1, 1, 4},
+		{3, 2, 12},
+		{4, 3, 12},
+		{5, 1, 16},
+		{1920, 2, 5760},
+	}
+	for _, tt := range tests {
+		out, err := DIB(image.NewRGBA(image.Rect(0, 0, tt.width, tt.height)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := BITMAPINFOHEADER{
+			Size:        40,
+			Width:       int32(tt.width),
+			Height:      int32(tt.height),
+			Planes:      1,
+			BitCount:    24,
+			Compression: biRGB,
+			SizeImage:   uint32(tt.rowSize * tt.height),
+		}
+		if got := readInfoHeader(t, out); got != want {
+			t.Errorf("%dx%d: header = %+v, want %+v", tt.width, tt.height, got, want)
+		}
+		if len(out) != 40+tt.rowSize*tt.height {
+			t.Errorf("%dx%d: %d bytes, want %d", tt.width, tt.height, len(out), 40+tt.rowSize*tt.height)
+		}
+	}
+}
+
+func TestDIBPixels(t *testing.T) {
+	out, err := DIB(pattern())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pixels := out[40:]
+	// Rows are bottom-up BGR, padded to 4 bytes.
+	want := []byte{
+		0x30, 0x20, 0x10, 0x00, 0x20, 0x40, 0x00, 0x00, 0x00, 0, 0, 0,
+		0x00, 0x00, 0xff, 0x00, 0xff, 0x00, 0xff, 0x00, 0x00, 0, 0, 0,
+	}
+	if !bytes.Equal(pixels, want) {
+		t.Errorf("pixels = % x, want % x", pixels, want)
+	}
+	checkGolden(t, "dib.golden", out)
+}
+
+func TestDIBSubImage(t *testing.T) {
+	sub := pattern().SubImage(image.Rect(1, 1, 3, 2)).(*image.RGBA)
+	out, err := DIB(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := readInfoHeader(t, out); h.Width != 2 || h.Height != 1 {
+		t.Fatalf("header is %dx%d, want 2x1", h.Width, h.Height)
+	}
+	if want := []byte{0x00, 0x20, 0x40, 0x00, 0x00, 0x00, 0, 0}; !bytes.Equal(out[40:], want) {
+		t.Errorf("pixels = % x, want % x", out[40:], want)
+	}
+}
+
+func TestDIBV5Header(t *testing.T) {
+	for _, size := range []image.Point{{1, 1}, {3, 2}, {7, 5}} {
+		out, err := DIBV5(image.NewRGBA(image.Rectangle{Max: size}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got BITMAPV5HEADER
+		if _, err := binary.Decode(out, binary.LittleEndian, &got); err != nil {
+			t.Fatal(err)
+		}
+		want := BITMAPV5HEADER{
+			BITMAPINFOHEADER: BITMAPINFOHEADER{
+				Size:        124,
+				Width:       int32(size.X),
+				Height:      int32(size.Y),
+				Planes:      1,
+				BitCount:    32,
+				Compression: biBitfields,
+				SizeImage:   uint32(size.X * size.Y * 4),
+			},
+			RedMask:   0x00ff0000,
+			GreenMask: 0x0000ff00,
+			BlueMask:  0x000000ff,
+			AlphaMask: 0xff000000,
+			CSType:    lcsSRGB,
+			Intent:    lcsGMImages,
+		}
+		if got != want {
+			t.Errorf("%v: header = %+v, want %+v", size, got, want)
+		}
+		if len(out) != 124+size.X*size.Y*4 {
+			t.Errorf("%v: %d bytes, want %d", size, len(out), 124+size.X*size.Y*4)
+		}
+	}
+}
+
+func TestDIBV5Pixels(t *testing.T) {
+	// Bottom-up BGRA with straight alpha: the premultiplied 0x40 red at half
+	// alpha becomes 0x7f.
+	want := []byte{
+		0x30, 0x20, 0x10, 0xff, 0x00, 0x3f, 0x7f, 0x80, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0xff, 0xff, 0x00, 0xff, 0x00, 0xff, 0xff, 0x00, 0x00, 0xff,
+	}
+
+	rgba := pattern()
+	nrgba := image.NewNRGBA(rgba.Rect)
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			nrgba.Set(x, y, rgba.At(x, y))
+		}
+	}
+
+	for _, tt := range []struct {
+		name string
+		img  image.Image
+	}{
+		{"RGBA", rgba},
+		{"NRGBA", nrgba},
+		{"Paletted", paletted(rgba)},
+	} {
+		out, err := DIBV5(tt.img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out[124:], want) {
+			t.Errorf("%s: pixels = % x, want % x", tt.name, out[124:], want)
+		}
+		if tt.name == "RGBA" {
+			checkGolden(t, "dibv5.golden", out)
+		}
+	}
+}
+
+// paletted copies img into an image type that DIBV5 has no fast path for.
+func paletted(img *image.RGBA) *image.Paletted {
+	var palette color.Palette
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			palette = append(palette, img.At(x, y))
+		}
+	}
+	p := image.NewPaletted(img.Rect, palette)
+	for i := range p.Pix {
+		p.Pix[i] = uint8(i)
+	}
+	return p
+}
+
+func TestBMP(t *testing.T) {
+	dib, err := DIB(pattern())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := BMP(dib)
+
+	var header struct {
+		Magic    [2]byte
+		FileSize uint32
+		Reserved uint32
+		Offset   uint32
+	}
+	if _, err := binary.Decode(out, binary.LittleEndian, &header); err != nil {
+		t.Fatal(err)
+	}
+	if string(header.Magic[:]) != "BM" || header.FileSize != uint32(len(out)) || header.Reserved != 0 || header.Offset != 54 {
+		t.Errorf("file header = %+v, want BM, %d bytes, pixels at 54", header, len(out))
+	}
+	if !bytes.Equal(out[14:], dib) {
+		t.Error("BMP does not hold the DIB after its file header")
+	}
+}
+
+// dibAt and dibV5At are the straightforward per-pixel At conversions that
+// DIB and DIBV5 replace; the fast paths must produce exactly their bytes.
+func dibAt(img image.Image) []byte {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	rowSize := ((width*3 + 3) / 4) * 4
+
+	out := make([]byte, 40+rowSize*height)
+	binary.Encode(out, binary.LittleEndian, BITMAPINFOHEADER{
+		Size: 40, Width: int32(width), Height: int32(height), Planes: 1,
+		BitCount: 24, Compression: biRGB, SizeImage: uint32(rowSize * height),
+	})
+	pixels := out[40:]
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			offset := (height-1-y)*rowSize + x*3
+			pixels[offset] = byte(b >> 8)
+			pixels[offset+1] = byte(g >> 8)
+			pixels[offset+2] = byte(r >> 8)
+		}
+	}
+	return out
+}
+
+func dibV5At(img image.Image) []byte {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	out := make([]byte, 124+width*height*4)
+	binary.Encode(out, binary.LittleEndian, BITMAPV5HEADER{
+		BITMAPINFOHEADER: BITMAPINFOHEADER{
+			Size: 124, Width: int32(width), Height: int32(height), Planes: 1,
+			BitCount: 32, Compression: biBitfields, SizeImage: uint32(width * height * 4),
+		},
+		RedMask: 0x00ff0000, GreenMask: 0x0000ff00, BlueMask: 0x000000ff, AlphaMask: 0xff000000,
+		CSType: lcsSRGB, Intent: lcsGMImages,
+	})
+	pixels := out[124:]
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			offset := (height-1-y)*width*4 + x*4
+			pixels[offset] = c.B
+			pixels[offset+1] = c.G
+			pixels[offset+2] = c.R
+			pixels[offset+3] = c.A
+		}
+	}
+	return out
+}
+
+// randomRGBA fills an image with valid premultiplied pixels, a quarter of
+// them translucent and some fully transparent.
+func randomRGBA(w, h int) *image.RGBA {
+	rng := rand.New(rand.NewSource(int64(w*h + 1)))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		a := 0xff
+		if rng.Intn(4) == 0 {
+			a = rng.Intn(0x100)
+		}
+		for c := 0; c < 3; c++ {
+			img.Pix[i+c] = uint8(rng.Intn(a + 1))
+		}
+		img.Pix[i+3] = uint8(a)
+	}
+	return img
+}
+
+func TestDIBMatchesAt(t *testing.T) {
+	big := randomRGBA(301, 257) // enough rows to convert in parallel bands
+	images := map[string]image.Image{
+		"1x1":      randomRGBA(1, 1),
+		"odd":      randomRGBA(7, 5),
+		"parallel": big,
+		"subimage": big.SubImage(image.Rect(13, 17, 290, 250)),
+		"nrgba":    nrgbaOf(big),
+		"gray":     grayOf(big),
+	}
+	for name, img := range images {
+		got, err := DIB(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := dibAt(img); !bytes.Equal(got, want) {
+			t.Errorf("%s: DIB differs from the At conversion", name)
+		}
+
+		got, err = DIBV5(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := dibV5At(img); !bytes.Equal(got, want) {
+			t.Errorf("%s: DIBV5 differs from the At conversion", name)
+		}
+	}
+}
+
+func nrgbaOf(img *image.RGBA) *image.NRGBA {
+	out := image.NewNRGBA(img.Rect)
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			out.Set(x, y, img.At(x, y))
+		}
+	}
+	return out
+}
+
+func grayOf(img *image.RGBA) *image.Gray {
+	out := image.NewGray(img.Rect)
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			out.Set(x, y, img.At(x, y))
+		}
+	}
+	return out
+}
+
+var benchSizes = []struct {
+	name          string
+	width, height int
+}{
+	{"1080p", 1920, 1080},
+	{"1440p", 2560, 1440},
+	{"4K", 3840, 2160},
+}
+
+func benchmarkConvert(b *testing.B, convert func(image.Image) []byte) {
+	for _, size := range benchSizes {
+		img := randomRGBA(size.width, size.height)
+		b.Run(size.name, func(b *testing.B) {
+			b.SetBytes(int64(len(img.Pix)))
+			b.ReportAllocs()
+			for range b.N {
+				convert(img)
+			}
+		})
+	}
+}
+
+func BenchmarkDIBAt(b *testing.B) {
+	benchmarkConvert(b, dibAt)
+}
+
+func BenchmarkDIBPix(b *testing.B) {
+	benchmarkConvert(b, func(img image.Image) []byte {
+		out, _ := DIB(img)
+		return out
+	})
+}
+
+func BenchmarkDIBV5At(b *testing.B) {
+	benchmarkConvert(b, dibV5At)
+}
+
+func BenchmarkDIBV5Pix(b *testing.B) {
+	benchmarkConvert(b, func(img image.Image) []byte {
+		out, _ := DIBV5(img)
+		return out
+	})
+}
@@ -0,0 +1,59 @@
+package clipformat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// dropFilesSize is sizeof(DROPFILES): pFiles, pt.x, pt.y, fNC, fWide.
+const dropFilesSize = 20
+
+// DropFiles returns a CF_HDROP payload: a DROPFILES header followed by the
+// paths as NUL-terminated UTF-16 strings and a final NUL.
+func DropFiles(paths []string) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, [5]uint32{dropFilesSize, 0, 0, 0, 1})
+
+	for _, p := range paths {
+		binary.Write(buf, binary.LittleEndian, utf16.Encode([]rune(p)))
+		binary.Write(buf, binary.LittleEndian, uint16(0))
+	}
+	binary.Write(buf, binary.LittleEndian, uint16(0))
+	return buf.Bytes()
+}
+
+// FileURI returns the file:// URI for an absolute path.
+func FileURI(path string) string {
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	if !strings.HasPrefix(u.Path, "/") {
+		// Windows drive paths become file:///C:/...
+		u.Path = "/" + u.Path
+	}
+	return u.String()
+}
+
+// URIList returns a text/uri-list payload (RFC 2483) for paths.
+func URIList(paths []string) []byte {
+	var b strings.Builder
+	for _, p := range paths {
+		b.WriteString(FileURI(p))
+		b.WriteString("\r\n")
+	}
+	return []byte(b.String())
+}
+
+// GnomeCopiedFiles returns the x-special/gnome-copied-files payload that GTK
+// file managers read to paste files.
+func GnomeCopiedFiles(paths []string) []byte {
+	var b strings.Builder
+	b.WriteString("copy")
+	for _, p := range paths {
+		b.WriteString("\n")
+		b.WriteString(FileURI(p))
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,87 @@
+package clipformat
+
+import (
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestDropFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+	}{
+		{"none", nil},
+		{"one", []string{`C:\Users\me\Pictures\SnapHook\shot.png`}},
+		{"two", []string{`C:\a.png`, `D:\b c\d.png`}},
+		{"unicode", []string{"C:\\Bilder\\Schnappschuss \u00fc\U0001F4F8.png"}},
+	}
+	for _, tt := range tests {
+		data := DropFiles(tt.paths)
+
+		// DROPFILES: pFiles, pt.x, pt.y, fNC, fWide.
+		var header [5]uint32
+		if _, err := binary.Decode(data, binary.LittleEndian, &header); err != nil {
+			t.Fatal(err)
+		}
+		if want := [5]uint32{20, 0, 0, 0, 1}; header != want {
+			t.Errorf("%s: DROPFILES = %v, want %v", tt.name, header, want)
+		}
+
+		units := make([]uint16, (len(data)-dropFilesSize)/2)
+		if _, err := binary.Decode(data[dropFilesSize:], binary.LittleEndian, units); err != nil {
+			t.Fatal(err)
+		}
+		if len(data)%2 != 0 || len(units) == 0 || units[len(units)-1] != 0 {
+			t.Fatalf("%s: list does not end in a NUL: % x", tt.name, data[dropFilesSize:])
+		}
+		var got []string
+		start := 0
+		for i, u := range units[:len(units)-1] {
+			if u == 0 {
+				got = append(got, string(utf16.Decode(units[start:i])))
+				start = i + 1
+			}
+		}
+		if start != len(units)-1 {
+			t.Errorf("%s: unterminated path at the end of the list", tt.name)
+		}
+		if len(got) != len(tt.paths) {
+			t.Fatalf("%s: paths = %q, want %q", tt.name, got, tt.paths)
+		}
+		for i := range got {
+			if got[i] != tt.paths[i] {
+				t.Errorf("%s: path %d = %q, want %q", tt.name, i, got[i], tt.paths[i])
+			}
+		}
+	}
+}
+
+func TestDropFilesGolden(t *testing.T) {
+	checkGolden(t, "hdrop.golden", DropFiles([]string{`C:\Pictures\a.png`, "C:\\Bilder\\\u00fc.png"}))
+}
+
+func TestFileURI(t *testing.T) {
+	for _, tt := range []struct {
+		path, want string
+	}{
+		{"/home/me/shot.png", "file:///home/me/shot.png"},
+		{"/tmp/a b#1%.png", "file:///tmp/a%20b%231%25.png"},
+		{"/tmp/\u00fc.png", "file:///tmp/%C3%BC.png"},
+		{"C:/Users/me/shot.png", "file:///C:/Users/me/shot.png"},
+	} {
+		if got := FileURI(tt.path); got != tt.want {
+			t.Errorf("FileURI(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFileLists(t *testing.T) {
+	paths := []string{"/tmp/a.png", "/tmp/b c.png"}
+	if got, want := string(URIList(paths)), "file:///tmp/a.png\r\nfile:///tmp/b%20c.png\r\n"; got != want {
+		t.Errorf("URIList = %q, want %q", got, want)
+	}
+	if got, want := string(GnomeCopiedFiles(paths)), "copy\nfile:///tmp/a.png\nfile:///tmp/b%20c.png"; got != want {
+		t.Errorf("GnomeCopiedFiles = %q, want %q", got, want)
+	}
+}
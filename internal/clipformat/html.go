@@ -0,0 +1,46 @@
+package clipformat
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+const (
+	startFragment = "<!--StartFragment-->"
+	endFragment   = "<!--EndFragment-->"
+)
+
+// HTMLFragment returns an <img> tag with pngData inlined as a data URI.
+func HTMLFragment(pngData []byte) string {
+	return `<img src="data:image/png;base64,` + base64.StdEncoding.EncodeToString(pngData) + `">`
+}
+
+// CFHTML wraps fragment in the Windows "HTML Format" envelope: a header of
+// byte offsets followed by a document with the fragment between
+// StartFragment/EndFragment comments.
+func CFHTML(fragment string) []byte {
+	// Offsets are zero-padded to a fixed width so the header length does not
+	// depend on the values written into it.
+	const headerFormat = "Version:0.9\r\n" +
+		"StartHTML:%010d\r\n" +
+		"EndHTML:%010d\r\n" +
+		"StartFragment:%010d\r\n" +
+		"EndFragment:%010d\r\n"
+
+	prefix := "<html><body>\r\n" + startFragment
+	suffix := endFragment + "\r\n</body></html>"
+
+	headerLen := len(fmt.Sprintf(headerFormat, 0, 0, 0, 0))
+	startHTML := headerLen
+	startFrag := startHTML + len(prefix)
+	endFrag := startFrag + len(fragment)
+	endHTML := endFrag + len(suffix)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, headerFormat, startHTML, endHTML, startFrag, endFrag)
+	b.WriteString(prefix)
+	b.WriteString(fragment)
+	b.WriteString(suffix)
+	return []byte(b.String())
+}
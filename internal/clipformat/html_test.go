@@ -0,0 +1,90 @@
+package clipformat
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var cfhtmlHeader = regexp.MustCompile(`^Version:0\.9\r\nStartHTML:(\d{10})\r\nEndHTML:(\d{10})\r\nStartFragment:(\d{10})\r\nEndFragment:(\d{10})\r\n`)
+
+// cfhtmlOffsets parses the StartHTML, EndHTML, StartFragment and EndFragment
+// byte offsets.
+func cfhtmlOffsets(t *testing.T, data []byte) [4]int {
+	t.Helper()
+	m := cfhtmlHeader.FindSubmatch(data)
+	if m == nil {
+		t.Fatalf("malformed header in %q", data)
+	}
+	var offsets [4]int
+	for i := range offsets {
+		offsets[i], _ = strconv.Atoi(string(m[i+1]))
+	}
+	return offsets
+}
+
+func TestCFHTMLOffsets(t *testing.T) {
+	tests := []struct {
+		name     string
+		fragment string
+	}{
+		{"empty", ""},
+		{"img", `<img src="data:image/png;base64,iVBORw0KGgo=">`},
+		// Offsets count bytes, not characters.
+		{"utf8", "<p>caf\u00e9 \u65e5\u672c \U0001F4F8</p>"},
+		{"large", strings.Repeat("x", 100000)},
+	}
+	for _, tt := range tests {
+		data := CFHTML(tt.fragment)
+		o := cfhtmlOffsets(t, data)
+		startHTML, endHTML, startFrag, endFrag := o[0], o[1], o[2], o[3]
+
+		if headerLen := len(cfhtmlHeader.Find(data)); startHTML != headerLen {
+			t.Errorf("%s: StartHTML = %d, want %d, the end of the header", tt.name, startHTML, headerLen)
+		}
+		if endHTML != len(data) {
+			t.Errorf("%s: EndHTML = %d, want %d", tt.name, endHTML, len(data))
+		}
+		if !(startHTML <= startFrag && startFrag <= endFrag && endFrag <= endHTML) {
+			t.Fatalf("%s: offsets out of order: %v", tt.name, o)
+		}
+		if got := string(data[startFrag:endFrag]); got != tt.fragment {
+			t.Errorf("%s: fragment = %q, want %q", tt.name, got, tt.fragment)
+		}
+		if !strings.HasPrefix(string(data[startHTML:]), "<html>") {
+			t.Errorf("%s: StartHTML does not point at <html>", tt.name)
+		}
+		if !strings.HasSuffix(string(data[:startFrag]), startFragment) {
+			t.Errorf("%s: StartFragment does not follow %s", tt.name, startFragment)
+		}
+		if !strings.HasPrefix(string(data[endFrag:]), endFragment) {
+			t.Errorf("%s: EndFragment does not precede %s", tt.name, endFragment)
+		}
+	}
+}
+
+func TestCFHTMLGolden(t *testing.T) {
+	checkGolden(t, "cfhtml.golden", CFHTML(HTMLFragment([]byte("\x89PNG\r\n\x1a\n"))))
+}
+
+func TestHTMLFragment(t *testing.T) {
+	for _, tt := range []struct {
+		png  []byte
+		want string
+	}{
+		{nil, `<img src="data:image/png;base64,">`},
+		{[]byte("\x89PNG"), `<img src="data:image/png;base64,iVBORw==">`},
+	} {
+		if got := HTMLFragment(tt.png); got != tt.want {
+			t.Errorf("HTMLFragment(%q) = %s, want %s", tt.png, got, tt.want)
+		}
+	}
+}
+
+func ExampleCFHTML() {
+	fmt.Printf("%q\n", CFHTML("<b>hi</b>"))
+	// Output:
+	// "Version:0.9\r\nStartHTML:0000000105\r\nEndHTML:0000000182\r\nStartFragment:0000000139\r\nEndFragment:0000000148\r\n<html><body>\r\n<!--StartFragment--><b>hi</b><!--EndFragment-->\r\n</body></html>"
+}
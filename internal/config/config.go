@@ -2,8 +2,12 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func Load() (*Config, error) {
@@ -12,6 +16,9 @@ func Load() (*Config, error) {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		defaultConfig := &Config{
 			Hotkey:          "Ctrl+Shift+S",
+			CaptureMode:     "monitor",
+			GapColor:        "#000000",
+			WindowFrame:     true,
 			AutoSave:        false,
 			CopyToClipboard: true,
 		}
@@ -23,7 +30,9 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
-	var cfg Config
+	// Keys missing from the file keep these values, so configs written before
+	// an option existed get its default rather than the zero value.
+	cfg := Config{WindowFrame: true}
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		return nil, err
 	}
@@ -47,16 +56,121 @@ func Save(cfg *Config) error {
 }
 
 func getConfigPath() string {
-	homeDir, _ := os.UserHomeDir()
-	return filepath.Join(homeDir, ".config", "snaphook", "config.json")
+	return filepath.Join(Dir(), "config.json")
 }
 
-func GetAutoSaveDir() string {
+// Dir is the folder holding config.json and SnapHook's other state.
+func Dir() string {
 	homeDir, _ := os.UserHomeDir()
-	return filepath.Join(homeDir, "Pictures", "SnapHook")
+	return filepath.Join(homeDir, ".config", "snaphook")
+}
+
+// HistoryPath is the capture history index.
+func HistoryPath() string {
+	return filepath.Join(Dir(), "history.jsonl")
+}
+
+// PreviewTokenPath holds the preview server's session token for scripts
+// that call its API.
+func PreviewTokenPath() string {
+	return filepath.Join(Dir(), "preview-token")
 }
 
-func EnsureAutoSaveDir() error {
-	dir := GetAutoSaveDir()
-	return os.MkdirAll(dir, 0755)
+// PreviewURLPath holds the address the preview server is running on, which
+// changes if its port was taken.
+func PreviewURLPath() string {
+	return filepath.Join(Dir(), "preview-url")
+}
+
+// SavePreviewToken writes token to PreviewTokenPath, readable only by the
+// user.
+func SavePreviewToken(token string) error {
+	return writeStateFile(PreviewTokenPath(), token)
+}
+
+// SavePreviewURL writes url to PreviewURLPath.
+func SavePreviewURL(url string) error {
+	return writeStateFile(PreviewURLPath(), url)
+}
+
+func writeStateFile(path, content string) error {
+	if err := os.MkdirAll(Dir(), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content+"\n"), 0600)
+}
+
+// GetAutoSaveDir resolves the configured save_dir, expanding ~ and
+// environment variables. An empty setting means a SnapHook folder inside the
+// user's Pictures folder.
+func GetAutoSaveDir(configured string) string {
+	if strings.TrimSpace(configured) == "" {
+		return filepath.Join(picturesDir(), "SnapHook")
+	}
+
+	dir := ExpandPath(strings.TrimSpace(configured))
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return dir
+}
+
+// EnsureAutoSaveDir creates dir if needed and checks that files can be
+// written to it.
+func EnsureAutoSaveDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cannot create auto-save folder %s: %w", dir, err)
+	}
+	return checkWritableDir(dir, dir)
+}
+
+// CheckAutoSaveDir checks that EnsureAutoSaveDir would accept dir without
+// creating anything: dir, or the nearest folder above it that exists, must
+// be a writable folder.
+func CheckAutoSaveDir(dir string) error {
+	existing := filepath.Clean(dir)
+	for {
+		_, err := os.Stat(existing)
+		if err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if !errors.Is(err, fs.ErrNotExist) || parent == existing {
+			return fmt.Errorf("cannot access auto-save folder %s: %w", dir, err)
+		}
+		existing = parent
+	}
+	return checkWritableDir(dir, existing)
+}
+
+// checkWritableDir checks that path, which is the auto-save folder dir or
+// the folder it would be created in, is a folder that files can be written
+// to.
+func checkWritableDir(dir, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("cannot access auto-save folder %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("auto-save folder %s: %s is not a folder", dir, path)
+	}
+
+	probe, err := os.CreateTemp(path, ".snaphook-write-test-*")
+	if err != nil {
+		return fmt.Errorf("auto-save folder %s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
+
+// ExpandPath expands a leading ~ to the home directory and $VAR or ${VAR}
+// references to environment variables.
+func ExpandPath(path string) string {
+	path = os.ExpandEnv(path)
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, `~\`) {
+		homeDir, _ := os.UserHomeDir()
+		path = filepath.Join(homeDir, path[1:])
+	}
+	return path
 }
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("SHOTS", "screens")
+
+	tests := []struct {
+		in, want string
+	}{
+		{"~", home},
+		{"~/Pictures", filepath.Join(home, "Pictures")},
+		{"$HOME/x", home + "/x"},
+		{"${SHOTS}/today", "screens/today"},
+		{"~user/x", "~user/x"},
+		{"a/~/b", "a/~/b"},
+	}
+	for _, tt := range tests {
+		if got := ExpandPath(tt.in); got != tt.want {
+			t.Errorf("ExpandPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGetAutoSaveDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	cwd := t.TempDir()
+	t.Chdir(cwd)
+	// t.TempDir may be behind a symlink; Abs uses the path as given.
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		in, want string
+	}{
+		{"~/Shots", filepath.Join(home, "Shots")},
+		{"  ~/Shots  ", filepath.Join(home, "Shots")},
+		{"shots", filepath.Join(cwd, "shots")},
+		{"./a/../b", filepath.Join(cwd, "b")},
+		{filepath.Join(home, "abs"), filepath.Join(home, "abs")},
+	}
+	for _, tt := range tests {
+		if got := GetAutoSaveDir(tt.in); got != tt.want {
+			t.Errorf("GetAutoSaveDir(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	if got := GetAutoSaveDir(" "); filepath.Base(got) != "SnapHook" || !filepath.IsAbs(got) {
+		t.Errorf("GetAutoSaveDir of an empty setting = %q, want a SnapHook folder in Pictures", got)
+	}
+}
+
+func TestEnsureAutoSaveDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a", "b")
+	if err := EnsureAutoSaveDir(dir); err != nil {
+		t.Fatalf("EnsureAutoSaveDir: %v", err)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Fatalf("the folder was not created: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("the write probe was left behind: %v", entries)
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnsureAutoSaveDir(file); err == nil || !strings.Contains(err.Error(), file) {
+		t.Errorf("EnsureAutoSaveDir on a file = %v, want an error naming it", err)
+	}
+}
+
+func TestCheckAutoSaveDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "a", "b")
+	if err := CheckAutoSaveDir(dir); err != nil {
+		t.Fatalf("CheckAutoSaveDir on a folder that can be created: %v", err)
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Errorf("CheckAutoSaveDir left %v behind", entries)
+	}
+	if err := CheckAutoSaveDir(root); err != nil {
+		t.Errorf("CheckAutoSaveDir on an existing folder: %v", err)
+	}
+
+	file := filepath.Join(root, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{file, filepath.Join(file, "sub")} {
+		if err := CheckAutoSaveDir(bad); err == nil || !strings.Contains(err.Error(), bad) {
+			t.Errorf("CheckAutoSaveDir(%s) = %v, want an error naming it", bad, err)
+		}
+	}
+}
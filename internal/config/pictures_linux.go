@@ -0,0 +1,57 @@
+//go:build linux
+
+package config
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// picturesDir follows the XDG user-dirs spec: XDG_PICTURES_DIR from the
+// environment, then from user-dirs.dirs, then ~/Pictures.
+func picturesDir() string {
+	if dir := os.Getenv("XDG_PICTURES_DIR"); dir != "" {
+		return ExpandPath(dir)
+	}
+
+	homeDir, _ := os.UserHomeDir()
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(homeDir, ".config")
+	}
+
+	if dir := readUserDir(filepath.Join(configHome, "user-dirs.dirs"), "XDG_PICTURES_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(homeDir, "Pictures")
+}
+
+// readUserDir returns key from a user-dirs.dirs file, whose lines look like
+// XDG_PICTURES_DIR="$HOME/Pictures".
+func readUserDir(path, key string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || strings.HasPrefix(line, "#") || strings.TrimSpace(name) != key {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(strings.TrimSpace(value)); err == nil {
+			value = unquoted
+		}
+		if value == "" {
+			return ""
+		}
+		return ExpandPath(value)
+	}
+	return ""
+}
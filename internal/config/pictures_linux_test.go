@@ -0,0 +1,68 @@
+//go:build linux
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPicturesDir(t *testing.T) {
+	home := t.TempDir()
+	configHome := filepath.Join(home, "conf")
+	if err := os.MkdirAll(configHome, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+
+	t.Setenv("XDG_PICTURES_DIR", "")
+	if got, want := picturesDir(), filepath.Join(home, "Pictures"); got != want {
+		t.Errorf("without user-dirs.dirs: %q, want %q", got, want)
+	}
+
+	dirs := `# written by xdg-user-dirs-update
+XDG_DESKTOP_DIR="$HOME/Desktop"
+XDG_PICTURES_DIR="$HOME/Bilder"
+`
+	if err := os.WriteFile(filepath.Join(configHome, "user-dirs.dirs"), []byte(dirs), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := picturesDir(), filepath.Join(home, "Bilder"); got != want {
+		t.Errorf("from user-dirs.dirs: %q, want %q", got, want)
+	}
+	if got, want := GetAutoSaveDir(""), filepath.Join(home, "Bilder", "SnapHook"); got != want {
+		t.Errorf("GetAutoSaveDir(\"\") = %q, want %q", got, want)
+	}
+
+	// The environment wins over the file.
+	t.Setenv("XDG_PICTURES_DIR", "~/Fotos")
+	if got, want := picturesDir(), filepath.Join(home, "Fotos"); got != want {
+		t.Errorf("from XDG_PICTURES_DIR: %q, want %q", got, want)
+	}
+	if got, want := GetAutoSaveDir(""), filepath.Join(home, "Fotos", "SnapHook"); got != want {
+		t.Errorf("GetAutoSaveDir(\"\") = %q, want %q", got, want)
+	}
+}
+
+func TestReadUserDir(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	path := filepath.Join(t.TempDir(), "user-dirs.dirs")
+	content := `XDG_PICTURES_DIR_OLD="$HOME/Old"
+# XDG_PICTURES_DIR="$HOME/Commented"
+  XDG_PICTURES_DIR = "$HOME/My Pictures"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := readUserDir(path, "XDG_PICTURES_DIR"); got != "/home/me/My Pictures" {
+		t.Errorf("readUserDir = %q", got)
+	}
+	if got := readUserDir(path, "XDG_MUSIC_DIR"); got != "" {
+		t.Errorf("readUserDir of a missing key = %q", got)
+	}
+	if got := readUserDir(filepath.Join(t.TempDir(), "none"), "XDG_PICTURES_DIR"); got != "" {
+		t.Errorf("readUserDir of a missing file = %q", got)
+	}
+}
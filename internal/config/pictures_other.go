@@ -0,0 +1,13 @@
+//go:build !linux
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+func picturesDir() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, "Pictures")
+}
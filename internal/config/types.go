@@ -1,8 +1,93 @@
 package config
 
 type Config struct {
-	Hotkey          string `json:"hotkey"`
-	AutoSave        bool   `json:"auto_save"`
-	CopyToClipboard bool   `json:"copy_to_clipboard"`
-	EnablePreview   bool   `json:"enable_preview"`
+	Hotkey        string    `json:"hotkey"`
+	Bindings      []Binding `json:"bindings"`
+	CaptureMode   string    `json:"capture_mode"`
+	CaptureDelay  int       `json:"capture_delay"`
+	GapColor      string    `json:"gap_color"`
+	SplitDisplays bool      `json:"split_displays"`
+	WindowFrame   bool      `json:"window_frame"`
+	WindowShadow  bool      `json:"window_shadow"`
+	AutoSave      bool      `json:"auto_save"`
+	// SaveDir is the auto-save folder; ~ and $VARS are expanded. Empty means
+	// Pictures/SnapHook.
+	SaveDir string `json:"save_dir,omitempty"`
+	// FilenameTemplate names auto-saved files; see package nametemplate.
+	FilenameTemplate string `json:"filename_template,omitempty"`
+	CopyToClipboard  bool   `json:"copy_to_clipboard"`
+	EnablePreview    bool   `json:"enable_preview"`
+	// PreviewAddress is the host or IP address the preview server listens
+	// on. Empty means 127.0.0.1, so only this machine can reach it.
+	PreviewAddress string `json:"preview_address,omitempty"`
+	// PreviewPort is the port to try first; 0 means 8765. If it is taken,
+	// the preview falls back to a free port.
+	PreviewPort int              `json:"preview_port,omitempty"`
+	PreviewTLS  PreviewTLSConfig `json:"preview_tls"`
+
+	// Each sink encodes independently; an empty format is a fast PNG.
+	SaveFormat      OutputFormat `json:"save_format"`
+	PreviewFormat   OutputFormat `json:"preview_format"`
+	ClipboardFormat OutputFormat `json:"clipboard_format"`
+
+	Retention  RetentionConfig `json:"retention"`
+	Duplicates DuplicateConfig `json:"duplicates"`
+}
+
+// PreviewTLSConfig serves the preview over HTTPS when Enabled. CertFile and
+// KeyFile name a certificate of the user's own; without them SnapHook issues
+// one from a local CA kept in the config folder, valid for localhost, the
+// loopback addresses, PreviewAddress and Hostnames.
+type PreviewTLSConfig struct {
+	Enabled   bool     `json:"enabled"`
+	Hostnames []string `json:"hostnames,omitempty"`
+	CertFile  string   `json:"cert_file,omitempty"`
+	KeyFile   string   `json:"key_file,omitempty"`
+}
+
+// DuplicateConfig decides what happens to a capture whose perceptual hash
+// is within MaxDistance bits of the last one kept of the same area; 0 means
+// the hashes must match. Action is "mark" (the default: save and show it as
+// usual but flag it in the history), "skip" (copy it to the clipboard but do
+// not save, show or record it) or "off".
+type DuplicateConfig struct {
+	Action      string `json:"action,omitempty"`
+	MaxDistance int    `json:"max_distance,omitempty"`
+}
+
+// RetentionConfig limits the temp files written for file-paste targets and
+// the saved screenshots, which are the auto-saved files the capture history
+// records. Other files in the auto-save folder are never touched, and pinned
+// shots are always kept. Deleting a saved file also deletes its history
+// entry. Without the history, saved files are not pruned at all. Interval is
+// how often the limits are applied, as a Go duration; the default is 1h.
+type RetentionConfig struct {
+	Temp     RetentionPolicy `json:"temp"`
+	Saved    RetentionPolicy `json:"saved"`
+	Interval string          `json:"interval,omitempty"`
+}
+
+// RetentionPolicy limits files by MaxAge (e.g. "24h" or "30d"), MaxCount and
+// MaxBytes (e.g. "500MB"), removing the oldest first. Empty fields are no
+// limit; an entirely empty temp policy keeps temp files for 24h.
+type RetentionPolicy struct {
+	MaxAge   string `json:"max_age,omitempty"`
+	MaxCount int    `json:"max_count,omitempty"`
+	MaxBytes string `json:"max_bytes,omitempty"`
+}
+
+// OutputFormat selects how a sink encodes screenshots. Format is "png",
+// "jpeg" or "qoi"; PNGLevel is "none", "fast", "default" or "best"; and
+// JPEGQuality runs from 1 to 100.
+type OutputFormat struct {
+	Format      string `json:"format,omitempty"`
+	PNGLevel    string `json:"png_level,omitempty"`
+	JPEGQuality int    `json:"jpeg_quality,omitempty"`
+}
+
+// Binding is an extra hotkey that always runs one capture action (a capture
+// mode such as "region"), independent of the tray's capture mode.
+type Binding struct {
+	Hotkey string `json:"hotkey"`
+	Action string `json:"action"`
 }
@@ -0,0 +1,522 @@
+// Package history keeps a durable record of captures in an append-only
+// index file of JSON lines. Each line adds an entry, replaces an entry's
+// tags, pins or unpins it, or deletes it, so a write never rewrites earlier
+// data and a crash can lose at most the line being written. Several
+// processes (SnapHook and the snaphook-history CLI) may share one file: every
+// call first reads whatever others appended, and a file replaced by Compact
+// is reloaded. Writers take a lock file next to the index, so a line cannot
+// be appended to a file Compact is about to replace.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"snaphook/internal/captureid"
+)
+
+// ErrNotFound is returned for an ID that is not in the index.
+var ErrNotFound = errors.New("no such history entry")
+
+// Entry describes one capture.
+type Entry struct {
+	// ID is the capture's ID from package captureid.
+	ID string `json:"id"`
+	// Path is the auto-saved file, or empty if the capture was not saved.
+	Path string    `json:"path,omitempty"`
+	Time time.Time `json:"time"`
+	Mode string    `json:"mode"`
+	// Monitor is the 0-based display index, or -1 for several displays.
+	Monitor int   `json:"monitor"`
+	Width   int   `json:"width"`
+	Height  int   `json:"height"`
+	Size    int64 `json:"size,omitempty"`
+	// Hash is the hex SHA-256 of the captured pixels.
+	Hash string `json:"hash"`
+	// PHash is the hex perceptual (difference) hash; see package phash.
+	PHash string `json:"phash,omitempty"`
+	// Duplicate marks a capture that looked the same as the one before it,
+	// DuplicateOf. That capture may be missing if it was not recorded.
+	Duplicate   bool     `json:"duplicate,omitempty"`
+	DuplicateOf string   `json:"duplicate_of,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// Pinned entries are exempt from retention policies.
+	Pinned bool `json:"pinned,omitempty"`
+}
+
+func (e Entry) clone() Entry {
+	e.Tags = slices.Clone(e.Tags)
+	return e
+}
+
+// HasTag reports whether e carries tag.
+func (e Entry) HasTag(tag string) bool {
+	return slices.Contains(e.Tags, tag)
+}
+
+const (
+	opAdd    = "add"
+	opTags   = "tags"
+	opPin    = "pin"
+	opDelete = "delete"
+)
+
+type record struct {
+	Op     string   `json:"op"`
+	Entry  *Entry   `json:"entry,omitempty"`
+	ID     string   `json:"id,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	Pinned bool     `json:"pinned,omitempty"`
+}
+
+// Store is an open index file.
+type Store struct {
+	path string
+
+	mu      sync.Mutex
+	entries []Entry        // in the order they were added
+	index   map[string]int // entry ID to position in entries
+	offset  int64          // bytes of the file applied so far
+	file    os.FileInfo
+	dead    int // lines that no longer describe a live entry
+}
+
+// Open loads the index at path, creating its folder if needed. A missing
+// file is an empty history. An index that is mostly deleted or superseded
+// lines is compacted.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history folder: %w", err)
+	}
+
+	s := &Store{path: path}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	if s.dead > 100 && s.dead > len(s.entries) {
+		if err := s.write(s.compact); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Path returns the index file's path.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Add records e and returns it as stored. An entry without an ID is given a
+// new one; an ID already in the index is an error.
+func (s *Store) Add(e Entry) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e = e.clone()
+	err := s.write(func() error {
+		if e.ID == "" {
+			e.ID = captureid.New(e.Time)
+		} else if _, ok := s.index[e.ID]; ok {
+			return fmt.Errorf("history entry %s already exists", e.ID)
+		}
+		e.Tags = normalizeTags(e.Tags)
+		return s.append(record{Op: opAdd, Entry: &e})
+	})
+	if err != nil {
+		return Entry{}, err
+	}
+	return e.clone(), nil
+}
+
+// Get returns the entry with the given ID.
+func (s *Store) Get(id string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refresh(); err != nil {
+		return Entry{}, err
+	}
+	i, ok := s.index[id]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	return s.entries[i].clone(), nil
+}
+
+// Query filters List. Zero fields match everything.
+type Query struct {
+	Since time.Time
+	Until time.Time
+	Mode  string
+	Tag   string
+	// SkipDuplicates leaves out entries marked Duplicate.
+	SkipDuplicates bool
+	// Offset skips that many matches; Limit caps the result.
+	Offset int
+	Limit  int
+}
+
+func (q Query) matches(e Entry) bool {
+	switch {
+	case !q.Since.IsZero() && e.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !e.Time.Before(q.Until):
+		return false
+	case q.Mode != "" && e.Mode != q.Mode:
+		return false
+	case q.Tag != "" && !e.HasTag(q.Tag):
+		return false
+	case q.SkipDuplicates && e.Duplicate:
+		return false
+	}
+	return true
+}
+
+// List returns the entries matching q, newest first.
+func (s *Store) List(q Query) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+
+	var result []Entry
+	skipped := 0
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		if q.Limit > 0 && len(result) == q.Limit {
+			break
+		}
+		e := s.entries[i]
+		if !q.matches(e) {
+			continue
+		}
+		if skipped < q.Offset {
+			skipped++
+			continue
+		}
+		result = append(result, e.clone())
+	}
+	return result, nil
+}
+
+// AddTags adds tags to an entry and returns the updated entry.
+func (s *Store) AddTags(id string, tags ...string) (Entry, error) {
+	return s.updateTags(id, func(current []string) []string {
+		return append(current, tags...)
+	})
+}
+
+// RemoveTags removes tags from an entry and returns the updated entry.
+func (s *Store) RemoveTags(id string, tags ...string) (Entry, error) {
+	return s.updateTags(id, func(current []string) []string {
+		return slices.DeleteFunc(current, func(t string) bool {
+			return slices.Contains(tags, t)
+		})
+	})
+}
+
+// SetTags replaces an entry's tags and returns the updated entry.
+func (s *Store) SetTags(id string, tags ...string) (Entry, error) {
+	return s.updateTags(id, func([]string) []string {
+		return slices.Clone(tags)
+	})
+}
+
+func (s *Store) updateTags(id string, update func([]string) []string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateEntry(id, func(e Entry) *record {
+		tags := normalizeTags(update(slices.Clone(e.Tags)))
+		if slices.Equal(tags, e.Tags) {
+			return nil
+		}
+		return &record{Op: opTags, ID: id, Tags: tags}
+	})
+}
+
+// SetPinned pins or unpins an entry and returns the updated entry.
+func (s *Store) SetPinned(id string, pinned bool) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateEntry(id, func(e Entry) *record {
+		if e.Pinned == pinned {
+			return nil
+		}
+		return &record{Op: opPin, ID: id, Pinned: pinned}
+	})
+}
+
+// updateEntry appends the record change returns for entry id, if any, and
+// returns the entry as updated.
+func (s *Store) updateEntry(id string, change func(Entry) *record) (Entry, error) {
+	var updated Entry
+	err := s.write(func() error {
+		i, ok := s.index[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if r := change(s.entries[i]); r != nil {
+			if err := s.append(*r); err != nil {
+				return err
+			}
+			if i, ok = s.index[id]; !ok {
+				return ErrNotFound
+			}
+		}
+		updated = s.entries[i].clone()
+		return nil
+	})
+	return updated, err
+}
+
+// Delete removes an entry from the index. The image file is left alone.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.write(func() error {
+		if _, ok := s.index[id]; !ok {
+			return ErrNotFound
+		}
+		return s.append(record{Op: opDelete, ID: id})
+	})
+}
+
+// Compact rewrites the index with one line per live entry. It is safe while
+// other processes use the index.
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.write(s.compact)
+}
+
+// write takes the lock file every process writing the index takes, reads
+// what others appended and runs fn, which may check the entries and append
+// or compact. s.mu must be held.
+func (s *Store) write(fn func() error) error {
+	lock, err := os.OpenFile(s.path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to lock history: %w", err)
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("failed to lock history: %w", err)
+	}
+	defer unlockFile(lock)
+
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+func (s *Store) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".history-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to compact history: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for i := range s.entries {
+		if err := enc.Encode(record{Op: opAdd, Entry: &s.entries[i]}); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to compact history: %w", err)
+		}
+	}
+	err = w.Flush()
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to compact history: %w", err)
+	}
+
+	// Reload from the new file so offset and identity match it.
+	s.reset()
+	return s.refresh()
+}
+
+// append writes r as one line and applies it. It runs inside write, so the
+// entries are current.
+func (s *Store) append(r record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	line = append(line, '\n')
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	// A line cut short by a crash would swallow this one; end it first.
+	if info, err := f.Stat(); err == nil && info.Size() > s.offset && s.endsMidLine(info) {
+		line = append([]byte{'\n'}, line...)
+	}
+	_, err = f.Write(line)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return s.refresh()
+}
+
+// endsMidLine reports whether the file's last byte is not a newline.
+func (s *Store) endsMidLine(info os.FileInfo) bool {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+		return false
+	}
+	return last[0] != '\n'
+}
+
+// refresh applies lines appended since the last call, or reloads the whole
+// file if it was replaced or truncated.
+func (s *Store) refresh() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.reset()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+	if s.file == nil || !os.SameFile(s.file, info) || info.Size() < s.offset {
+		s.reset()
+	}
+	s.file = info
+	if info.Size() == s.offset {
+		return nil
+	}
+
+	if _, err := f.Seek(s.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// An unterminated line is still being written, or was cut
+			// short; leave it for the next call.
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read history: %w", err)
+		}
+		s.offset += int64(len(line))
+		s.apply(line)
+	}
+}
+
+func (s *Store) reset() {
+	s.entries = nil
+	s.index = make(map[string]int)
+	s.offset = 0
+	s.file = nil
+	s.dead = 0
+}
+
+// apply replays one line. Lines that do not parse or refer to unknown
+// entries are counted as dead and otherwise ignored.
+func (s *Store) apply(line []byte) {
+	if len(strings.TrimSpace(string(line))) == 0 {
+		return
+	}
+
+	var r record
+	if err := json.Unmarshal(line, &r); err != nil {
+		s.dead++
+		return
+	}
+
+	switch r.Op {
+	case opAdd:
+		if r.Entry == nil {
+			s.dead++
+			return
+		}
+		e := *r.Entry
+		if e.ID == "" {
+			s.dead++
+			return
+		}
+		if i, ok := s.index[e.ID]; ok {
+			s.entries[i] = e
+			s.dead++
+			return
+		}
+		s.index[e.ID] = len(s.entries)
+		s.entries = append(s.entries, e)
+	case opTags:
+		if i, ok := s.index[r.ID]; ok {
+			s.entries[i].Tags = r.Tags
+		}
+		s.dead++
+	case opPin:
+		if i, ok := s.index[r.ID]; ok {
+			s.entries[i].Pinned = r.Pinned
+		}
+		s.dead++
+	case opDelete:
+		if i, ok := s.index[r.ID]; ok {
+			delete(s.index, r.ID)
+			s.entries = slices.Delete(s.entries, i, i+1)
+			for j := i; j < len(s.entries); j++ {
+				s.index[s.entries[j].ID] = j
+			}
+			s.dead++
+		}
+		s.dead++
+	default:
+		s.dead++
+	}
+}
+
+// normalizeTags trims tags, drops empty ones and duplicates, and sorts them.
+func normalizeTags(tags []string) []string {
+	var result []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	slices.Sort(result)
+	return result
+}
@@ -0,0 +1,292 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openTemp(t *testing.T) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sub", "history.jsonl")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return s, path
+}
+
+func add(t *testing.T, s *Store, mode string) Entry {
+	t.Helper()
+	e, err := s.Add(Entry{Time: time.Now(), Mode: mode, Width: 10, Height: 20, Hash: "abc"})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	return e
+}
+
+func ids(entries []Entry) []string {
+	var result []string
+	for _, e := range entries {
+		result = append(result, e.ID)
+	}
+	return result
+}
+
+func lines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+func TestStoreAppendAndLoad(t *testing.T) {
+	s, path := openTemp(t)
+	a := add(t, s, "monitor")
+	b := add(t, s, "region")
+	c := add(t, s, "window")
+	if a.ID == "" || a.ID == b.ID {
+		t.Fatalf("IDs %q and %q are not unique", a.ID, b.ID)
+	}
+
+	if _, err := s.AddTags(a.ID, " bug ", "ui", "bug", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetPinned(b.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(c.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(Entry{ID: a.ID}); err == nil {
+		t.Error("Add accepted an ID already in the index")
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := reopened.List(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(list), []string{b.ID, a.ID}; !slices.Equal(got, want) {
+		t.Fatalf("List = %v, want newest first %v", got, want)
+	}
+	got, err := reopened.Get(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got.Tags, []string{"bug", "ui"}) || got.Mode != "monitor" || got.Width != 10 {
+		t.Errorf("Get(a) = %+v", got)
+	}
+	if got, _ := reopened.Get(b.ID); !got.Pinned {
+		t.Error("the pin was not kept")
+	}
+	if _, err := reopened.Get(c.ID); err != ErrNotFound {
+		t.Errorf("Get of a deleted entry: %v, want ErrNotFound", err)
+	}
+	if err := reopened.Delete(c.ID); err != ErrNotFound {
+		t.Errorf("Delete of a deleted entry: %v, want ErrNotFound", err)
+	}
+}
+
+func TestStoreQuery(t *testing.T) {
+	s, _ := openTemp(t)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, mode := range []string{"monitor", "region", "monitor", "window"} {
+		e := Entry{Time: base.Add(time.Duration(i) * time.Hour), Mode: mode, Duplicate: i == 2}
+		if i == 1 {
+			e.Tags = []string{"bug"}
+		}
+		if _, err := s.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count := func(q Query) int {
+		list, err := s.List(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(list)
+	}
+	tests := []struct {
+		q    Query
+		want int
+	}{
+		{Query{}, 4},
+		{Query{Mode: "monitor"}, 2},
+		{Query{Tag: "bug"}, 1},
+		{Query{SkipDuplicates: true}, 3},
+		{Query{Since: base.Add(time.Hour)}, 3},
+		{Query{Until: base.Add(time.Hour)}, 1},
+		{Query{Limit: 3}, 3},
+		{Query{Offset: 3, Limit: 3}, 1},
+	}
+	for _, tt := range tests {
+		if got := count(tt.q); got != tt.want {
+			t.Errorf("List(%+v) = %d entries, want %d", tt.q, got, tt.want)
+		}
+	}
+}
+
+// Lines that do not parse are skipped, and a line cut short by a crash does
+// not swallow the next one.
+func TestStoreCorruptLines(t *testing.T) {
+	s, path := openTemp(t)
+	a := add(t, s, "monitor")
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(f, `not json`)
+	fmt.Fprintln(f, `{"op":"explode","id":"x"}`)
+	fmt.Fprintln(f, `{"op":"add","entry":{"mode":"no id"}}`)
+	fmt.Fprintln(f, `{"op":"tags","id":"missing","tags":["x"]}`)
+	fmt.Fprint(f, `{"op":"add","entry":{"id":"cut`)
+	f.Close()
+
+	b := add(t, s, "region")
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := reopened.List(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(list), []string{b.ID, a.ID}; !slices.Equal(got, want) {
+		t.Errorf("List = %v, want %v", got, want)
+	}
+}
+
+func TestStoreCompact(t *testing.T) {
+	s, path := openTemp(t)
+	var kept []string
+	for i := 0; i < 5; i++ {
+		e := add(t, s, "monitor")
+		if _, err := s.AddTags(e.ID, "a"); err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 0 {
+			if err := s.Delete(e.ID); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			kept = append([]string{e.ID}, kept...)
+		}
+	}
+	before := lines(t, path)
+
+	if err := s.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if after := lines(t, path); after != len(kept) {
+		t.Errorf("%d lines after compacting, was %d; want one per entry (%d)", after, before, len(kept))
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := reopened.List(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(list); !slices.Equal(got, kept) {
+		t.Errorf("List after compacting = %v, want %v", got, kept)
+	}
+	for _, e := range list {
+		if !e.HasTag("a") {
+			t.Errorf("entry %s lost its tags", e.ID)
+		}
+	}
+
+	// The store keeps working on the new file.
+	e := add(t, s, "region")
+	if _, err := reopened.Get(e.ID); err != nil {
+		t.Errorf("an entry added after compacting: %v", err)
+	}
+}
+
+// Stores in different processes see each other's changes; separate Stores
+// on one file stand in for them.
+func TestStoresShareFile(t *testing.T) {
+	app, path := openTemp(t)
+	cli, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := add(t, app, "monitor")
+	if _, err := cli.SetPinned(e.ID, true); err != nil {
+		t.Fatalf("SetPinned from another store: %v", err)
+	}
+	if got, _ := app.Get(e.ID); !got.Pinned {
+		t.Error("the other store's pin was not seen")
+	}
+
+	if err := cli.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delete(e.ID); err != nil {
+		t.Errorf("Delete after another store compacted: %v", err)
+	}
+	if _, err := cli.Get(e.ID); err != ErrNotFound {
+		t.Errorf("Get after the other store deleted: %v", err)
+	}
+}
+
+// Entries appended while another store compacts must not be lost.
+func TestStoreCompactWhileAppending(t *testing.T) {
+	app, path := openTemp(t)
+	cli, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 200
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			if _, err := app.Add(Entry{Time: time.Now(), Mode: "monitor"}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n/4; i++ {
+			if err := cli.Compact(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := reopened.List(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != n {
+		t.Errorf("%d entries after compacting while appending, want %d", len(list), n)
+	}
+}
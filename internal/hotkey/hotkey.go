@@ -1,18 +1,162 @@
 package hotkey
 
-var currentHandler Handler
+import (
+	"fmt"
+	"sync"
 
+	"snaphook/internal/shortcut"
+)
+
+// Binding maps one hotkey to the handler it triggers.
+type Binding struct {
+	Hotkey  string
+	Handler Handler
+}
+
+// BindingError reports a single binding that could not be registered.
+type BindingError struct {
+	Hotkey string
+	Err    error
+}
+
+func (e *BindingError) Error() string {
+	return fmt.Sprintf("hotkey %s: %v", e.Hotkey, e.Err)
+}
+
+func (e *BindingError) Unwrap() error {
+	return e.Err
+}
+
+// Each registered hotkey gets its own native ID, so bindings can be added
+// and removed independently and events dispatch to the right handler.
+var (
+	handlers      = map[int]Handler{}
+	bindingIDs    = map[string]int{}
+	nextID        = 1
+	handlersMutex sync.Mutex
+)
+
+// Register adds a global hotkey. Other registered hotkeys are unaffected.
 func Register(hotkey string, handler Handler) error {
-	currentHandler = handler
-	return register(hotkey)
+	combo, err := shortcut.Parse(hotkey)
+	if err != nil {
+		return err
+	}
+	name := combo.String()
+
+	handlersMutex.Lock()
+	if _, exists := bindingIDs[name]; exists {
+		handlersMutex.Unlock()
+		return fmt.Errorf("hotkey %s is already bound", name)
+	}
+	id := nextID
+	nextID++
+	handlers[id] = handler
+	bindingIDs[name] = id
+	handlersMutex.Unlock()
+
+	if err := register(id, combo); err != nil {
+		handlersMutex.Lock()
+		delete(handlers, id)
+		delete(bindingIDs, name)
+		handlersMutex.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// RegisterAll registers each binding independently. It returns a
+// *BindingError for every binding that failed; the rest stay registered.
+func RegisterAll(bindings []Binding) []error {
+	var errs []error
+	for _, b := range bindings {
+		if err := Register(b.Hotkey, b.Handler); err != nil {
+			errs = append(errs, &BindingError{Hotkey: b.Hotkey, Err: err})
+		}
+	}
+	return errs
 }
 
+// UnregisterHotkey removes a single hotkey added with Register.
+func UnregisterHotkey(hotkey string) error {
+	combo, err := shortcut.Parse(hotkey)
+	if err != nil {
+		return err
+	}
+
+	handlersMutex.Lock()
+	id, ok := bindingIDs[combo.String()]
+	if ok {
+		delete(handlers, id)
+		delete(bindingIDs, combo.String())
+	}
+	handlersMutex.Unlock()
+
+	if !ok {
+		return fmt.Errorf("hotkey %s is not registered", combo)
+	}
+	return unregister(id)
+}
+
+// Unregister removes every hotkey and stops the platform event loop.
 func Unregister() {
-	unregister()
+	handlersMutex.Lock()
+	ids := make([]int, 0, len(handlers))
+	for id := range handlers {
+		ids = append(ids, id)
+	}
+	handlers = map[int]Handler{}
+	bindingIDs = map[string]int{}
+	handlersMutex.Unlock()
+
+	for _, id := range ids {
+		unregister(id)
+	}
+	stop()
+}
+
+// ChangeHotkey moves handler from oldHotkey to newHotkey, leaving other
+// hotkeys alone. If newHotkey cannot be registered, oldHotkey is registered
+// again and the registration error is returned.
+func ChangeHotkey(oldHotkey, newHotkey string, handler Handler) error {
+	newCombo, err := shortcut.Parse(newHotkey)
+	if err != nil {
+		return err
+	}
+	if oldCombo, err := shortcut.Parse(oldHotkey); err == nil && oldCombo == newCombo && isRegistered(newCombo) {
+		return nil
+	}
+
+	// The old hotkey may never have registered; there is nothing to undo then.
+	oldRegistered := UnregisterHotkey(oldHotkey) == nil
+
+	if err := Register(newHotkey, handler); err != nil {
+		if oldRegistered {
+			if rbErr := Register(oldHotkey, handler); rbErr != nil {
+				return fmt.Errorf("%w (restoring %s also failed: %v)", err, oldHotkey, rbErr)
+			}
+		}
+		return err
+	}
+
+	return nil
 }
 
-func ChangeHotkey(newHotkey string, handler Handler) error {
-	Unregister()
-	currentHandler = handler
-	return register(newHotkey)
+func isRegistered(combo shortcut.Combo) bool {
+	handlersMutex.Lock()
+	defer handlersMutex.Unlock()
+	_, ok := bindingIDs[combo.String()]
+	return ok
+}
+
+// dispatch is called by the platform event loop when hotkey id fires.
+func dispatch(id int) {
+	handlersMutex.Lock()
+	handler := handlers[id]
+	handlersMutex.Unlock()
+
+	if handler != nil {
+		go handler()
+	}
 }
@@ -0,0 +1,321 @@
+//go:build linux
+
+package hotkey
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+
+	"snaphook/internal/shortcut"
+)
+
+var keysyms = map[shortcut.Key]xproto.Keysym{
+	shortcut.Space:        0x0020,
+	shortcut.Enter:        0xff0d, // Return
+	shortcut.Tab:          0xff09,
+	shortcut.Escape:       0xff1b,
+	shortcut.Backspace:    0xff08,
+	shortcut.Insert:       0xff63,
+	shortcut.Delete:       0xffff,
+	shortcut.Home:         0xff50,
+	shortcut.End:          0xff57,
+	shortcut.PageUp:       0xff55, // Prior
+	shortcut.PageDown:     0xff56, // Next
+	shortcut.Up:           0xff52,
+	shortcut.Down:         0xff54,
+	shortcut.Left:         0xff51,
+	shortcut.Right:        0xff53,
+	shortcut.PrintScreen:  0xff61, // Print
+	shortcut.Pause:        0xff13,
+	shortcut.ScrollLock:   0xff14,
+	shortcut.Minus:        0x002d,
+	shortcut.Equals:       0x003d,
+	shortcut.Comma:        0x002c,
+	shortcut.Period:       0x002e,
+	shortcut.Slash:        0x002f,
+	shortcut.Backslash:    0x005c,
+	shortcut.Semicolon:    0x003b,
+	shortcut.Quote:        0x0027,
+	shortcut.BracketLeft:  0x005b,
+	shortcut.BracketRight: 0x005d,
+	shortcut.Backquote:    0x0060, // grave
+}
+
+const (
+	xkF1      xproto.Keysym = 0xffbe
+	xkNumLock xproto.Keysym = 0xff7f
+
+	// modMask covers the modifiers a shortcut can use; lock keys are masked
+	// out before matching.
+	modMask = xproto.ModMaskShift | xproto.ModMaskControl | xproto.ModMask1 | xproto.ModMask4
+)
+
+// grab is one XGrabKey registration, before lock-key variants.
+type grab struct {
+	keycode   xproto.Keycode
+	modifiers uint16
+}
+
+var (
+	conn         *xgb.Conn
+	root         xproto.Window
+	numLockMask  uint16
+	grabs        = map[int]grab{}
+	isRunning    = false
+	loopExitChan chan struct{}
+	hotkeyMutex  sync.Mutex
+)
+
+func keysymFor(key shortcut.Key) (xproto.Keysym, error) {
+	if c, ok := key.Letter(); ok {
+		return xproto.Keysym(c - 'A' + 'a'), nil
+	}
+	if c, ok := key.Digit(); ok {
+		return xproto.Keysym(c), nil
+	}
+	if n, ok := key.Function(); ok {
+		return xkF1 + xproto.Keysym(n-1), nil
+	}
+	if sym, ok := keysyms[key]; ok {
+		return sym, nil
+	}
+	return 0, fmt.Errorf("key %s has no X11 keysym", key)
+}
+
+func nativeModifiers(mods shortcut.Modifier) uint16 {
+	var m uint16
+	if mods&shortcut.Ctrl != 0 {
+		m |= xproto.ModMaskControl
+	}
+	if mods&shortcut.Alt != 0 {
+		m |= xproto.ModMask1
+	}
+	if mods&shortcut.Shift != 0 {
+		m |= xproto.ModMaskShift
+	}
+	if mods&shortcut.Win != 0 {
+		m |= xproto.ModMask4
+	}
+	return m
+}
+
+// keycodeFor finds the first keycode whose mapping produces sym at any level.
+func keycodeFor(c *xgb.Conn, sym xproto.Keysym) (xproto.Keycode, error) {
+	setup := xproto.Setup(c)
+	first := setup.MinKeycode
+	count := byte(setup.MaxKeycode - setup.MinKeycode + 1)
+
+	mapping, err := xproto.GetKeyboardMapping(c, first, count).Reply()
+	if err != nil {
+		return 0, err
+	}
+
+	per := int(mapping.KeysymsPerKeycode)
+	for i := 0; i < int(count); i++ {
+		for j := 0; j < per; j++ {
+			if mapping.Keysyms[i*per+j] == sym {
+				return first + xproto.Keycode(i), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no keycode produces keysym 0x%x", sym)
+}
+
+// findNumLockMask returns the modifier bit Num_Lock is mapped to, which is
+// usually but not always Mod2.
+func findNumLockMask(c *xgb.Conn) uint16 {
+	code, err := keycodeFor(c, xkNumLock)
+	if err != nil {
+		return xproto.ModMask2
+	}
+
+	mapping, err := xproto.GetModifierMapping(c).Reply()
+	if err != nil {
+		return xproto.ModMask2
+	}
+
+	per := int(mapping.KeycodesPerModifier)
+	for mod := 0; mod < 8; mod++ {
+		for i := 0; i < per; i++ {
+			if mapping.Keycodes[mod*per+i] == code {
+				return 1 << mod
+			}
+		}
+	}
+	return xproto.ModMask2
+}
+
+// lockVariants lists the modifier combinations a grab must cover so the
+// hotkey still fires with NumLock or CapsLock on.
+func lockVariants(modifiers uint16) []uint16 {
+	return []uint16{
+		modifiers,
+		modifiers | xproto.ModMaskLock,
+		modifiers | numLockMask,
+		modifiers | xproto.ModMaskLock | numLockMask,
+	}
+}
+
+func ensureConnection() error {
+	hotkeyMutex.Lock()
+	defer hotkeyMutex.Unlock()
+	if isRunning {
+		return nil
+	}
+
+	c, err := xgb.NewConn()
+	if err != nil {
+		return fmt.Errorf("failed to connect to X server: %w", err)
+	}
+
+	conn = c
+	root = xproto.Setup(c).DefaultScreen(c).Root
+	numLockMask = findNumLockMask(c)
+	loopExitChan = make(chan struct{})
+	isRunning = true
+
+	go func(c *xgb.Conn, exitChan chan struct{}) {
+		eventLoop(c)
+		log.Println("Hotkey event loop has exited")
+		close(exitChan)
+	}(c, loopExitChan)
+
+	log.Println("Hotkey event loop started")
+	return nil
+}
+
+func register(id int, combo shortcut.Combo) error {
+	sym, err := keysymFor(combo.Key)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Attempting to register hotkey: %s", combo)
+	if err := ensureConnection(); err != nil {
+		return err
+	}
+
+	hotkeyMutex.Lock()
+	defer hotkeyMutex.Unlock()
+
+	keycode, err := keycodeFor(conn, sym)
+	if err != nil {
+		return fmt.Errorf("failed to register hotkey %s: %w", combo, err)
+	}
+
+	g := grab{keycode: keycode, modifiers: nativeModifiers(combo.Modifiers)}
+	variants := lockVariants(g.modifiers)
+	for i, mods := range variants {
+		err := xproto.GrabKeyChecked(conn, true, root, mods, keycode,
+			xproto.GrabModeAsync, xproto.GrabModeAsync).Check()
+		if err != nil {
+			for _, done := range variants[:i] {
+				xproto.UngrabKey(conn, keycode, root, done)
+			}
+			log.Printf("Failed to register hotkey: %v", err)
+			return fmt.Errorf("failed to register hotkey %s (already grabbed by another application?): %v", combo, err)
+		}
+	}
+
+	grabs[id] = g
+	log.Printf("Hotkey registered successfully: %s", combo)
+	return nil
+}
+
+func unregister(id int) error {
+	hotkeyMutex.Lock()
+	defer hotkeyMutex.Unlock()
+
+	g, ok := grabs[id]
+	if !ok || !isRunning {
+		return nil
+	}
+	delete(grabs, id)
+
+	for _, mods := range lockVariants(g.modifiers) {
+		xproto.UngrabKey(conn, g.keycode, root, mods)
+	}
+	conn.Sync()
+	return nil
+}
+
+// A held key autorepeats as a KeyRelease immediately followed by a KeyPress
+// with the same timestamp. The core protocol cannot turn that off (it needs
+// XKB's detectable autorepeat), so a press arriving within autorepeatSlack
+// milliseconds of the same key's release is dropped.
+const autorepeatSlack = 2
+
+func eventLoop(c *xgb.Conn) {
+	released := map[xproto.Keycode]xproto.Timestamp{}
+	for {
+		ev, err := c.WaitForEvent()
+		if ev == nil && err == nil {
+			return
+		}
+		if err != nil {
+			log.Printf("X error in hotkey event loop: %v", err)
+			continue
+		}
+
+		var press xproto.KeyPressEvent
+		switch e := ev.(type) {
+		case xproto.KeyReleaseEvent:
+			released[e.Detail] = e.Time
+			continue
+		case xproto.KeyPressEvent:
+			if t, ok := released[e.Detail]; ok && e.Time-t <= autorepeatSlack {
+				continue
+			}
+			press = e
+		default:
+			continue
+		}
+
+		state := press.State & modMask
+		hotkeyMutex.Lock()
+		id := 0
+		for gid, g := range grabs {
+			if g.keycode == press.Detail && g.modifiers == state {
+				id = gid
+				break
+			}
+		}
+		hotkeyMutex.Unlock()
+
+		if id != 0 {
+			log.Printf("Hotkey pressed (id: %d)", id)
+			dispatch(id)
+		}
+	}
+}
+
+// stop closes the X connection, which releases every grab and ends the
+// event loop.
+func stop() {
+	hotkeyMutex.Lock()
+	if !isRunning {
+		hotkeyMutex.Unlock()
+		return
+	}
+
+	isRunning = false
+	c := conn
+	exitChan := loopExitChan
+	conn = nil
+	grabs = map[int]grab{}
+	hotkeyMutex.Unlock()
+
+	c.Close()
+
+	select {
+	case <-exitChan:
+		log.Println("Hotkey event loop exited cleanly")
+	case <-time.After(3 * time.Second):
+		log.Println("Warning: Hotkey event loop did not exit within timeout")
+	}
+}
@@ -0,0 +1,267 @@
+//go:build linux
+
+package hotkey
+
+import (
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+	"github.com/jezek/xgb/xtest"
+)
+
+const (
+	xkCapsLock xproto.Keysym = 0xffe5
+	xkControlL xproto.Keysym = 0xffe3
+)
+
+// fakeKeyboard types on the X server in DISPLAY, such as Xvfb, with the
+// XTEST extension, or skips the test when there is none.
+type fakeKeyboard struct {
+	conn *xgb.Conn
+	root xproto.Window
+}
+
+func newFakeKeyboard(t *testing.T) *fakeKeyboard {
+	t.Helper()
+	if os.Getenv("DISPLAY") == "" {
+		t.Skip("DISPLAY is not set; run under Xvfb")
+	}
+	c, err := xgb.NewConn()
+	if err != nil {
+		t.Skipf("cannot connect to the X server: %v", err)
+	}
+	t.Cleanup(c.Close)
+	if err := xtest.Init(c); err != nil {
+		t.Skipf("XTEST is not available: %v", err)
+	}
+	return &fakeKeyboard{conn: c, root: xproto.Setup(c).DefaultScreen(c).Root}
+}
+
+func (k *fakeKeyboard) send(t *testing.T, eventType byte, key xproto.Keycode) {
+	t.Helper()
+	xtest.FakeInput(k.conn, eventType, byte(key), 0, k.root, 0, 0, 0)
+}
+
+// sync waits until the server has processed every fake event.
+func (k *fakeKeyboard) sync(t *testing.T) {
+	t.Helper()
+	if _, err := xproto.GetInputFocus(k.conn).Reply(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// keycode finds the keycode for sym or skips the test.
+func (k *fakeKeyboard) keycode(t *testing.T, sym xproto.Keysym) xproto.Keycode {
+	t.Helper()
+	key, err := keycodeFor(k.conn, sym)
+	if err != nil {
+		t.Skip(err)
+	}
+	return key
+}
+
+// tap presses and releases key while holding mods.
+func (k *fakeKeyboard) tap(t *testing.T, key xproto.Keycode, mods ...xproto.Keycode) {
+	t.Helper()
+	for _, m := range mods {
+		k.send(t, xproto.KeyPress, m)
+	}
+	k.send(t, xproto.KeyPress, key)
+	k.send(t, xproto.KeyRelease, key)
+	for i := len(mods) - 1; i >= 0; i-- {
+		k.send(t, xproto.KeyRelease, mods[i])
+	}
+	k.sync(t)
+	// Keep taps apart so they are not taken for autorepeat.
+	time.Sleep(50 * time.Millisecond)
+}
+
+// lockState reports whether CapsLock and NumLock are on.
+func (k *fakeKeyboard) lockState(t *testing.T) (caps, num bool) {
+	t.Helper()
+	reply, err := xproto.QueryPointer(k.conn, k.root).Reply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reply.Mask&xproto.ModMaskLock != 0, reply.Mask&findNumLockMask(k.conn) != 0
+}
+
+// registerCounter binds hotkey to a handler that counts its calls.
+func registerCounter(t *testing.T, hotkey string) *atomic.Int32 {
+	t.Helper()
+	var calls atomic.Int32
+	if err := Register(hotkey, func() { calls.Add(1) }); err != nil {
+		t.Fatalf("Register(%q): %v", hotkey, err)
+	}
+	t.Cleanup(Unregister)
+	return &calls
+}
+
+// expectCalls waits for calls to reach want and then a little longer, so
+// that extra calls are caught too.
+func expectCalls(t *testing.T, calls *atomic.Int32, want int32) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for calls.Load() < want && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if got := calls.Load(); got != want {
+		t.Errorf("handler called %d times, want %d", got, want)
+	}
+}
+
+func TestHotkeyHeldFiresOnce(t *testing.T) {
+	kbd := newFakeKeyboard(t)
+	calls := registerCounter(t, "F7")
+	key, err := keycodeFor(kbd.conn, xkF1+6)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	// A held key autorepeats as release/press pairs sent back to back,
+	// which is what these are.
+	kbd.send(t, xproto.KeyPress, key)
+	for i := 0; i < 5; i++ {
+		kbd.send(t, xproto.KeyRelease, key)
+		kbd.send(t, xproto.KeyPress, key)
+	}
+	kbd.send(t, xproto.KeyRelease, key)
+	kbd.sync(t)
+
+	expectCalls(t, calls, 1)
+}
+
+func TestHotkeyTappedTwiceFiresTwice(t *testing.T) {
+	kbd := newFakeKeyboard(t)
+	calls := registerCounter(t, "F7")
+	key, err := keycodeFor(kbd.conn, xkF1+6)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		kbd.send(t, xproto.KeyPress, key)
+		kbd.send(t, xproto.KeyRelease, key)
+		kbd.sync(t)
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	expectCalls(t, calls, 2)
+}
+
+func TestHotkeyFiresWithLockKeys(t *testing.T) {
+	kbd := newFakeKeyboard(t)
+	calls := registerCounter(t, "Ctrl+F7")
+	key := kbd.keycode(t, xkF1+6)
+	ctrl := kbd.keycode(t, xkControlL)
+	capsLock := kbd.keycode(t, xkCapsLock)
+	numLock := kbd.keycode(t, xkNumLock)
+
+	// Each lock key is tapped on and, at the end, off again.
+	t.Cleanup(func() {
+		caps, num := kbd.lockState(t)
+		if caps {
+			kbd.tap(t, capsLock)
+		}
+		if num {
+			kbd.tap(t, numLock)
+		}
+	})
+
+	kbd.tap(t, key, ctrl)
+	kbd.tap(t, capsLock)
+	if caps, _ := kbd.lockState(t); !caps {
+		t.Skip("the X server does not track CapsLock")
+	}
+	kbd.tap(t, key, ctrl)
+	kbd.tap(t, numLock)
+	if _, num := kbd.lockState(t); !num {
+		t.Skip("the X server does not track NumLock")
+	}
+	kbd.tap(t, key, ctrl)
+	kbd.tap(t, capsLock)
+	kbd.tap(t, key, ctrl)
+
+	expectCalls(t, calls, 4)
+}
+
+func TestChangeHotkey(t *testing.T) {
+	kbd := newFakeKeyboard(t)
+	var calls atomic.Int32
+	handler := func() { calls.Add(1) }
+	if err := Register("F7", handler); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	t.Cleanup(Unregister)
+	f7 := kbd.keycode(t, xkF1+6)
+	f8 := kbd.keycode(t, xkF1+7)
+
+	if err := ChangeHotkey("F7", "F8", handler); err != nil {
+		t.Fatalf("ChangeHotkey: %v", err)
+	}
+	kbd.tap(t, f7)
+	expectCalls(t, &calls, 0)
+	kbd.tap(t, f8)
+	expectCalls(t, &calls, 1)
+}
+
+// A hotkey another client holds cannot be taken, and the old one keeps
+// working.
+func TestChangeHotkeyRestoresOld(t *testing.T) {
+	kbd := newFakeKeyboard(t)
+	var calls atomic.Int32
+	handler := func() { calls.Add(1) }
+	if err := Register("F7", handler); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	t.Cleanup(Unregister)
+	f7 := kbd.keycode(t, xkF1+6)
+	f8 := kbd.keycode(t, xkF1+7)
+
+	err := xproto.GrabKeyChecked(kbd.conn, true, kbd.root, 0, f8,
+		xproto.GrabModeAsync, xproto.GrabModeAsync).Check()
+	if err != nil {
+		t.Fatalf("GrabKey: %v", err)
+	}
+
+	if err := ChangeHotkey("F7", "F8", handler); err == nil {
+		t.Fatal("ChangeHotkey took a hotkey another client holds")
+	}
+	kbd.tap(t, f7)
+	expectCalls(t, &calls, 1)
+}
+
+func TestUnregister(t *testing.T) {
+	kbd := newFakeKeyboard(t)
+	f7 := kbd.keycode(t, xkF1+6)
+	f8 := kbd.keycode(t, xkF1+7)
+	f7Calls := registerCounter(t, "F7")
+	f8Calls := registerCounter(t, "F8")
+
+	if err := UnregisterHotkey("F7"); err != nil {
+		t.Fatalf("UnregisterHotkey: %v", err)
+	}
+	kbd.tap(t, f7)
+	kbd.tap(t, f8)
+	expectCalls(t, f7Calls, 0)
+	expectCalls(t, f8Calls, 1)
+
+	Unregister()
+	kbd.tap(t, f8)
+	expectCalls(t, f8Calls, 1)
+
+	// The grabs are released, so another client can take both keys.
+	for _, key := range []xproto.Keycode{f7, f8} {
+		err := xproto.GrabKeyChecked(kbd.conn, true, kbd.root, 0, key,
+			xproto.GrabModeAsync, xproto.GrabModeAsync).Check()
+		if err != nil {
+			t.Errorf("keycode %d is still grabbed: %v", key, err)
+		}
+		xproto.UngrabKey(kbd.conn, key, kbd.root, 0)
+	}
+}
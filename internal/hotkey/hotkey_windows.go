@@ -5,12 +5,15 @@ package hotkey
 import (
 	"fmt"
 	"log"
+	"runtime"
 	"sync"
 	"syscall"
 	"time"
 	"unsafe"
 
 	"golang.org/x/sys/windows"
+
+	"snaphook/internal/shortcut"
 )
 
 const (
@@ -22,6 +25,11 @@ const (
 
 	WM_HOTKEY = 0x0312
 	WM_QUIT   = 0x0012
+	WM_APP    = 0x8000
+
+	// wmRunRequests wakes the message loop to run queued loopRequests.
+	wmRunRequests = WM_APP + 1
+	PM_NOREMOVE   = 0x0000
 )
 
 var (
@@ -30,81 +38,199 @@ var (
 	procRegisterHotKey     = user32.NewProc("RegisterHotKey")
 	procUnregisterHotKey   = user32.NewProc("UnregisterHotKey")
 	procGetMessage         = user32.NewProc("GetMessageW")
+	procPeekMessage        = user32.NewProc("PeekMessageW")
 	procPostThreadMessage  = user32.NewProc("PostThreadMessageW")
 	procGetCurrentThreadId = kernel32.NewProc("GetCurrentThreadId")
 
-	hotkeyID     = 1
 	isRunning    = false
 	threadID     uint32
+	loopRequests chan func()
 	loopExitChan chan struct{}
 	hotkeyMutex  sync.Mutex
 )
 
-func parseHotkey(hotkey string) (uint32, uint32, error) {
+var vkCodes = map[shortcut.Key]uint32{
+	shortcut.Space:        0x20,
+	shortcut.Enter:        0x0D,
+	shortcut.Tab:          0x09,
+	shortcut.Escape:       0x1B,
+	shortcut.Backspace:    0x08,
+	shortcut.Insert:       0x2D,
+	shortcut.Delete:       0x2E,
+	shortcut.Home:         0x24,
+	shortcut.End:          0x23,
+	shortcut.PageUp:       0x21,
+	shortcut.PageDown:     0x22,
+	shortcut.Up:           0x26,
+	shortcut.Down:         0x28,
+	shortcut.Left:         0x25,
+	shortcut.Right:        0x27,
+	shortcut.PrintScreen:  0x2C,
+	shortcut.Pause:        0x13,
+	shortcut.ScrollLock:   0x91,
+	shortcut.Minus:        0xBD, // VK_OEM_MINUS
+	shortcut.Equals:       0xBB, // VK_OEM_PLUS, the =/+ key
+	shortcut.Comma:        0xBC,
+	shortcut.Period:       0xBE,
+	shortcut.Slash:        0xBF, // VK_OEM_2
+	shortcut.Backslash:    0xDC, // VK_OEM_5
+	shortcut.Semicolon:    0xBA, // VK_OEM_1
+	shortcut.Quote:        0xDE, // VK_OEM_7
+	shortcut.BracketLeft:  0xDB, // VK_OEM_4
+	shortcut.BracketRight: 0xDD, // VK_OEM_6
+	shortcut.Backquote:    0xC0, // VK_OEM_3
+}
+
+func nativeHotkey(combo shortcut.Combo) (uint32, uint32, error) {
 	modifiers := uint32(MOD_NOREPEAT)
-	var vkCode uint32
+	if combo.Modifiers&shortcut.Ctrl != 0 {
+		modifiers |= MOD_CONTROL
+	}
+	if combo.Modifiers&shortcut.Alt != 0 {
+		modifiers |= MOD_ALT
+	}
+	if combo.Modifiers&shortcut.Shift != 0 {
+		modifiers |= MOD_SHIFT
+	}
+	if combo.Modifiers&shortcut.Win != 0 {
+		modifiers |= MOD_WIN
+	}
 
-	switch hotkey {
-	case "Ctrl+Shift+S":
-		modifiers |= MOD_CONTROL | MOD_SHIFT
-		vkCode = 0x53
-	case "Ctrl+Alt+S":
-		modifiers |= MOD_CONTROL | MOD_ALT
-		vkCode = 0x53
-	case "PrintScreen":
-		vkCode = 0x2C
-	default:
-		return 0, 0, fmt.Errorf("unsupported hotkey: %s", hotkey)
+	vkCode, err := vkCode(combo.Key)
+	if err != nil {
+		return 0, 0, err
 	}
 
 	return modifiers, vkCode, nil
 }
 
-func register(hotkey string) error {
-	modifiers, vkCode, err := parseHotkey(hotkey)
+func vkCode(key shortcut.Key) (uint32, error) {
+	if c, ok := key.Letter(); ok {
+		return uint32(c), nil
+	}
+	if c, ok := key.Digit(); ok {
+		return uint32(c), nil
+	}
+	if n, ok := key.Function(); ok {
+		return 0x70 + uint32(n-1), nil // VK_F1..VK_F24
+	}
+	if code, ok := vkCodes[key]; ok {
+		return code, nil
+	}
+	return 0, fmt.Errorf("key %s has no Windows virtual-key code", key)
+}
+
+// RegisterHotKey delivers WM_HOTKEY to the thread that registered it, so all
+// registration happens on the message loop's locked OS thread.
+func register(id int, combo shortcut.Combo) error {
+	modifiers, vkCode, err := nativeHotkey(combo)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("Attempting to register hotkey: %s", hotkey)
+	log.Printf("Attempting to register hotkey: %s", combo)
+	err = runOnLoop(func() error {
+		ret, _, err := procRegisterHotKey.Call(0, uintptr(id), uintptr(modifiers), uintptr(vkCode))
+		if ret == 0 {
+			return fmt.Errorf("failed to register hotkey %s: %v", combo, err)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("%v", err)
+		return err
+	}
+
+	log.Printf("Hotkey registered successfully: %s", combo)
+	return nil
+}
+
+func unregister(id int) error {
 	hotkeyMutex.Lock()
-	isRunning = true
-	loopExitChan = make(chan struct{})
+	running := isRunning
 	hotkeyMutex.Unlock()
+	if !running {
+		return nil
+	}
 
-	resultChan := make(chan error, 1)
+	return runOnLoop(func() error {
+		ret, _, err := procUnregisterHotKey.Call(0, uintptr(id))
+		if ret == 0 {
+			return fmt.Errorf("failed to unregister hotkey: %v", err)
+		}
+		return nil
+	})
+}
+
+func ensureLoop() {
+	hotkeyMutex.Lock()
+	defer hotkeyMutex.Unlock()
+	if isRunning {
+		return
+	}
+
+	ready := make(chan uint32)
+	loopRequests = make(chan func(), 16)
+	loopExitChan = make(chan struct{})
+	exitChan := loopExitChan
 
 	go func() {
-		ret, _, err := procRegisterHotKey.Call(
-			0,
-			uintptr(hotkeyID),
-			uintptr(modifiers),
-			uintptr(vkCode),
-		)
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
 
-		if ret == 0 {
-			log.Printf("Failed to register hotkey: %v", err)
-			resultChan <- fmt.Errorf("failed to register hotkey: %v", err)
-			return
-		}
+		// PostThreadMessage fails until the thread has a message queue,
+		// which the first peek creates.
+		msg := &MSG{}
+		procPeekMessage.Call(uintptr(unsafe.Pointer(msg)), 0, 0, 0, PM_NOREMOVE)
+		tid, _, _ := procGetCurrentThreadId.Call()
+		ready <- uint32(tid)
 
-		log.Printf("Hotkey registered successfully: %s", hotkey)
-		resultChan <- nil
 		messageLoop()
 		log.Println("Message loop has exited")
-		close(loopExitChan)
+		close(exitChan)
 	}()
 
-	return <-resultChan
+	threadID = <-ready
+	isRunning = true
+	log.Printf("Hotkey message loop started (threadID: %d)", threadID)
 }
 
-func messageLoop() {
-	ret, _, _ := procGetCurrentThreadId.Call()
+// runOnLoop runs fn on the message loop's thread and waits for it. It does
+// not time out: RegisterHotKey returns promptly, and giving up early would
+// leave a hotkey registered that no ID records, so it could never be
+// unregistered.
+func runOnLoop(fn func() error) error {
+	ensureLoop()
+
 	hotkeyMutex.Lock()
-	threadID = uint32(ret)
+	tid := threadID
+	requests := loopRequests
+	exitChan := loopExitChan
 	hotkeyMutex.Unlock()
-	log.Printf("Hotkey message loop started (threadID: %d)", threadID)
 
+	result := make(chan error, 1)
+	requests <- func() { result <- fn() }
+
+	ret, _, err := procPostThreadMessage.Call(uintptr(tid), wmRunRequests, 0, 0)
+	if ret == 0 {
+		return fmt.Errorf("failed to wake hotkey message loop: %v", err)
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-exitChan:
+		// fn may have run just before the loop exited.
+		select {
+		case err := <-result:
+			return err
+		default:
+			return fmt.Errorf("hotkey message loop has exited")
+		}
+	}
+}
+
+func messageLoop() {
 	msg := &MSG{}
 	for {
 		ret, _, _ := procGetMessage.Call(
@@ -119,21 +245,35 @@ func messageLoop() {
 			return
 		}
 
-		if msg.Message == WM_HOTKEY {
-			log.Println("WM_HOTKEY received in message loop")
-			if currentHandler != nil {
-				go currentHandler()
-			} else {
-				log.Println("Warning: No handler set for hotkey")
-			}
-		} else if msg.Message == WM_QUIT {
+		switch msg.Message {
+		case WM_HOTKEY:
+			log.Printf("WM_HOTKEY received in message loop (id: %d)", msg.WParam)
+			dispatch(int(msg.WParam))
+		case wmRunRequests:
+			runPendingRequests()
+		case WM_QUIT:
 			log.Println("WM_QUIT received, exiting message loop")
 			return
 		}
 	}
 }
 
-func unregister() {
+func runPendingRequests() {
+	hotkeyMutex.Lock()
+	requests := loopRequests
+	hotkeyMutex.Unlock()
+
+	for {
+		select {
+		case fn := <-requests:
+			fn()
+		default:
+			return
+		}
+	}
+}
+
+func stop() {
 	hotkeyMutex.Lock()
 	if !isRunning {
 		hotkeyMutex.Unlock()
@@ -145,8 +285,6 @@ func unregister() {
 	exitChan := loopExitChan
 	hotkeyMutex.Unlock()
 
-	procUnregisterHotKey.Call(0, uintptr(hotkeyID))
-
 	if tid != 0 {
 		procPostThreadMessage.Call(uintptr(tid), WM_QUIT, 0, 0)
 	}
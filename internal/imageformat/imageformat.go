@@ -0,0 +1,124 @@
+// Package imageformat describes the encodings SnapHook can write
+// screenshots in and encodes images with them. All encoders are pure Go.
+package imageformat
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+)
+
+type Type string
+
+const (
+	PNG  Type = "png"
+	JPEG Type = "jpeg"
+	QOI  Type = "qoi"
+)
+
+// Format is an encoding plus its settings. Only the field for Type is used;
+// the zero value of the other is kept so equal formats compare equal.
+type Format struct {
+	Type        Type
+	PNGLevel    png.CompressionLevel
+	JPEGQuality int
+}
+
+// Default is the fast PNG every sink used before formats were configurable.
+var Default = Format{Type: PNG, PNGLevel: png.BestSpeed}
+
+var pngLevels = map[string]png.CompressionLevel{
+	"none":    png.NoCompression,
+	"fast":    png.BestSpeed,
+	"default": png.DefaultCompression,
+	"best":    png.BestCompression,
+}
+
+// Parse builds a Format from config values. An empty name means PNG, an
+// empty level "fast" and a zero quality 90.
+func Parse(name, pngLevel string, jpegQuality int) (Format, error) {
+	switch Type(strings.ToLower(strings.TrimSpace(name))) {
+	case PNG, "":
+		if pngLevel == "" {
+			return Default, nil
+		}
+		level, ok := pngLevels[strings.ToLower(pngLevel)]
+		if !ok {
+			return Format{}, fmt.Errorf("unknown PNG level %q (want none, fast, default or best)", pngLevel)
+		}
+		return Format{Type: PNG, PNGLevel: level}, nil
+	case JPEG, "jpg":
+		if jpegQuality == 0 {
+			jpegQuality = 90
+		}
+		if jpegQuality < 1 || jpegQuality > 100 {
+			return Format{}, fmt.Errorf("JPEG quality %d is outside 1-100", jpegQuality)
+		}
+		return Format{Type: JPEG, JPEGQuality: jpegQuality}, nil
+	case QOI:
+		return Format{Type: QOI}, nil
+	}
+	return Format{}, fmt.Errorf("unknown image format %q (want png, jpeg or qoi)", name)
+}
+
+// Ext returns the file extension, including the dot.
+func (f Format) Ext() string {
+	switch f.Type {
+	case JPEG:
+		return ".jpg"
+	case QOI:
+		return ".qoi"
+	}
+	return ".png"
+}
+
+func (f Format) ContentType() string {
+	switch f.Type {
+	case JPEG:
+		return "image/jpeg"
+	case QOI:
+		return "image/qoi"
+	}
+	return "image/png"
+}
+
+// BrowserSafe reports whether browsers can display the format, which the
+// preview pages rely on.
+func (f Format) BrowserSafe() bool {
+	return f.Type != QOI
+}
+
+// Lossless reports whether decoding the format gives back the exact pixels.
+func (f Format) Lossless() bool {
+	return f.Type != JPEG
+}
+
+func (f Format) String() string {
+	switch f.Type {
+	case JPEG:
+		return fmt.Sprintf("jpeg (quality %d)", f.JPEGQuality)
+	case QOI:
+		return "qoi"
+	}
+	for name, level := range pngLevels {
+		if level == f.PNGLevel {
+			return "png (" + name + ")"
+		}
+	}
+	return "png"
+}
+
+// Encode writes img to w in format f.
+func (f Format) Encode(w io.Writer, img image.Image) error {
+	switch f.Type {
+	case JPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: f.JPEGQuality})
+	case QOI:
+		return encodeQOI(w, img)
+	}
+	encoder := &png.Encoder{CompressionLevel: f.PNGLevel}
+	return encoder.Encode(w, img)
+}
@@ -0,0 +1,241 @@
+package imageformat
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+)
+
+// QOI ("Quite OK Image", https://qoiformat.org) is lossless and encodes in a
+// single pass with no entropy coding, several times faster than PNG.
+
+const (
+	qoiOpIndex = 0x00
+	qoiOpDiff  = 0x40
+	qoiOpLuma  = 0x80
+	qoiOpRun   = 0xc0
+	qoiOpRGB   = 0xfe
+	qoiOpRGBA  = 0xff
+
+	qoiMaxRun = 62
+
+	// qoiMaxPixels is the reference decoder's limit, which keeps a corrupt
+	// header from allocating gigabytes.
+	qoiMaxPixels = 400_000_000
+)
+
+func init() {
+	image.RegisterFormat("qoi", "qoif", decodeQOI, decodeQOIConfig)
+}
+
+var qoiEnd = []byte{0, 0, 0, 0, 0, 0, 0, 1}
+
+type qoiPixel struct{ r, g, b, a uint8 }
+
+func (p qoiPixel) hash() int {
+	return (int(p.r)*3 + int(p.g)*5 + int(p.b)*7 + int(p.a)*11) % 64
+}
+
+func encodeQOI(w io.Writer, img image.Image) error {
+	pix, stride, opaque := straightPixels(img)
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	bw := bufio.NewWriter(w)
+
+	header := make([]byte, 14)
+	copy(header, "qoif")
+	binary.BigEndian.PutUint32(header[4:], uint32(width))
+	binary.BigEndian.PutUint32(header[8:], uint32(height))
+	header[12] = 4
+	if opaque {
+		header[12] = 3
+	}
+	header[13] = 0 // sRGB with linear alpha
+	bw.Write(header)
+
+	var index [64]qoiPixel
+	prev := qoiPixel{0, 0, 0, 255}
+	run := 0
+
+	for y := 0; y < height; y++ {
+		row := pix[y*stride : y*stride+width*4]
+		for x := 0; x < len(row); x += 4 {
+			px := qoiPixel{row[x], row[x+1], row[x+2], row[x+3]}
+
+			if px == prev {
+				run++
+				if run == qoiMaxRun {
+					bw.WriteByte(qoiOpRun | byte(run-1))
+					run = 0
+				}
+				continue
+			}
+			if run > 0 {
+				bw.WriteByte(qoiOpRun | byte(run-1))
+				run = 0
+			}
+
+			h := px.hash()
+			if index[h] == px {
+				bw.WriteByte(qoiOpIndex | byte(h))
+				prev = px
+				continue
+			}
+			index[h] = px
+
+			if px.a != prev.a {
+				bw.Write([]byte{qoiOpRGBA, px.r, px.g, px.b, px.a})
+				prev = px
+				continue
+			}
+
+			dr := int8(px.r - prev.r)
+			dg := int8(px.g - prev.g)
+			db := int8(px.b - prev.b)
+			drg := dr - dg
+			dbg := db - dg
+
+			switch {
+			case dr >= -2 && dr <= 1 && dg >= -2 && dg <= 1 && db >= -2 && db <= 1:
+				bw.WriteByte(qoiOpDiff | byte(dr+2)<<4 | byte(dg+2)<<2 | byte(db+2))
+			case dg >= -32 && dg <= 31 && drg >= -8 && drg <= 7 && dbg >= -8 && dbg <= 7:
+				bw.Write([]byte{qoiOpLuma | byte(dg+32), byte(drg+8)<<4 | byte(dbg+8)})
+			default:
+				bw.Write([]byte{qoiOpRGB, px.r, px.g, px.b})
+			}
+			prev = px
+		}
+	}
+	if run > 0 {
+		bw.WriteByte(qoiOpRun | byte(run-1))
+	}
+
+	bw.Write(qoiEnd)
+	return bw.Flush()
+}
+
+func decodeQOIConfig(r io.Reader) (image.Config, error) {
+	width, height, err := readQOIHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: width, Height: height}, nil
+}
+
+func readQOIHeader(r io.Reader) (width, height int, err error) {
+	header := make([]byte, 14)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, fmt.Errorf("qoi: reading header: %w", err)
+	}
+	if string(header[:4]) != "qoif" {
+		return 0, 0, errors.New("qoi: not a QOI image")
+	}
+	w := binary.BigEndian.Uint32(header[4:])
+	h := binary.BigEndian.Uint32(header[8:])
+	if channels := header[12]; channels != 3 && channels != 4 {
+		return 0, 0, fmt.Errorf("qoi: invalid channel count %d", channels)
+	}
+	if w == 0 || h == 0 || uint64(w)*uint64(h) > qoiMaxPixels {
+		return 0, 0, fmt.Errorf("qoi: invalid size %dx%d", w, h)
+	}
+	return int(w), int(h), nil
+}
+
+// decodeQOI decodes a QOI image to NRGBA, since QOI stores straight alpha.
+func decodeQOI(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	width, height, err := readQOIHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	var index [64]qoiPixel
+	px := qoiPixel{0, 0, 0, 255}
+	run := 0
+
+	for i := 0; i < len(img.Pix); i += 4 {
+		if run > 0 {
+			run--
+		} else {
+			b, err := br.ReadByte()
+			if err != nil {
+				return nil, qoiTruncated(err)
+			}
+			switch {
+			case b == qoiOpRGB || b == qoiOpRGBA:
+				var buf [4]byte
+				n := 3
+				if b == qoiOpRGBA {
+					n = 4
+				}
+				if _, err := io.ReadFull(br, buf[:n]); err != nil {
+					return nil, qoiTruncated(err)
+				}
+				px.r, px.g, px.b = buf[0], buf[1], buf[2]
+				if b == qoiOpRGBA {
+					px.a = buf[3]
+				}
+			case b&0xc0 == qoiOpIndex:
+				px = index[b]
+			case b&0xc0 == qoiOpDiff:
+				px.r += (b>>4)&3 - 2
+				px.g += (b>>2)&3 - 2
+				px.b += b&3 - 2
+			case b&0xc0 == qoiOpLuma:
+				b2, err := br.ReadByte()
+				if err != nil {
+					return nil, qoiTruncated(err)
+				}
+				dg := b&0x3f - 32
+				px.r += dg + (b2>>4)&0x0f - 8
+				px.g += dg
+				px.b += dg + b2&0x0f - 8
+			default: // qoiOpRun
+				run = int(b & 0x3f)
+			}
+			index[px.hash()] = px
+		}
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = px.r, px.g, px.b, px.a
+	}
+
+	var end [8]byte
+	if _, err := io.ReadFull(br, end[:]); err != nil {
+		return nil, qoiTruncated(err)
+	}
+	if string(end[:]) != string(qoiEnd) {
+		return nil, errors.New("qoi: missing end marker")
+	}
+	return img, nil
+}
+
+func qoiTruncated(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("qoi: truncated image: %w", err)
+}
+
+// straightPixels returns img as non-premultiplied RGBA rows starting at
+// pix[0]. Opaque RGBA images, which is every screenshot, are used in place.
+func straightPixels(img image.Image) (pix []byte, stride int, opaque bool) {
+	switch src := img.(type) {
+	case *image.RGBA:
+		if src.Opaque() {
+			return src.Pix[src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y):], src.Stride, true
+		}
+	case *image.NRGBA:
+		return src.Pix[src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y):], src.Stride, src.Opaque()
+	}
+
+	bounds := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(nrgba, nrgba.Rect, img, bounds.Min, draw.Src)
+	return nrgba.Pix, nrgba.Stride, nrgba.Opaque()
+}
@@ -0,0 +1,169 @@
+package imageformat
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// qoiVector is an 8x1 image that uses every QOI op once, worked out by hand
+// from the specification.
+var qoiVector = struct {
+	pixels []color.NRGBA
+	data   []byte
+}{
+	pixels: []color.NRGBA{
+		{0, 0, 0, 255},      // same as the initial previous pixel: run
+		{0, 0, 0, 255},      // run of 2
+		{1, 255, 0, 255},    // diff -> 1, -1, 0
+		{11, 5, 0, 255},     // luma: dg 6, dr-dg 4, db-dg -6
+		{200, 100, 50, 255}, // rgb
+		{200, 100, 50, 128}, // rgba: alpha changed
+		{1, 255, 0, 255},    // index 51
+		{1, 255, 0, 255},    // run of 1 at the end
+	},
+	data: []byte{
+		'q', 'o', 'i', 'f', 0, 0, 0, 8, 0, 0, 0, 1, 4, 0,
+		0xc1,
+		0x76,
+		0xa6, 0xc2,
+		0xfe, 200, 100, 50,
+		0xff, 200, 100, 50, 128,
+		0x33,
+		0xc0,
+		0, 0, 0, 0, 0, 0, 0, 1,
+	},
+}
+
+func vectorImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, len(qoiVector.pixels), 1))
+	for x, c := range qoiVector.pixels {
+		img.SetNRGBA(x, 0, c)
+	}
+	return img
+}
+
+func TestQOIEncodeSpecVector(t *testing.T) {
+	var buf bytes.Buffer
+	if err := encodeQOI(&buf, vectorImage()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), qoiVector.data) {
+		t.Errorf("encoded\n% x\nwant\n% x", buf.Bytes(), qoiVector.data)
+	}
+}
+
+func TestQOIDecodeSpecVector(t *testing.T) {
+	img, format, err := image.Decode(bytes.NewReader(qoiVector.data))
+	if err != nil {
+		t.Fatalf("image.Decode: %v", err)
+	}
+	if format != "qoi" {
+		t.Errorf("format = %q, want qoi", format)
+	}
+	sameNRGBA(t, img, vectorImage())
+}
+
+func TestQOIRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	noise := image.NewRGBA(image.Rect(0, 0, 37, 23))
+	rng.Read(noise.Pix)
+	for i := 3; i < len(noise.Pix); i += 4 {
+		noise.Pix[i] = 0xff
+	}
+
+	// Small steps between neighbours give diff and luma ops.
+	gradient := image.NewRGBA(image.Rect(0, 0, 200, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 200; x++ {
+			gradient.SetRGBA(x, y, color.RGBA{uint8(x), uint8(x * 3 / 2), uint8(255 - x), 255})
+		}
+	}
+
+	// Runs longer than one op can hold, broken by a few repeated colours
+	// that come back through the index.
+	flat := image.NewRGBA(image.Rect(0, 0, 300, 3))
+	for i := 0; i < len(flat.Pix); i += 4 {
+		c := []byte{10, 20, 30, 255}
+		if i/4%97 == 0 {
+			c = []byte{200, 0, (byte(i/4/97) % 3) * 50, 255}
+		}
+		copy(flat.Pix[i:], c)
+	}
+
+	alpha := image.NewNRGBA(image.Rect(0, 0, 31, 17))
+	rng.Read(alpha.Pix)
+	for i := 3; i < len(alpha.Pix); i += 16 {
+		alpha.Pix[i] = 0xff
+	}
+
+	// Premultiplied, translucent pixels are converted to straight alpha.
+	premultiplied := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := 0; i < len(premultiplied.Pix); i += 4 {
+		a := uint8(i * 4)
+		copy(premultiplied.Pix[i:], []byte{a / 2, a / 3, a, a})
+	}
+
+	sub := noise.SubImage(image.Rect(5, 3, 30, 20))
+
+	for name, img := range map[string]image.Image{
+		"noise":         noise,
+		"gradient":      gradient,
+		"flat":          flat,
+		"alpha":         alpha,
+		"premultiplied": premultiplied,
+		"subimage":      sub,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encodeQOI(&buf, img); err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := decodeQOI(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			sameNRGBA(t, decoded, img)
+		})
+	}
+}
+
+func TestQOIDecodeErrors(t *testing.T) {
+	data := qoiVector.data
+	tests := map[string][]byte{
+		"empty":          nil,
+		"short header":   data[:10],
+		"bad magic":      append([]byte("qoix"), data[4:]...),
+		"zero width":     append(append([]byte{}, data[:4]...), append([]byte{0, 0, 0, 0}, data[8:]...)...),
+		"bad channels":   append(append([]byte{}, data[:12]...), append([]byte{5}, data[13:]...)...),
+		"truncated ops":  data[:18],
+		"no end marker":  data[:len(data)-8],
+		"bad end marker": append(append([]byte{}, data[:len(data)-1]...), 2),
+	}
+	for name, in := range tests {
+		if _, err := decodeQOI(bytes.NewReader(in)); err == nil {
+			t.Errorf("%s: decoded without an error", name)
+		}
+	}
+}
+
+// sameNRGBA compares got with want in straight alpha, origin-independent.
+func sameNRGBA(t *testing.T, got, want image.Image) {
+	t.Helper()
+	gb, wb := got.Bounds(), want.Bounds()
+	if gb.Dx() != wb.Dx() || gb.Dy() != wb.Dy() {
+		t.Fatalf("size = %dx%d, want %dx%d", gb.Dx(), gb.Dy(), wb.Dx(), wb.Dy())
+	}
+	for y := 0; y < wb.Dy(); y++ {
+		for x := 0; x < wb.Dx(); x++ {
+			g := color.NRGBAModel.Convert(got.At(gb.Min.X+x, gb.Min.Y+y))
+			w := color.NRGBAModel.Convert(want.At(wb.Min.X+x, wb.Min.Y+y))
+			if g != w {
+				t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, g, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,319 @@
+// Package localca issues the preview server's HTTPS certificate. A small
+// certificate authority of SnapHook's own is created once and kept on disk,
+// so a machine that trusts it keeps trusting the server certificate when it
+// is reissued before it expires. The CA is name-constrained to the preview's
+// hosts and private addresses, so its key cannot vouch for other sites; it is
+// replaced when the hosts outgrow its constraints or it nears expiry.
+package localca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	caCertName = "preview-ca.pem"
+	caKeyName  = "preview-ca-key.pem"
+	certName   = "preview-cert.pem"
+	keyName    = "preview-key.pem"
+
+	caLifetime = 2 * 365 * 24 * time.Hour
+	// Browsers refuse server certificates valid for longer than 398 days.
+	certLifetime = 397 * 24 * time.Hour
+	renewBefore  = 30 * 24 * time.Hour
+)
+
+// privateRanges are the addresses the CA may vouch for besides the
+// configured ones: loopback, private, shared (CGNAT, as VPNs use) and
+// link-local.
+var privateRanges = []string{
+	"127.0.0.0/8", "::1/128",
+	"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7",
+	"100.64.0.0/10",
+	"169.254.0.0/16", "fe80::/10",
+}
+
+// CAPath is the CA certificate to import on machines that open the preview.
+func CAPath(dir string) string {
+	return filepath.Join(dir, caCertName)
+}
+
+// Ensure makes sure dir holds the CA and a server certificate signed by it
+// for every name and IP address in hosts, issuing a new certificate if the
+// old one is missing, due to expire or does not cover them all. It returns
+// the certificate and key files, and whether the CA is new and has to be
+// imported again.
+func Ensure(dir string, hosts []string) (certFile, keyFile string, newCA bool, err error) {
+	certFile = filepath.Join(dir, certName)
+	keyFile = filepath.Join(dir, keyName)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", false, fmt.Errorf("failed to create certificate folder: %w", err)
+	}
+	ca, caKey, newCA, err := loadOrCreateCA(dir, hosts)
+	if err != nil {
+		return "", "", false, err
+	}
+	if !newCA && certCovers(certFile, keyFile, ca, hosts) {
+		return certFile, keyFile, false, nil
+	}
+	if err := issue(certFile, keyFile, ca, caKey, hosts); err != nil {
+		return "", "", false, err
+	}
+	return certFile, keyFile, newCA, nil
+}
+
+// loadOrCreateCA loads the CA, creating a new one if there is none, it
+// nears expiry or its name constraints do not cover hosts.
+func loadOrCreateCA(dir string, hosts []string) (*x509.Certificate, crypto.Signer, bool, error) {
+	certPath := filepath.Join(dir, caCertName)
+	keyPath := filepath.Join(dir, caKeyName)
+
+	cert, err := readCert(certPath)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && !caCovers(cert, hosts)) {
+		cert, key, err := createCA(certPath, keyPath, hosts)
+		return cert, key, err == nil, err
+	}
+	if err != nil {
+		return nil, nil, false, err
+	}
+	key, err := readKey(keyPath)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return cert, key, false, nil
+}
+
+func createCA(certPath, keyPath string, hosts []string) (*x509.Certificate, crypto.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA key: %w", err)
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:                serial,
+		Subject:                     pkix.Name{CommonName: "SnapHook Local CA"},
+		NotBefore:                   now.Add(-time.Hour),
+		NotAfter:                    now.Add(caLifetime),
+		KeyUsage:                    x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid:       true,
+		IsCA:                        true,
+		MaxPathLenZero:              true,
+		PermittedDNSDomainsCritical: true,
+	}
+	template.PermittedDNSDomains, template.PermittedIPRanges = constraints(hosts)
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+
+	if err := writeKey(keyPath, key); err != nil {
+		return nil, nil, err
+	}
+	if err := writePEM(certPath, "CERTIFICATE", der, 0644); err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+func issue(certFile, keyFile string, ca *x509.Certificate, caKey crypto.Signer, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate key: %w", err)
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(certLifetime)
+	if notAfter.After(ca.NotAfter) {
+		notAfter = ca.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "SnapHook Preview"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %w", err)
+	}
+	if err := writeKey(keyFile, key); err != nil {
+		return err
+	}
+	return writePEM(certFile, "CERTIFICATE", der, 0644)
+}
+
+// constraints returns the names and addresses a CA for hosts may vouch for:
+// localhost, the host names, the private ranges and any other address in
+// hosts.
+func constraints(hosts []string) (domains []string, ranges []*net.IPNet) {
+	domains = []string{"localhost"}
+	for _, cidr := range privateRanges {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		ranges = append(ranges, ipNet)
+	}
+	for _, host := range hosts {
+		ip := net.ParseIP(host)
+		switch {
+		case ip == nil:
+			if !slices.Contains(domains, host) {
+				domains = append(domains, host)
+			}
+		case !inRanges(ip, ranges):
+			bits := 8 * len(ip.To16())
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			ranges = append(ranges, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		}
+	}
+	return domains, ranges
+}
+
+// caCovers reports whether ca can still be used: it is name-constrained, is
+// not close to expiry and permits every host.
+func caCovers(ca *x509.Certificate, hosts []string) bool {
+	if !ca.PermittedDNSDomainsCritical || time.Now().Add(renewBefore).After(ca.NotAfter) {
+		return false
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			if !inRanges(ip, ca.PermittedIPRanges) {
+				return false
+			}
+		} else if !slices.ContainsFunc(ca.PermittedDNSDomains, func(domain string) bool {
+			return strings.EqualFold(host, domain) || strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(domain))
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+func inRanges(ip net.IP, ranges []*net.IPNet) bool {
+	return slices.ContainsFunc(ranges, func(r *net.IPNet) bool { return r.Contains(ip) })
+}
+
+// certCovers reports whether the certificate in certFile can still be used:
+// it has its key, was signed by ca, is not close to expiry and is valid for
+// every host.
+func certCovers(certFile, keyFile string, ca *x509.Certificate, hosts []string) bool {
+	cert, err := readCert(certFile)
+	if err != nil {
+		return false
+	}
+	if _, err := readKey(keyFile); err != nil {
+		return false
+	}
+	if cert.CheckSignatureFrom(ca) != nil || time.Now().Add(renewBefore).After(cert.NotAfter) {
+		return false
+	}
+	for _, host := range hosts {
+		if cert.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func newSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate serial: %w", err)
+	}
+	return serial, nil
+}
+
+func readCert(path string) (*x509.Certificate, error) {
+	block, err := readPEM(path, "CERTIFICATE")
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate in %s: %w", path, err)
+	}
+	return cert, nil
+}
+
+func readKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key in %s: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("invalid private key in %s", path)
+	}
+	return signer, nil
+}
+
+func readPEM(path, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s does not hold a PEM %s", path, blockType)
+	}
+	return block.Bytes, nil
+}
+
+func writeKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode private key: %w", err)
+	}
+	return writePEM(path, "PRIVATE KEY", der, 0600)
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package localca
+
+import (
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+)
+
+func verify(t *testing.T, dir, certFile, host string) error {
+	t.Helper()
+	ca, err := readCert(CAPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := readCert(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	_, err = cert.Verify(x509.VerifyOptions{DNSName: host, Roots: roots})
+	return err
+}
+
+func TestEnsure(t *testing.T) {
+	dir := t.TempDir()
+	hosts := []string{"localhost", "127.0.0.1", "::1", "my-pc.vpn.example.com", "192.168.1.20", "203.0.113.5"}
+
+	certFile, _, newCA, err := Ensure(dir, hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !newCA {
+		t.Error("the first Ensure did not report a new CA")
+	}
+	for _, host := range hosts {
+		if err := verify(t, dir, certFile, host); err != nil {
+			t.Errorf("certificate does not verify for %s: %v", host, err)
+		}
+	}
+
+	if _, _, newCA, err := Ensure(dir, hosts); err != nil || newCA {
+		t.Errorf("Ensure with the same hosts = new CA %v, %v; want the old CA", newCA, err)
+	}
+	if _, _, newCA, err := Ensure(dir, hosts[:3]); err != nil || newCA {
+		t.Errorf("Ensure with fewer hosts = new CA %v, %v; want the old CA", newCA, err)
+	}
+}
+
+// The CA must not be able to vouch for names and addresses outside the
+// preview's own.
+func TestCAIsNameConstrained(t *testing.T) {
+	dir := t.TempDir()
+	if _, _, _, err := Ensure(dir, []string{"localhost", "127.0.0.1", "my-pc.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	ca, err := readCert(CAPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKey, err := readKey(filepath.Join(dir, caKeyName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forged := filepath.Join(dir, "forged.pem")
+	for _, host := range []string{"bank.example.org", "example.com", "8.8.8.8"} {
+		if err := issue(forged, filepath.Join(dir, "forged-key.pem"), ca, caKey, []string{host}); err != nil {
+			t.Fatal(err)
+		}
+		if err := verify(t, dir, forged, host); err == nil {
+			t.Errorf("a certificate for %s verifies against the CA", host)
+		}
+	}
+}
+
+func TestEnsureReplacesCAForNewHosts(t *testing.T) {
+	dir := t.TempDir()
+	if _, _, _, err := Ensure(dir, []string{"localhost"}); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := []string{"localhost", "other-pc.example.net"}
+	certFile, _, newCA, err := Ensure(dir, hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !newCA {
+		t.Error("a host outside the CA's constraints did not get a new CA")
+	}
+	if err := verify(t, dir, certFile, "other-pc.example.net"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,255 @@
+// Package nametemplate expands auto-save filename templates such as
+// "{date:2006/01}/{time}_{monitor}_{seq}.{ext}". A "/" in the template or in
+// an expanded date or time layout starts a subfolder.
+//
+// Tokens:
+//
+//	{date} {date:layout}  capture date, Go layout, default 2006-01-02
+//	{time} {time:layout}  capture time, Go layout, default 15-04-05
+//	{mode}                capture mode (monitor, region, all, window)
+//	{monitor}             1-based display number, or "all" if the shot spans several
+//	{host}                hostname
+//	{seq} {seq:width}     sequence number, zero-padded to width, one more
+//	                      than the highest already used for the name
+//	{ext}                 file extension without the dot
+package nametemplate
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default matches the names SnapHook used before templates existed.
+const Default = "screenshot_{date}_{time}.{ext}"
+
+// Vars are the values a template can refer to.
+type Vars struct {
+	Time time.Time
+	Mode string
+	// Monitor is the 0-based display index, or -1 for several displays.
+	Monitor int
+	Host    string
+	Ext     string
+}
+
+type part struct {
+	literal string
+	token   string
+	arg     string
+}
+
+// Template is a parsed template.
+type Template struct {
+	source string
+	parts  []part
+	hasSeq bool
+	hasExt bool
+}
+
+var tokens = map[string]bool{
+	"date": true, "time": true, "mode": true, "monitor": true,
+	"host": true, "seq": true, "ext": true,
+}
+
+// Parse checks s and splits it into literals and tokens. An empty s is
+// Default.
+func Parse(s string) (*Template, error) {
+	if strings.TrimSpace(s) == "" {
+		s = Default
+	}
+
+	t := &Template{source: s}
+	rest := s
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			t.parts = append(t.parts, part{literal: rest})
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, part{literal: rest[:open]})
+		}
+
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("template %q: unclosed {", s)
+		}
+		body := rest[open+1 : open+end]
+		rest = rest[open+end+1:]
+
+		name, arg, _ := strings.Cut(body, ":")
+		if !tokens[name] {
+			return nil, fmt.Errorf("template %q: unknown token {%s}", s, body)
+		}
+		if name == "seq" && arg != "" {
+			if width, err := strconv.Atoi(arg); err != nil || width < 1 || width > 9 {
+				return nil, fmt.Errorf("template %q: {seq:%s} needs a width from 1 to 9", s, arg)
+			}
+		}
+		if arg != "" && name != "seq" && name != "date" && name != "time" {
+			return nil, fmt.Errorf("template %q: {%s} takes no argument", s, name)
+		}
+
+		t.parts = append(t.parts, part{token: name, arg: arg})
+		t.hasSeq = t.hasSeq || name == "seq"
+		t.hasExt = t.hasExt || name == "ext"
+	}
+
+	if strings.ContainsAny(s, `\`) {
+		return nil, fmt.Errorf("template %q: use / to separate folders", s)
+	}
+	if strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("template %q must be relative to the save directory", s)
+	}
+	for _, segment := range strings.Split(s, "/") {
+		if segment == ".." {
+			return nil, fmt.Errorf("template %q must stay inside the save directory", s)
+		}
+	}
+
+	return t, nil
+}
+
+func (t *Template) String() string {
+	return t.source
+}
+
+// Expand returns the slash-separated relative path for v and sequence number
+// seq (starting at 1). Without a {seq} token, seq 1 adds nothing and later
+// numbers are appended as "_2", "_3" before the extension, so callers can
+// always resolve collisions by counting up. Without an {ext} token the
+// extension is appended.
+func (t *Template) Expand(v Vars, seq int) string {
+	suffix := ""
+	if seq > 1 {
+		suffix = "_" + strconv.Itoa(seq)
+	}
+	return t.expand(v, func(width string) string { return formatSeq(width, seq) }, suffix)
+}
+
+// seqMark stands for the sequence number in Glob and Match; clean leaves it
+// alone.
+const seqMark = "\x00"
+
+// Glob returns a filepath.Glob pattern, slash-separated, that matches every
+// name Expand gives for v, whatever the sequence number. It may match other
+// names too; Match tells them apart.
+func (t *Template) Glob(v Vars) string {
+	return strings.ReplaceAll(t.expand(v, func(string) string { return seqMark }, seqMark), seqMark, "*")
+}
+
+// Match reports whether rel, a slash-separated relative path, is what Expand
+// gives for v and some sequence number, and returns that number.
+func (t *Template) Match(v Vars, rel string) (seq int, ok bool) {
+	if !t.hasSeq && rel == t.Expand(v, 1) {
+		return 1, true
+	}
+
+	numbered := t.expand(v, func(string) string { return seqMark }, "_"+seqMark)
+	re, err := regexp.Compile("^" + strings.ReplaceAll(regexp.QuoteMeta(numbered), seqMark, `(\d+)`) + "$")
+	if err != nil {
+		return 0, false
+	}
+	m := re.FindStringSubmatch(rel)
+	if m == nil {
+		return 0, false
+	}
+	for _, digits := range m[1:] {
+		n, err := strconv.Atoi(digits)
+		if err != nil || (seq != 0 && n != seq) {
+			return 0, false
+		}
+		seq = n
+	}
+	// Without {seq}, the first name has no number, so "_1" is not one.
+	if !t.hasSeq && seq < 2 {
+		return 0, false
+	}
+	return seq, true
+}
+
+// expand builds the path with seqText for each {seq} token and, for
+// templates without one, suffix before the extension.
+func (t *Template) expand(v Vars, seqText func(width string) string, suffix string) string {
+	var b strings.Builder
+	for _, p := range t.parts {
+		switch p.token {
+		case "":
+			b.WriteString(p.literal)
+		case "seq":
+			b.WriteString(seqText(p.arg))
+		default:
+			b.WriteString(t.value(p, v))
+		}
+	}
+
+	name := b.String()
+	if !t.hasExt && v.Ext != "" {
+		name += "." + v.Ext
+	}
+	if !t.hasSeq && suffix != "" {
+		ext := path.Ext(name)
+		name = strings.TrimSuffix(name, ext) + suffix + ext
+	}
+	return clean(name)
+}
+
+func formatSeq(width string, seq int) string {
+	if width != "" {
+		return fmt.Sprintf("%0*d", mustAtoi(width), seq)
+	}
+	return strconv.Itoa(seq)
+}
+
+func (t *Template) value(p part, v Vars) string {
+	switch p.token {
+	case "date":
+		return v.Time.Format(layoutOr(p.arg, "2006-01-02"))
+	case "time":
+		return v.Time.Format(layoutOr(p.arg, "15-04-05"))
+	case "mode":
+		return v.Mode
+	case "monitor":
+		if v.Monitor < 0 {
+			return "all"
+		}
+		return strconv.Itoa(v.Monitor + 1)
+	case "host":
+		return strings.ReplaceAll(v.Host, "/", "_")
+	case "ext":
+		return v.Ext
+	}
+	return ""
+}
+
+func layoutOr(layout, fallback string) string {
+	if layout == "" {
+		return fallback
+	}
+	return layout
+}
+
+func mustAtoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// clean replaces characters Windows does not allow in names, so a layout
+// like "15:04" still gives a valid file, and drops empty and "." segments.
+func clean(name string) string {
+	replacer := strings.NewReplacer(":", "-", "*", "_", "?", "_", `"`, "_", "<", "_", ">", "_", "|", "_")
+
+	var segments []string
+	for _, segment := range strings.Split(name, "/") {
+		segment = strings.TrimSpace(replacer.Replace(segment))
+		if segment == "" || segment == "." || segment == ".." {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, "/")
+}
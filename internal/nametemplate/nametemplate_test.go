@@ -0,0 +1,125 @@
+package nametemplate
+
+import (
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+var vars = Vars{
+	Time:    time.Date(2026, 3, 7, 9, 5, 4, 0, time.UTC),
+	Mode:    "region",
+	Monitor: 1,
+	Host:    "desk/top",
+	Ext:     "png",
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		v    Vars
+		seq  int
+		want string
+	}{
+		{"", vars, 1, "screenshot_2026-03-07_09-05-04.png"},
+		{"   ", vars, 2, "screenshot_2026-03-07_09-05-04_2.png"},
+		{"{date:2006/01}/{time}_{monitor}_{seq}.{ext}", vars, 7, "2026/03/09-05-04_2_7.png"},
+		{"{mode}-{seq:4}", vars, 12, "region-0012.png"},
+		{"{mode}-{seq:4}", vars, 123456, "region-123456.png"},
+		{"{seq:1}", vars, 3, "3.png"},
+		{"shot", vars, 1, "shot.png"},
+		{"shot", vars, 3, "shot_3.png"},
+		{"shot.{ext}", Vars{Ext: "qoi"}, 2, "shot_2.qoi"},
+		{"{monitor}", Vars{Monitor: -1, Ext: "png"}, 1, "all.png"},
+		// Separators in values do not make folders.
+		{"{host}", vars, 1, "desk_top.png"},
+		// Characters Windows rejects are replaced.
+		{"{time:15:04:05}", vars, 1, "09-05-04.png"},
+		{`a?b*c"d<e>f|g`, vars, 1, "a_b_c_d_e_f_g.png"},
+		// Empty, "." and blank segments are dropped.
+		{"a//./ b /{mode}", vars, 1, "a/b/region.png"},
+		{"{date:.}/x", vars, 1, "x.png"},
+	}
+	for _, tt := range tests {
+		tmpl, err := Parse(tt.tmpl)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.tmpl, err)
+			continue
+		}
+		if got := tmpl.Expand(tt.v, tt.seq); got != tt.want {
+			t.Errorf("Parse(%q).Expand(seq %d) = %q, want %q", tt.tmpl, tt.seq, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		tmpl, want string
+	}{
+		{"{date", "unclosed"},
+		{"{nope}", "unknown token"},
+		{"{}", "unknown token"},
+		{"{Date}", "unknown token"},
+		{"{seq:0}", "width from 1 to 9"},
+		{"{seq:10}", "width from 1 to 9"},
+		{"{seq:x}", "width from 1 to 9"},
+		{"{mode:x}", "takes no argument"},
+		{"{ext:png}", "takes no argument"},
+		{`a\b`, "use / to separate folders"},
+		{"/abs/{seq}", "relative to the save directory"},
+		{"../{seq}", "inside the save directory"},
+		{"a/../../{seq}", "inside the save directory"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.tmpl)
+		if err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", tt.tmpl)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %q, want it to mention %q", tt.tmpl, err, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, s := range []string{"", "{date:2006/01}/{time}_{seq:3}.{ext}", "{mode}/{seq}-{seq}", "{time}"} {
+		tmpl, err := Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, seq := range []int{1, 2, 9, 10, 1234} {
+			rel := tmpl.Expand(vars, seq)
+			got, ok := tmpl.Match(vars, rel)
+			if !ok || got != seq {
+				t.Errorf("%q: Match(%q) = %d, %v, want %d", s, rel, got, ok, seq)
+			}
+			if ok, _ := path.Match(tmpl.Glob(vars), rel); !ok {
+				t.Errorf("%q: Glob %q does not match %q", s, tmpl.Glob(vars), rel)
+			}
+		}
+	}
+}
+
+func TestMatchRejects(t *testing.T) {
+	tests := []struct {
+		tmpl, rel string
+	}{
+		{"", "screenshot_2026-03-07_09-05-04_1.png"},
+		{"", "screenshot_2026-03-07_09-05-04_x.png"},
+		{"", "screenshot_2026-03-07_09-05-05.png"},
+		{"", "holiday.png"},
+		{"{mode}/{seq}-{seq}", "region/2-3.png"},
+		{"{seq:3}", "12.jpg"},
+	}
+	for _, tt := range tests {
+		tmpl, err := Parse(tt.tmpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seq, ok := tmpl.Match(vars, tt.rel); ok {
+			t.Errorf("%q: Match(%q) = %d, want no match", tt.tmpl, tt.rel, seq)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Package phash computes perceptual hashes, which change little when an
+// image changes little, so near-identical screenshots can be spotted by the
+// Hamming distance between their hashes.
+package phash
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"strconv"
+)
+
+// Hash is a 64-bit difference hash.
+type Hash uint64
+
+// Distance returns the number of bits in which h and other differ, from 0
+// for identical hashes to 64.
+func (h Hash) Distance(other Hash) int {
+	return bits.OnesCount64(uint64(h ^ other))
+}
+
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// Parse reads a hash written by String.
+func Parse(s string) (Hash, error) {
+	v, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid perceptual hash %q", s)
+	}
+	return Hash(v), nil
+}
+
+// DHash returns the difference hash of img: the image is averaged down to a
+// 9x8 grayscale grid, and each bit records whether a cell is brighter than
+// its right-hand neighbour. Every pixel contributes, so a change to a small
+// area (a clock ticking) moves few bits or none.
+func DHash(img *image.RGBA) Hash {
+	const cols, rows = 9, 8
+
+	b := img.Rect
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return 0
+	}
+
+	// Pixel x belongs to column x*cols/w, so each column is a contiguous
+	// span of every row and can be summed with a local accumulator.
+	var spans [cols + 1]int
+	for c := range spans {
+		spans[c] = (c*w + cols - 1) / cols
+	}
+
+	var sums [rows][cols]uint64
+	var rowCounts [rows]uint64
+	for y := 0; y < h; y++ {
+		r := y * rows / h
+		rowCounts[r]++
+		row := img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):]
+		for c := 0; c < cols; c++ {
+			span := row[spans[c]*4 : spans[c+1]*4]
+			var sum uint64
+			for i := 0; i+3 < len(span); i += 4 {
+				// Rec. 601 luma in 8-bit fixed point.
+				sum += uint64(span[i])*77 + uint64(span[i+1])*150 + uint64(span[i+2])*29
+			}
+			sums[r][c] += sum
+		}
+	}
+
+	var hash Hash
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols-1; c++ {
+			left := avg(sums[r][c], rowCounts[r]*uint64(spans[c+1]-spans[c]))
+			right := avg(sums[r][c+1], rowCounts[r]*uint64(spans[c+2]-spans[c+1]))
+			hash <<= 1
+			if left < right {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+func avg(sum, count uint64) uint64 {
+	if count == 0 {
+		return 0
+	}
+	return sum / count
+}
@@ -0,0 +1,459 @@
+package preview
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"snaphook/internal/capture"
+	"snaphook/internal/history"
+)
+
+// The /api/v1 endpoints serve JSON for scripts. Captures are the entries of
+// the capture history, addressed by their history IDs:
+//
+//	GET    /api/v1/captures               list, newest first
+//	POST   /api/v1/captures               take a capture
+//	GET    /api/v1/captures/{id}          one capture
+//	PATCH  /api/v1/captures/{id}          set pinned and tags
+//	DELETE /api/v1/captures/{id}          forget it and delete its files
+//	GET    /api/v1/captures/{id}/image    the image
+//	GET    /api/v1/settings               current settings
+//	PATCH  /api/v1/settings               change some settings
+//
+// Errors are {"error": "..."} with a matching status code.
+
+const (
+	apiDefaultLimit = 50
+	apiMaxLimit     = 500
+	apiMaxBody      = 1 << 20
+)
+
+// ErrCaptureBusy is what a CaptureRequest's receiver sends back when a
+// capture is already running.
+var ErrCaptureBusy = errors.New("a capture is already in progress")
+
+// CaptureRequest asks for a capture in Mode, or in the tray's mode if Mode
+// is empty. The receiver answers on Result once the capture has started.
+type CaptureRequest struct {
+	Mode   string
+	Result chan error
+}
+
+// Settings are the settings the API exposes. SaveDir is the configured
+// folder and AutoSaveDir the folder it resolves to; AutoSaveDir and
+// EnablePreview cannot be changed through the API.
+type Settings struct {
+	Hotkey          string `json:"hotkey"`
+	CaptureMode     string `json:"capture_mode"`
+	CaptureDelay    int    `json:"capture_delay"`
+	CopyToClipboard bool   `json:"copy_to_clipboard"`
+	AutoSave        bool   `json:"auto_save"`
+	SaveDir         string `json:"save_dir"`
+	AutoSaveDir     string `json:"auto_save_dir"`
+	EnablePreview   bool   `json:"enable_preview"`
+}
+
+// SettingsPatch is a partial settings update; nil fields are left alone.
+type SettingsPatch struct {
+	Hotkey          *string `json:"hotkey"`
+	CaptureMode     *string `json:"capture_mode"`
+	CaptureDelay    *int    `json:"capture_delay"`
+	CopyToClipboard *bool   `json:"copy_to_clipboard"`
+	AutoSave        *bool   `json:"auto_save"`
+	SaveDir         *string `json:"save_dir"`
+}
+
+// SettingsChange is a settings update from the API, answered on Result like
+// HotkeyChange.
+type SettingsChange struct {
+	Patch  SettingsPatch
+	Result chan error
+}
+
+// InvalidSettingsError is answered on SettingsChange.Result when the patch
+// was rejected before anything was changed.
+type InvalidSettingsError struct {
+	Err error
+}
+
+func (e *InvalidSettingsError) Error() string { return e.Err.Error() }
+func (e *InvalidSettingsError) Unwrap() error { return e.Err }
+
+// unansweredError is sendAndWait's error when nothing took or answered the
+// request in time.
+type unansweredError string
+
+func (e unansweredError) Error() string { return string(e) }
+
+var (
+	captureRequestChan = make(chan CaptureRequest, 10)
+	settingsChangeChan = make(chan SettingsChange, 10)
+	settingsSource     func() Settings
+	settingsMutex      sync.RWMutex
+)
+
+func GetCaptureRequestChan() <-chan CaptureRequest {
+	return captureRequestChan
+}
+
+func GetSettingsChangeChan() <-chan SettingsChange {
+	return settingsChangeChan
+}
+
+// SetSettingsSource registers the function GET /api/v1/settings reports.
+func SetSettingsSource(source func() Settings) {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	settingsSource = source
+}
+
+func getSettings() (Settings, bool) {
+	settingsMutex.RLock()
+	source := settingsSource
+	settingsMutex.RUnlock()
+	if source == nil {
+		return Settings{}, false
+	}
+	return source(), true
+}
+
+// apiCapture is a history entry as the API returns it.
+type apiCapture struct {
+	history.Entry
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+func newAPICapture(e history.Entry) apiCapture {
+	c := apiCapture{Entry: e}
+	if e.Path != "" || findSessionShot(e.ID) != nil {
+		c.ImageURL = "/api/v1/captures/" + e.ID + "/image"
+	}
+	return c
+}
+
+func registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/captures", apiHandler(func(w http.ResponseWriter, r *http.Request, store *history.Store) {
+		params := r.URL.Query()
+		q := history.Query{
+			Mode:           params.Get("mode"),
+			Tag:            params.Get("tag"),
+			SkipDuplicates: params.Get("duplicates") == "false",
+			Limit:          apiDefaultLimit,
+		}
+
+		var err error
+		if q.Limit, err = intParam(params.Get("limit"), apiDefaultLimit, 1, apiMaxLimit); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("limit: %w", err))
+			return
+		}
+		if q.Offset, err = intParam(params.Get("offset"), 0, 0, -1); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("offset: %w", err))
+			return
+		}
+		if q.Since, err = timeParam(params.Get("since")); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("since: %w", err))
+			return
+		}
+		if q.Until, err = timeParam(params.Get("until")); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("until: %w", err))
+			return
+		}
+
+		limit := q.Limit
+		q.Limit++ // one extra tells whether there is a next page
+		entries, err := store.List(q)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		more := len(entries) > limit
+		if more {
+			entries = entries[:limit]
+		}
+
+		captures := make([]apiCapture, len(entries))
+		for i, e := range entries {
+			captures[i] = newAPICapture(e)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"captures": captures,
+			"offset":   q.Offset,
+			"limit":    limit,
+			"has_more": more,
+		})
+	}))
+
+	mux.HandleFunc("POST /api/v1/captures", func(w http.ResponseWriter, r *http.Request) {
+		touchRequest()
+
+		var body struct {
+			Mode string `json:"mode"`
+		}
+		if r.ContentLength != 0 {
+			if err := decodeJSON(w, r, &body); err != nil {
+				writeAPIError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if body.Mode != "" && !capture.Mode(body.Mode).Valid() {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("unknown capture mode %q", body.Mode))
+			return
+		}
+
+		req := CaptureRequest{Mode: body.Mode, Result: make(chan error, 1)}
+		err := sendAndWait(captureRequestChan, req, req.Result, "captures")
+		switch {
+		case errors.Is(err, ErrCaptureBusy):
+			writeAPIError(w, http.StatusConflict, err)
+		case err != nil:
+			writeAPIError(w, http.StatusServiceUnavailable, err)
+		default:
+			// The capture finishes later, possibly after a countdown or a
+			// region selection; poll the list for it.
+			writeJSON(w, http.StatusAccepted, map[string]any{"status": "started"})
+		}
+	})
+
+	mux.HandleFunc("GET /api/v1/captures/{id}", apiCaptureHandler(func(w http.ResponseWriter, r *http.Request, store *history.Store, e history.Entry) {
+		writeJSON(w, http.StatusOK, newAPICapture(e))
+	}))
+
+	mux.HandleFunc("PATCH /api/v1/captures/{id}", apiCaptureHandler(func(w http.ResponseWriter, r *http.Request, store *history.Store, e history.Entry) {
+		var patch struct {
+			Pinned *bool     `json:"pinned"`
+			Tags   *[]string `json:"tags"`
+		}
+		if err := decodeJSON(w, r, &patch); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		var err error
+		if patch.Pinned != nil {
+			err = pinEntry(store, e.ID, *patch.Pinned)
+		}
+		if err == nil && patch.Tags != nil {
+			_, err = store.SetTags(e.ID, *patch.Tags...)
+		}
+		if err == nil {
+			e, err = store.Get(e.ID)
+		}
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newAPICapture(e))
+	}))
+
+	mux.HandleFunc("DELETE /api/v1/captures/{id}", apiCaptureHandler(func(w http.ResponseWriter, r *http.Request, store *history.Store, e history.Entry) {
+		if err := deleteCapture(store, e); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	mux.HandleFunc("GET /api/v1/captures/{id}/image", apiCaptureHandler(func(w http.ResponseWriter, r *http.Request, store *history.Store, e history.Entry) {
+		if shot := findSessionShot(e.ID); shot != nil {
+			format := getImageFormat()
+			data, err := shot.Encode(format)
+			if err != nil {
+				writeAPIError(w, http.StatusInternalServerError, err)
+				return
+			}
+			w.Header().Set("Content-Type", format.ContentType())
+			w.Write(data)
+			return
+		}
+
+		if e.Path == "" {
+			writeAPIError(w, http.StatusNotFound, errors.New("the capture was not saved and is no longer in memory"))
+			return
+		}
+		file, err := os.Open(e.Path)
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, errors.New("the saved file is missing"))
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			writeAPIError(w, http.StatusNotFound, errors.New("the saved file is missing"))
+			return
+		}
+		http.ServeContent(w, r, filepath.Base(e.Path), info.ModTime(), file)
+	}))
+
+	mux.HandleFunc("GET /api/v1/settings", func(w http.ResponseWriter, r *http.Request) {
+		touchRequest()
+
+		settings, ok := getSettings()
+		if !ok {
+			writeAPIError(w, http.StatusServiceUnavailable, errors.New("settings are not available"))
+			return
+		}
+		writeJSON(w, http.StatusOK, settings)
+	})
+
+	mux.HandleFunc("PATCH /api/v1/settings", func(w http.ResponseWriter, r *http.Request) {
+		touchRequest()
+
+		var patch SettingsPatch
+		if err := decodeJSON(w, r, &patch); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		change := SettingsChange{Patch: patch, Result: make(chan error, 1)}
+		err := sendAndWait(settingsChangeChan, change, change.Result, "settings changes")
+		var invalid *InvalidSettingsError
+		var unanswered unansweredError
+		switch {
+		case errors.As(err, &invalid):
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		case errors.As(err, &unanswered):
+			writeAPIError(w, http.StatusServiceUnavailable, err)
+			return
+		case err != nil:
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		settings, _ := getSettings()
+		writeJSON(w, http.StatusOK, settings)
+	})
+
+	// Without this, unknown API paths and methods would get the HTML page.
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("no such endpoint: %s %s", r.Method, r.URL.Path))
+	})
+}
+
+func touchRequest() {
+	requestMutex.Lock()
+	lastRequest = time.Now()
+	requestMutex.Unlock()
+}
+
+// apiHandler wraps handlers that need the capture history.
+func apiHandler(h func(http.ResponseWriter, *http.Request, *history.Store)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		touchRequest()
+
+		store := getHistory()
+		if store == nil {
+			writeAPIError(w, http.StatusServiceUnavailable, errors.New("capture history is not available"))
+			return
+		}
+		h(w, r, store)
+	}
+}
+
+// apiCaptureHandler wraps handlers for /api/v1/captures/{id}, looking the
+// capture up first.
+func apiCaptureHandler(h func(http.ResponseWriter, *http.Request, *history.Store, history.Entry)) http.HandlerFunc {
+	return apiHandler(func(w http.ResponseWriter, r *http.Request, store *history.Store) {
+		e, err := store.Get(r.PathValue("id"))
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		h(w, r, store, e)
+	})
+}
+
+// sendAndWait hands v to whoever reads ch and waits for its answer on
+// result, like applyHotkeyChange.
+func sendAndWait[T any](ch chan T, v T, result chan error, what string) error {
+	select {
+	case ch <- v:
+	default:
+		return unansweredError(fmt.Sprintf("%s are not being processed", what))
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(10 * time.Second):
+		return unansweredError(fmt.Sprintf("timed out waiting for %s to be processed", what))
+	}
+}
+
+// deleteCapture deletes a capture's saved file, its history entry and its
+// shot in this session.
+func deleteCapture(store *history.Store, e history.Entry) error {
+	if e.Path != "" {
+		if err := os.Remove(e.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete %s: %w", e.Path, err)
+		}
+	}
+	if err := store.Delete(e.ID); err != nil {
+		return err
+	}
+	removeSessionShot(e.ID)
+	return nil
+}
+
+// intParam parses a query parameter from lo to hi, or from lo up if hi is
+// negative.
+func intParam(s string, fallback, lo, hi int) (int, error) {
+	if s == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < lo || (hi >= 0 && n > hi) {
+		if hi >= 0 {
+			return 0, fmt.Errorf("must be a number from %d to %d", lo, hi)
+		}
+		return 0, fmt.Errorf("must be a number of at least %d", lo)
+	}
+	return n, nil
+}
+
+func timeParam(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("must be an RFC 3339 time such as 2006-01-02T15:04:05Z")
+	}
+	return t, nil
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, history.ErrNotFound) {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+	writeAPIError(w, http.StatusInternalServerError, err)
+}
@@ -0,0 +1,419 @@
+package preview
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"snaphook/internal/capture"
+	"snaphook/internal/history"
+)
+
+const archivePageSize = 60
+
+var (
+	historyStore *history.Store
+	historyMutex sync.RWMutex
+)
+
+// SetHistory makes the capture history index browsable at /archive. Unlike
+// the session history, it survives restarts.
+func SetHistory(store *history.Store) {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	historyStore = store
+}
+
+func getHistory() *history.Store {
+	historyMutex.RLock()
+	defer historyMutex.RUnlock()
+	return historyStore
+}
+
+func registerArchive(mux *http.ServeMux) {
+	mux.HandleFunc("/archive", func(w http.ResponseWriter, r *http.Request) {
+		requestMutex.Lock()
+		lastRequest = time.Now()
+		requestMutex.Unlock()
+
+		store := getHistory()
+		if store == nil {
+			http.Error(w, "Capture history is not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		params := r.URL.Query()
+		offset, _ := strconv.Atoi(params.Get("offset"))
+		offset = max(offset, 0)
+		query := history.Query{
+			Mode:           params.Get("mode"),
+			Tag:            params.Get("tag"),
+			SkipDuplicates: params.Get("nodups") == "1",
+			Offset:         offset,
+			// One extra tells whether there is a next page.
+			Limit: archivePageSize + 1,
+		}
+		entries, err := store.List(query)
+		if err != nil {
+			http.Error(w, "Failed to read capture history", http.StatusInternalServerError)
+			return
+		}
+		more := len(entries) > archivePageSize
+		if more {
+			entries = entries[:archivePageSize]
+		}
+
+		page := `<!DOCTYPE html>
+<html>
+<head>
+    <title>SnapHook - All Captures</title>
+    <style>
+        body {
+            margin: 0;
+            padding: 20px;
+            background: #1e1e1e;
+            font-family: Arial;
+            color: #fff;
+        }
+        h1 {
+            text-align: center;
+            color: #888;
+        }
+        .filters, .button-group, .pager {
+            text-align: center;
+            margin: 20px 0;
+        }
+        .filters input, .filters select {
+            padding: 8px;
+            background: #2a2a2a;
+            color: #fff;
+            border: 1px solid #444;
+            border-radius: 4px;
+            margin: 0 4px;
+        }
+        .gallery {
+            display: grid;
+            grid-template-columns: repeat(auto-fill, minmax(200px, 1fr));
+            gap: 20px;
+            padding: 20px;
+        }
+        .thumbnail {
+            background: #2a2a2a;
+            border-radius: 8px;
+            overflow: hidden;
+            position: relative;
+        }
+        .pin-text {
+            position: absolute;
+            top: 8px;
+            left: 8px;
+            background: #555;
+            padding: 6px 12px;
+            border-radius: 4px;
+            font-size: 12px;
+            font-weight: bold;
+            cursor: pointer;
+            opacity: 0;
+            transition: opacity 0.2s;
+        }
+        .thumbnail:hover .pin-text, .pin-text.pinned {
+            opacity: 1;
+        }
+        .pin-text.pinned {
+            background: #2196F3;
+        }
+        .thumbnail img, .thumbnail .missing {
+            width: 100%;
+            height: 150px;
+            object-fit: cover;
+        }
+        .thumbnail img {
+            cursor: pointer;
+        }
+        .thumbnail .missing {
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            color: #666;
+            font-size: 13px;
+        }
+        .thumbnail .info {
+            padding: 10px;
+            text-align: center;
+            font-size: 12px;
+            color: #888;
+            line-height: 1.5;
+        }
+        .tag {
+            display: inline-block;
+            background: #3a3a3a;
+            color: #ccc;
+            border-radius: 3px;
+            padding: 1px 6px;
+            margin: 2px;
+        }
+        a, button {
+            padding: 10px 20px;
+            color: white;
+            background: #4CAF50;
+            border: none;
+            border-radius: 4px;
+            font-size: 14px;
+            cursor: pointer;
+            margin: 4px;
+            text-decoration: none;
+            display: inline-block;
+        }
+        a:hover, button:hover {
+            background: #45a049;
+        }
+        .empty {
+            text-align: center;
+            color: #666;
+        }
+    </style>
+</head>
+<body>
+    <h1>All Captures</h1>
+    <div class="button-group">
+        <a href="/">Back to Latest</a>
+        <a href="/history">Session History</a>
+    </div>
+    <form class="filters" method="GET" action="/archive">
+        <select name="mode">` + modeOptions(query.Mode) + `</select>
+        <input type="text" name="tag" placeholder="Tag" value="` + html.EscapeString(query.Tag) + `">
+        <label><input type="checkbox" name="nodups" value="1"` + checkedAttr(query.SkipDuplicates) + `> Hide duplicates</label>
+        <button type="submit">Filter</button>
+    </form>`
+
+		if len(entries) == 0 {
+			page += `
+    <p class="empty">No captures recorded yet.</p>`
+		}
+
+		page += `
+    <div class="gallery">`
+		for _, e := range entries {
+			page += `
+        <div class="thumbnail">` + archiveThumbnail(e) + archivePin(e) + `
+            <div class="info">` + archiveInfo(e) + `</div>
+        </div>`
+		}
+		page += `
+    </div>
+    <div class="pager">`
+		if offset > 0 {
+			page += `
+        <a href="` + archiveURL(query, max(offset-archivePageSize, 0)) + `">Newer</a>`
+		}
+		if more {
+			page += `
+        <a href="` + archiveURL(query, offset+archivePageSize) + `">Older</a>`
+		}
+		page += `
+    </div>
+    <script>
+        function pinCapture(id, pinned) {
+            fetch('/archive/pin', {
+                method: 'POST',
+                headers: {'Content-Type': 'application/x-www-form-urlencoded'},
+                body: 'id=' + encodeURIComponent(id) + '&pinned=' + pinned
+            })
+            .then(r => r.json())
+            .then(() => window.location.reload())
+            .catch(err => alert('Failed to pin: ' + err));
+        }
+    </script>
+</body>
+</html>`
+
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	})
+
+	mux.HandleFunc("/archive/image", func(w http.ResponseWriter, r *http.Request) {
+		requestMutex.Lock()
+		lastRequest = time.Now()
+		requestMutex.Unlock()
+
+		store := getHistory()
+		if store == nil {
+			http.Error(w, "Capture history is not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		entry, err := store.Get(r.URL.Query().Get("id"))
+		if errors.Is(err, history.ErrNotFound) || (err == nil && entry.Path == "") {
+			http.Error(w, "No such capture", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to read capture history", http.StatusInternalServerError)
+			return
+		}
+
+		// Opened here rather than with ServeFile, which would list a folder.
+		file, err := os.Open(entry.Path)
+		if err != nil {
+			http.Error(w, "The saved file is missing", http.StatusNotFound)
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			http.Error(w, "The saved file is missing", http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, filepath.Base(entry.Path), info.ModTime(), file)
+	})
+
+	mux.HandleFunc("/archive/pin", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		store := getHistory()
+		if store == nil {
+			http.Error(w, "Capture history is not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		id := r.FormValue("id")
+		if id == "" {
+			http.Error(w, "Missing id parameter", http.StatusBadRequest)
+			return
+		}
+		writeJSONResult(w, http.StatusInternalServerError, pinEntry(store, id, r.FormValue("pinned") == "true"))
+	})
+}
+
+// pinShot pins or unpins a session shot and its history entry.
+func pinShot(shot *capture.Shot, pinned bool) error {
+	shot.SetPinned(pinned)
+
+	// A shot not yet in the history is pinned there when it is recorded.
+	store := getHistory()
+	if store == nil {
+		return nil
+	}
+	if _, err := store.SetPinned(shot.ID, pinned); err != nil && !errors.Is(err, history.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// pinEntry pins or unpins a history entry and its session shot, if it is
+// still in the session.
+func pinEntry(store *history.Store, id string, pinned bool) error {
+	if _, err := store.SetPinned(id, pinned); err != nil {
+		return err
+	}
+	if shot := findSessionShot(id); shot != nil {
+		shot.SetPinned(pinned)
+	}
+	return nil
+}
+
+func modeOptions(selected string) string {
+	options := ""
+	modes := []capture.Mode{"", capture.ModeMonitor, capture.ModeRegion, capture.ModeAllDisplays, capture.ModeWindow}
+	for _, mode := range modes {
+		label := string(mode)
+		if label == "" {
+			label = "All modes"
+		}
+		attr := ""
+		if string(mode) == selected {
+			attr = " selected"
+		}
+		options += fmt.Sprintf(`<option value="%s"%s>%s</option>`, mode, attr, label)
+	}
+	return options
+}
+
+func checkedAttr(checked bool) string {
+	if checked {
+		return " checked"
+	}
+	return ""
+}
+
+// archiveThumbnail shows a saved capture if browsers can display its file.
+func archiveThumbnail(e history.Entry) string {
+	if e.Path == "" {
+		return `
+            <div class="missing">Not saved</div>`
+	}
+	switch strings.ToLower(filepath.Ext(e.Path)) {
+	case ".png", ".jpg", ".jpeg":
+		src := "/archive/image?id=" + url.QueryEscape(e.ID)
+		return fmt.Sprintf(`
+            <img src="%s" alt="Capture %s" loading="lazy" onclick="window.open(%s)">`, html.EscapeString(src), html.EscapeString(e.ID), jsAttr(src))
+	}
+	return `
+            <div class="missing">` + html.EscapeString(filepath.Base(e.Path)) + `</div>`
+}
+
+func archivePin(e history.Entry) string {
+	if e.Pinned {
+		return fmt.Sprintf(`
+            <div class="pin-text pinned" title="Kept by retention policies" onclick="pinCapture(%s, false)">Pinned</div>`, jsAttr(e.ID))
+	}
+	return fmt.Sprintf(`
+            <div class="pin-text" onclick="pinCapture(%s, true)">Pin</div>`, jsAttr(e.ID))
+}
+
+func archiveInfo(e history.Entry) string {
+	monitor := "all monitors"
+	if e.Monitor >= 0 {
+		monitor = fmt.Sprintf("monitor %d", e.Monitor+1)
+	}
+	info := fmt.Sprintf("%s<br>%s, %s, %dx%d<br>%s",
+		e.Time.Local().Format("2006-01-02 15:04:05"), html.EscapeString(e.Mode), monitor, e.Width, e.Height, html.EscapeString(e.ID))
+	if e.Duplicate {
+		if e.DuplicateOf != "" {
+			info += `<br><span title="Duplicate of ` + html.EscapeString(e.DuplicateOf) + `">duplicate</span>`
+		} else {
+			info += "<br>duplicate"
+		}
+	}
+	if e.Path != "" {
+		info += `<br><span title="` + html.EscapeString(e.Path) + `">` + html.EscapeString(filepath.Base(e.Path)) + `</span>`
+	}
+	if len(e.Tags) > 0 {
+		info += "<br>"
+		for _, tag := range e.Tags {
+			info += `<span class="tag">` + html.EscapeString(tag) + `</span>`
+		}
+	}
+	return info
+}
+
+func archiveURL(q history.Query, offset int) string {
+	values := url.Values{}
+	if q.Mode != "" {
+		values.Set("mode", q.Mode)
+	}
+	if q.Tag != "" {
+		values.Set("tag", q.Tag)
+	}
+	if q.SkipDuplicates {
+		values.Set("nodups", "1")
+	}
+	if offset > 0 {
+		values.Set("offset", strconv.Itoa(offset))
+	}
+	if len(values) == 0 {
+		return "/archive"
+	}
+	return "/archive?" + html.EscapeString(values.Encode())
+}
@@ -0,0 +1,137 @@
+package preview
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Every request must carry the session token. Browsers get it from the link
+// the tray opens and keep it in a cookie; scripts send it as a bearer token.
+// A request that changes something on the strength of the cookie alone must
+// also come from one of the preview's own pages.
+
+const (
+	tokenParam  = "token"
+	tokenCookie = "snaphook_token"
+)
+
+var sessionToken = newToken()
+
+func newToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Token returns the token for this session. Scripts pass it in an
+// "Authorization: Bearer" header.
+func Token() string {
+	return sessionToken
+}
+
+// browserURL is the address of a preview page with the token attached, for
+// opening in a browser.
+func browserURL(path string) string {
+	serverMutex.RLock()
+	defer serverMutex.RUnlock()
+	return serverURL + path + "?" + tokenParam + "=" + url.QueryEscape(sessionToken)
+}
+
+func requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		viaCookie := false
+		switch {
+		case validToken(bearerToken(r)):
+		case validToken(r.URL.Query().Get(tokenParam)):
+			http.SetCookie(w, &http.Cookie{
+				Name:     tokenCookie,
+				Value:    sessionToken,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+			// Keep the token out of the address bar and browser history.
+			if r.Method == http.MethodGet {
+				u := *r.URL
+				query := u.Query()
+				query.Del(tokenParam)
+				u.RawQuery = query.Encode()
+				http.Redirect(w, r, u.RequestURI(), http.StatusSeeOther)
+				return
+			}
+		case validToken(cookieToken(r)):
+			viaCookie = true
+		default:
+			denyRequest(w, r, http.StatusUnauthorized,
+				errors.New("missing or invalid token; open the preview from the SnapHook tray menu"))
+			return
+		}
+
+		if viaCookie && changesState(r.Method) && !sameOrigin(r) {
+			denyRequest(w, r, http.StatusForbidden, errors.New("cross-origin request refused"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func validToken(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(sessionToken)) == 1
+}
+
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+func cookieToken(r *http.Request) string {
+	c, err := r.Cookie(tokenCookie)
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+func changesState(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// sameOrigin reports whether a request came from a page served by this
+// server, going by its Origin header or, failing that, its Referer.
+func sameOrigin(r *http.Request) bool {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	self := scheme + "://" + r.Host
+
+	if origin := r.Header.Get("Origin"); origin != "" {
+		return strings.EqualFold(origin, self)
+	}
+	referer, err := url.Parse(r.Header.Get("Referer"))
+	if err != nil || referer.Host == "" {
+		return false
+	}
+	return strings.EqualFold(referer.Scheme+"://"+referer.Host, self)
+}
+
+func denyRequest(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		writeAPIError(w, status, err)
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
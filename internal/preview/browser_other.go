@@ -0,0 +1,15 @@
+//go:build !windows
+
+package preview
+
+import (
+	"os/exec"
+	"runtime"
+)
+
+func browserCommand(url string) *exec.Cmd {
+	if runtime.GOOS == "darwin" {
+		return exec.Command("open", url)
+	}
+	return exec.Command("xdg-open", url)
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package preview
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func browserCommand(url string) *exec.Cmd {
+	cmd := exec.Command("cmd", "/c", "start", url)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		HideWindow:    true,
+		CreationFlags: 0x08000000,
+	}
+	return cmd
+}
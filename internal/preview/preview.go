@@ -1,5 +1,7 @@
 package preview
 
-func Show(imagePath string) error {
-	return show(imagePath)
+import "snaphook/internal/capture"
+
+func Show(shot *capture.Shot) error {
+	return show(shot)
 }
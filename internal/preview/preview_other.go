@@ -0,0 +1,9 @@
+//go:build !windows
+
+package preview
+
+import "snaphook/internal/capture"
+
+func show(shot *capture.Shot) error {
+	return ShowInBrowser(shot)
+}
@@ -2,6 +2,8 @@
 
 package preview
 
-func show(imagePath string) error {
-	return ShowInBrowser(imagePath)
+import "snaphook/internal/capture"
+
+func show(shot *capture.Shot) error {
+	return ShowInBrowser(shot)
 }
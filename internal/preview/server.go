@@ -2,42 +2,86 @@ package preview
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"html"
+	"log"
+	"net"
 	"net/http"
-	"os"
-	"os/exec"
-	"runtime"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
-	"syscall"
 	"time"
+
+	"snaphook/internal/capture"
+	"snaphook/internal/history"
+	"snaphook/internal/imageformat"
+	"snaphook/internal/shortcut"
 )
 
 const (
 	maxHistorySize = 50
-	maxClients     = 5
+	// maxHistoryBytes bounds the memory the session history holds, pixels
+	// of the newest shot and encodings of the compacted rest.
+	maxHistoryBytes = 256 << 20
+	maxClients      = 5
+
+	// defaultHost keeps the preview reachable only from this machine.
+	defaultHost = "127.0.0.1"
+	defaultPort = 8765
 )
 
 var (
 	server           *http.Server
-	latestImage      string
-	imageHistory     []string
+	latestImage      *capture.Shot
+	imageHistory     []*capture.Shot
 	imageMutex       sync.RWMutex
 	serverStarted    bool
 	serverMutex      sync.RWMutex
-	serverURL        = "http://localhost:8765"
+	serverURL        string
+	listenHost       = defaultHost
+	listenPort       = defaultPort
+	tlsCertFile      string
+	tlsKeyFile       string
 	lastRequest      time.Time
 	requestMutex     sync.RWMutex
 	clients          []chan string
 	clientsMutex     sync.Mutex
-	hotkeyChangeChan = make(chan string, 10)
+	hotkeyChangeChan = make(chan HotkeyChange, 10)
+	imageFormat      = imageformat.Default
+	formatMutex      sync.RWMutex
+
+	saveDirChangeChan = make(chan SaveDirChange, 10)
+	saveDir           string
+	saveDirErr        error
+	saveDirMutex      sync.RWMutex
 )
 
-func Start() {
+// HotkeyChange is a hotkey submitted on the settings page. The receiver
+// applies it and sends the outcome on Result, which the page then shows.
+type HotkeyChange struct {
+	Hotkey string
+	Result chan error
+}
+
+// SaveDirChange is an auto-save folder submitted on the settings page. It is
+// answered on Result like HotkeyChange; an empty Dir restores the default.
+type SaveDirChange struct {
+	Dir    string
+	Result chan error
+}
+
+// Start serves the preview on the configured address. If the configured
+// port cannot be bound, the server falls back to a free port chosen by the
+// system; an error means it could not listen at all.
+func Start() error {
 	serverMutex.Lock()
+	defer serverMutex.Unlock()
 	if serverStarted {
-		serverMutex.Unlock()
-		return
+		return nil
 	}
 	mux := http.NewServeMux()
 
@@ -46,6 +90,18 @@ func Start() {
 		lastRequest = time.Now()
 		requestMutex.Unlock()
 
+		// The page shows the capture asked for, or else the latest.
+		var shownID string
+		if shot := findSessionShot(r.URL.Query().Get("id")); shot != nil {
+			shownID = shot.ID
+		} else {
+			imageMutex.RLock()
+			if latestImage != nil {
+				shownID = latestImage.ID
+			}
+			imageMutex.RUnlock()
+		}
+
 		html := `<!DOCTYPE html>
 <html>
 <head>
@@ -127,11 +183,37 @@ func Start() {
             display: flex;
             gap: 10px;
         }
+        .warning {
+            position: fixed;
+            top: 20px;
+            left: 20px;
+            max-width: 50%;
+            padding: 12px 20px;
+            background: #f44336;
+            color: #fff;
+            font-family: Arial;
+            font-size: 14px;
+            border-radius: 4px;
+        }
+        .countdown {
+            position: fixed;
+            top: 20px;
+            right: 20px;
+            padding: 12px 20px;
+            background: rgba(0,0,0,0.8);
+            color: #fff;
+            font-family: Arial;
+            font-size: 20px;
+            border-radius: 4px;
+            display: none;
+        }
     </style>
 </head>
 <body>
+    <div class="warning"` + saveDirWarning() + `</div>
+    <div class="countdown"></div>
     <div class="container">
-        <img id="screenshot" src="/image?t=` + fmt.Sprintf("%d", time.Now().UnixNano()) + `" onerror="this.style.display='none';document.querySelector('.waiting').style.display='block';document.querySelector('.save-btn').style.display='none'" style="cursor: default;">
+        <img id="screenshot" src="/image?id=` + url.QueryEscape(shownID) + `" onerror="this.style.display='none';document.querySelector('.waiting').style.display='block';document.querySelector('.save-btn').style.display='none'" style="cursor: default;">
         <div class="button-group">
             <button class="save-btn" onclick="saveImage()">Save Screenshot</button>
             <button class="history-btn" onclick="window.location='/history'">View History</button>
@@ -146,19 +228,47 @@ func Start() {
         const waiting = document.querySelector('.waiting');
         const saveBtn = document.querySelector('.save-btn');
 
+        let shownID = ` + jsString(shownID) + `;
+
+        // Each message carries the ID of the newest capture, or nothing
+        // once none are left.
         const eventSource = new EventSource('/events');
         eventSource.onmessage = function(event) {
-            img.src = '/image?t=' + Date.now();
+            shownID = event.data;
+            if (!shownID) {
+                img.style.display = 'none';
+                waiting.style.display = 'block';
+                saveBtn.style.display = 'none';
+                return;
+            }
+            img.src = '/image?id=' + encodeURIComponent(shownID);
             img.style.display = 'block';
             waiting.style.display = 'none';
             saveBtn.style.display = 'block';
         };
 
+        const warning = document.querySelector('.warning');
+        eventSource.addEventListener('savedir', function(event) {
+            warning.textContent = event.data;
+            warning.style.display = event.data ? 'block' : 'none';
+        });
+
+        const countdown = document.querySelector('.countdown');
+        eventSource.addEventListener('countdown', function(event) {
+            const remaining = parseInt(event.data, 10);
+            if (remaining > 0) {
+                countdown.textContent = 'Capturing in ' + remaining + '...';
+                countdown.style.display = 'block';
+            } else {
+                countdown.style.display = 'none';
+            }
+        });
+
         function saveImage() {
             const timestamp = new Date().toISOString().replace(/[:.]/g, '-').slice(0, 19);
             const link = document.createElement('a');
-            link.href = '/image?t=' + Date.now();
-            link.download = 'screenshot_' + timestamp + '.png';
+            link.href = '/image?id=' + encodeURIComponent(shownID);
+            link.download = 'screenshot_' + timestamp + '` + getImageFormat().Ext() + `';
             link.click();
         }
     </script>
@@ -173,36 +283,30 @@ func Start() {
 		lastRequest = time.Now()
 		requestMutex.Unlock()
 
-		indexStr := r.URL.Query().Get("index")
-
-		imageMutex.RLock()
-		var imgPath string
-		if indexStr != "" {
-			var index int
-			fmt.Sscanf(indexStr, "%d", &index)
-			if index >= 0 && index < len(imageHistory) {
-				imgPath = imageHistory[index]
-			}
+		var shot *capture.Shot
+		if id := r.URL.Query().Get("id"); id != "" {
+			shot = findSessionShot(id)
 		} else {
-			imgPath = latestImage
+			imageMutex.RLock()
+			shot = latestImage
+			imageMutex.RUnlock()
 		}
-		imageMutex.RUnlock()
 
-		if imgPath == "" {
+		if shot == nil {
 			http.Error(w, "No image yet", http.StatusNotFound)
 			return
 		}
 
-		file, err := os.Open(imgPath)
+		format := getImageFormat()
+		data, err := shot.Encode(format)
 		if err != nil {
-			http.Error(w, "Image not found", http.StatusNotFound)
+			http.Error(w, "Failed to encode image", http.StatusInternalServerError)
 			return
 		}
-		defer file.Close()
 
-		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Type", format.ContentType())
 		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-		io.Copy(w, file)
+		w.Write(data)
 	})
 
 	mux.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
@@ -211,7 +315,7 @@ func Start() {
 		requestMutex.Unlock()
 
 		imageMutex.RLock()
-		history := make([]string, len(imageHistory))
+		history := make([]*capture.Shot, len(imageHistory))
 		copy(history, imageHistory)
 		imageMutex.RUnlock()
 
@@ -280,6 +384,27 @@ func Start() {
         .delete-text:hover {
             background: #d32f2f;
         }
+        .pin-text {
+            position: absolute;
+            top: 8px;
+            left: 8px;
+            background: #555;
+            color: white;
+            padding: 6px 12px;
+            border-radius: 4px;
+            font-size: 12px;
+            font-weight: bold;
+            cursor: pointer;
+            opacity: 0;
+            transition: opacity 0.2s;
+            z-index: 10;
+        }
+        .thumbnail:hover .pin-text, .pin-text.pinned {
+            opacity: 1;
+        }
+        .pin-text.pinned {
+            background: #2196F3;
+        }
         .back-btn, .clear-btn {
             padding: 12px 24px;
             color: white;
@@ -311,41 +436,63 @@ func Start() {
     <h1>Screenshot History (` + fmt.Sprintf("%d/%d", len(history), maxHistorySize) + `)</h1>
     <div class="button-group">
         <button class="back-btn" onclick="window.location='/'">Back to Latest</button>
+        <button class="back-btn" onclick="window.location='/archive'">All Captures</button>
         <button class="clear-btn" onclick="clearAll()">Clear All History</button>
     </div>
     <div class="gallery">`
 
 		for i := len(history) - 1; i >= 0; i-- {
+			id := url.QueryEscape(history[i].ID)
+			pinClass, pinLabel := "pin-text", "Pin"
+			if history[i].Pinned() {
+				pinClass, pinLabel = "pin-text pinned", "Pinned"
+			}
 			html += fmt.Sprintf(`
         <div class="thumbnail">
-            <img src="/image?index=%d" alt="Screenshot %d" onclick="window.location='/?index=%d'">
-            <div class="delete-text" onclick="deleteScreenshot(%d, event)">Delete</div>
+            <img src="/image?id=%s" alt="Screenshot %d" onclick="window.location=%s">
+            <div class="%s" onclick="pinScreenshot(%s, %t, event)">%s</div>
+            <div class="delete-text" onclick="deleteScreenshot(%s, event)">Delete</div>
             <div class="info">Screenshot #%d</div>
-        </div>`, i, i+1, i, i, i+1)
+        </div>`, id, i+1, jsAttr("/?id="+id), pinClass, jsAttr(history[i].ID), !history[i].Pinned(), pinLabel, jsAttr(history[i].ID), i+1)
 		}
 
 		html += `
     </div>
     <script>
-        function deleteScreenshot(index, event) {
+        function deleteScreenshot(id, event) {
             event.stopPropagation();
             fetch('/delete', {
                 method: 'POST',
                 headers: {'Content-Type': 'application/x-www-form-urlencoded'},
-                body: 'index=' + index
+                body: 'id=' + encodeURIComponent(id)
             })
             .then(r => r.json())
             .then(() => window.location.reload())
             .catch(err => alert('Failed to delete: ' + err));
         }
 
+        function pinScreenshot(id, pinned, event) {
+            event.stopPropagation();
+            fetch('/pin', {
+                method: 'POST',
+                headers: {'Content-Type': 'application/x-www-form-urlencoded'},
+                body: 'id=' + encodeURIComponent(id) + '&pinned=' + pinned
+            })
+            .then(r => r.json())
+            .then(() => window.location.reload())
+            .catch(err => alert('Failed to pin: ' + err));
+        }
+
         function clearAll() {
             if (confirm('Clear all screenshot history? This cannot be undone.')) {
                 fetch('/clear-all', {
                     method: 'POST'
                 })
                 .then(r => r.json())
-                .then(() => window.location.reload())
+                .then(data => {
+                    if (!data.success) alert('Failed to clear history: ' + data.error);
+                    window.location.reload();
+                })
                 .catch(err => alert('Failed to clear history: ' + err));
             }
         }
@@ -364,13 +511,23 @@ func Start() {
 		if r.Method == "POST" {
 			newHotkey := r.FormValue("hotkey")
 			if newHotkey != "" {
-				hotkeyChangeChan <- newHotkey
-				w.Header().Set("Content-Type", "application/json")
-				w.Write([]byte(`{"success": true}`))
+				writeJSONResult(w, http.StatusBadRequest, applyHotkeyChange(newHotkey))
+				return
+			}
+			// An empty save_dir is meaningful: it restores the default.
+			if dirs, ok := r.PostForm["save_dir"]; ok {
+				writeJSONResult(w, http.StatusBadRequest, applySaveDirChange(dirs[0]))
 				return
 			}
 		}
 
+		saveDir, saveDirErr := getSaveDirStatus()
+		saveDirStatus := `<div id="saveDirStatus" class="status"></div>`
+		if saveDirErr != nil {
+			saveDirStatus = `<div id="saveDirStatus" class="status error" style="display:block">` +
+				html.EscapeString(saveDirErr.Error()) + `</div>`
+		}
+
 		html := `<!DOCTYPE html>
 <html>
 <head>
@@ -466,10 +623,19 @@ func Start() {
             <h2>Hotkey Configuration</h2>
             <label>Press your desired hotkey combination:</label>
             <input type="text" id="hotkeyInput" readonly placeholder="Click here and press keys..." value="">
-            <div class="hint">Examples: Ctrl+Shift+S, Ctrl+Alt+S, PrintScreen</div>
+            <div class="hint">Examples: Ctrl+Shift+S, Ctrl+Alt+F7, Win+Shift+Up, PrintScreen</div>
             <button class="btn" onclick="saveHotkey()">Save Hotkey</button>
             <div id="status" class="status"></div>
         </div>
+
+        <div class="section">
+            <h2>Auto-Save Folder</h2>
+            <label>Save screenshots to:</label>
+            <input type="text" id="saveDirInput" value="` + html.EscapeString(saveDir) + `">
+            <div class="hint">~ and environment variables such as $HOME are expanded. Leave empty for Pictures/SnapHook.</div>
+            <button class="btn" onclick="saveDir()">Save Folder</button>
+            ` + saveDirStatus + `
+        </div>
     </div>
 
     <script>
@@ -483,18 +649,19 @@ func Start() {
             if (e.ctrlKey) keys.push('Ctrl');
             if (e.altKey) keys.push('Alt');
             if (e.shiftKey) keys.push('Shift');
+            if (e.metaKey) keys.push('Win');
 
             const key = e.key;
-            if (key === 'Control' || key === 'Alt' || key === 'Shift') {
+            if (key === 'Control' || key === 'Alt' || key === 'Shift' || key === 'Meta' || key === 'OS') {
                 return;
             }
 
-            if (key === 'PrintScreen') {
-                input.value = 'PrintScreen';
-            } else {
-                keys.push(key.toUpperCase());
-                input.value = keys.join('+');
-            }
+            // e.code names the physical key, so Shift+1 stays "1" rather than "!".
+            let name = e.code || key;
+            if (name.startsWith('Key')) name = name.slice(3);
+            else if (name.startsWith('Digit')) name = name.slice(5);
+            keys.push(name);
+            input.value = keys.join('+');
         });
 
         function saveHotkey() {
@@ -515,16 +682,37 @@ func Start() {
                     showStatus('Hotkey changed successfully!', true);
                     setTimeout(() => window.close(), 2000);
                 } else {
-                    showStatus('Failed to change hotkey', false);
+                    showStatus('Failed to change hotkey: ' + (data.error || 'unknown error'), false);
                 }
             })
             .catch(() => showStatus('Error saving hotkey', false));
         }
 
-        function showStatus(message, success) {
-            status.textContent = message;
-            status.className = 'status ' + (success ? 'success' : 'error');
-            status.style.display = 'block';
+        const saveDirInput = document.getElementById('saveDirInput');
+        const saveDirStatus = document.getElementById('saveDirStatus');
+
+        function saveDir() {
+            fetch('/settings', {
+                method: 'POST',
+                headers: {'Content-Type': 'application/x-www-form-urlencoded'},
+                body: 'save_dir=' + encodeURIComponent(saveDirInput.value)
+            })
+            .then(r => r.json())
+            .then(data => {
+                if (data.success) {
+                    showStatus('Auto-save folder changed', true, saveDirStatus);
+                } else {
+                    showStatus('Cannot use this folder: ' + (data.error || 'unknown error'), false, saveDirStatus);
+                }
+            })
+            .catch(() => showStatus('Error saving folder', false, saveDirStatus));
+        }
+
+        function showStatus(message, success, el) {
+            el = el || status;
+            el.textContent = message;
+            el.className = 'status ' + (success ? 'success' : 'error');
+            el.style.display = 'block';
         }
     </script>
 </body>
@@ -539,25 +727,37 @@ func Start() {
 			return
 		}
 
-		indexStr := r.FormValue("index")
-		if indexStr == "" {
-			http.Error(w, "Missing index parameter", http.StatusBadRequest)
+		id := r.FormValue("id")
+		if id == "" {
+			http.Error(w, "Missing id parameter", http.StatusBadRequest)
+			return
+		}
+		if !removeSessionShot(id) {
+			writeJSONResult(w, http.StatusInternalServerError, fmt.Errorf("%w %s", errNoShot, id))
 			return
 		}
+		writeJSONResult(w, http.StatusInternalServerError, nil)
+	})
 
-		var index int
-		fmt.Sscanf(indexStr, "%d", &index)
+	mux.HandleFunc("/pin", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
 
-		imageMutex.Lock()
-		if index >= 0 && index < len(imageHistory) {
-			imagePath := imageHistory[index]
-			os.Remove(imagePath)
-			imageHistory = append(imageHistory[:index], imageHistory[index+1:]...)
+		id := r.FormValue("id")
+		if id == "" {
+			http.Error(w, "Missing id parameter", http.StatusBadRequest)
+			return
 		}
-		imageMutex.Unlock()
+		pinned := r.FormValue("pinned") == "true"
 
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"success": true}`))
+		shot := findSessionShot(id)
+		if shot == nil {
+			writeJSONResult(w, http.StatusInternalServerError, fmt.Errorf("%w %s", errNoShot, id))
+			return
+		}
+		writeJSONResult(w, http.StatusInternalServerError, pinShot(shot, pinned))
 	})
 
 	mux.HandleFunc("/clear-all", func(w http.ResponseWriter, r *http.Request) {
@@ -566,16 +766,20 @@ func Start() {
 			return
 		}
 
+		var errs []error
 		imageMutex.Lock()
-		for _, imagePath := range imageHistory {
-			os.Remove(imagePath)
+		for _, shot := range imageHistory {
+			if err := shot.Release(); err != nil {
+				errs = append(errs, err)
+			}
 		}
-		imageHistory = []string{}
-		latestImage = ""
+		imageHistory = []*capture.Shot{}
+		latestImage = nil
 		imageMutex.Unlock()
 
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"success": true}`))
+		notifyClients("")
+
+		writeJSONResult(w, http.StatusInternalServerError, errors.Join(errs...))
 	})
 
 	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
@@ -626,34 +830,79 @@ func Start() {
 				if !ok {
 					return
 				}
-				fmt.Fprintf(w, "data: %s\n\n", msg)
+				fmt.Fprint(w, msg)
 				flusher.Flush()
 			}
 		}
 	})
 
-	server = &http.Server{
-		Addr:    ":8765",
-		Handler: mux,
+	registerArchive(mux)
+	registerAPI(mux)
+
+	var tlsConfig *tls.Config
+	if tlsCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(tlsCertFile, tlsKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load preview certificate: %w", err)
+		}
+		tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	addr := net.JoinHostPort(listenHost, strconv.Itoa(listenPort))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fallback, fallbackErr := net.Listen("tcp", net.JoinHostPort(listenHost, "0"))
+		if fallbackErr != nil {
+			return fmt.Errorf("preview server cannot listen on %s: %w", addr, err)
+		}
+		log.Printf("Preview port %d unavailable (%v), using %s instead", listenPort, err, fallback.Addr())
+		ln = fallback
+	}
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
 	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	serverURL = scheme + "://" + net.JoinHostPort(urlHost(listenHost), strconv.Itoa(port))
+	srv := &http.Server{Handler: requireToken(mux), TLSConfig: tlsConfig}
+	server = srv
 
 	go func() {
-		server.ListenAndServe()
+		var err error
+		if tlsConfig != nil {
+			// ServeTLS offers HTTP/2 alongside HTTP/1.1.
+			err = srv.ServeTLS(ln, "", "")
+		} else {
+			err = srv.Serve(ln)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Preview server stopped: %v", err)
+		}
 	}()
 
 	serverStarted = true
-	serverMutex.Unlock()
+	return nil
+}
+
+// URL returns the address the preview is served on, which follows the port
+// actually bound.
+func URL() string {
+	serverMutex.RLock()
+	defer serverMutex.RUnlock()
+	return serverURL
 }
 
-func ShowInBrowser(imagePath string) error {
+func ShowInBrowser(shot *capture.Shot) error {
 	imageMutex.Lock()
-	latestImage = imagePath
-	imageHistory = append(imageHistory, imagePath)
+	latestImage = shot
+	imageHistory = append(imageHistory, shot)
 
-	if len(imageHistory) > maxHistorySize {
-		oldPath := imageHistory[0]
-		os.Remove(oldPath)
-		imageHistory = imageHistory[1:]
+	for len(imageHistory) > 1 && (len(imageHistory) > maxHistorySize || sessionBytesLocked() > maxHistoryBytes) {
+		dropOldestLocked()
 	}
 	imageMutex.Unlock()
 
@@ -665,25 +914,123 @@ func ShowInBrowser(imagePath string) error {
 		return fmt.Errorf("preview server not started")
 	}
 
-	notifyClients("update")
+	notifyClients(shot.ID)
 
 	go tryOpenBrowser()
 
 	return nil
 }
 
+// Compact shrinks a shot the preview holds to the encoding /image serves.
+// The capture pipeline calls it once the other sinks are done with the
+// pixels.
+func Compact(shot *capture.Shot) error {
+	return shot.Compact(getImageFormat())
+}
+
+func sessionBytesLocked() int {
+	n := 0
+	for _, shot := range imageHistory {
+		n += shot.Size()
+	}
+	return n
+}
+
+// dropOldestLocked removes the oldest unpinned shot from the session, or the
+// oldest pinned one when every shot is pinned, so pins cannot grow the
+// session without bound. A dropped pinned shot stays pinned in the capture
+// history, which keeps its saved file; only the in-memory copy goes. Temp
+// files are left to the retention policy.
+func dropOldestLocked() {
+	i := 0
+	for j, shot := range imageHistory {
+		if !shot.Pinned() {
+			i = j
+			break
+		}
+	}
+	if imageHistory[i].Pinned() {
+		imageHistory[i].SetPinned(false)
+	}
+	imageHistory = append(imageHistory[:i], imageHistory[i+1:]...)
+}
+
+// findSessionShot returns the shot of this session with the given ID, if it
+// is still held in memory.
+func findSessionShot(id string) *capture.Shot {
+	imageMutex.RLock()
+	defer imageMutex.RUnlock()
+	for _, shot := range imageHistory {
+		if shot.ID == id {
+			return shot
+		}
+	}
+	return nil
+}
+
+// removeSessionShot releases and forgets the shot with the given ID. If it
+// was the latest, the one before takes its place, and open pages are told.
+func removeSessionShot(id string) bool {
+	imageMutex.Lock()
+	var removed *capture.Shot
+	for i, shot := range imageHistory {
+		if shot.ID == id {
+			removed = shot
+			imageHistory = append(imageHistory[:i], imageHistory[i+1:]...)
+			break
+		}
+	}
+	if removed == nil {
+		imageMutex.Unlock()
+		return false
+	}
+	removed.Release()
+
+	latestChanged := latestImage == removed
+	latestID := ""
+	if latestChanged {
+		latestImage = nil
+		if n := len(imageHistory); n > 0 {
+			latestImage = imageHistory[n-1]
+			latestID = latestImage.ID
+		}
+	}
+	imageMutex.Unlock()
+
+	if latestChanged {
+		notifyClients(latestID)
+	}
+	return true
+}
+
 func notifyClients(msg string) {
+	broadcast(fmt.Sprintf("data: %s\n\n", msg))
+}
+
+// notifyEvent sends a named SSE event, which pages pick up with
+// addEventListener rather than onmessage.
+func notifyEvent(event, data string) {
+	broadcast(fmt.Sprintf("event: %s\ndata: %s\n\n", event, data))
+}
+
+func broadcast(frame string) {
 	clientsMutex.Lock()
 	defer clientsMutex.Unlock()
 
 	for _, clientChan := range clients {
 		select {
-		case clientChan <- msg:
+		case clientChan <- frame:
 		default:
 		}
 	}
 }
 
+// NotifyCountdown tells open preview pages how many seconds remain before a
+// delayed capture fires. Zero means the countdown ended or was cancelled.
+func NotifyCountdown(remaining int) {
+	notifyEvent("countdown", strconv.Itoa(remaining))
+}
+
 // OpenBrowser opens the preview in the browser
 func OpenBrowser() {
 	// Always open when user explicitly clicks the menu button
@@ -718,20 +1065,7 @@ func tryOpenBrowser() {
 
 func openBrowserWindow() {
 	go func() {
-		var cmd *exec.Cmd
-		switch runtime.GOOS {
-		case "windows":
-			cmd = exec.Command("cmd", "/c", "start", serverURL)
-			cmd.SysProcAttr = &syscall.SysProcAttr{
-				HideWindow:    true,
-				CreationFlags: 0x08000000,
-			}
-		case "darwin":
-			cmd = exec.Command("open", serverURL)
-		default:
-			cmd = exec.Command("xdg-open", serverURL)
-		}
-
+		cmd := browserCommand(browserURL("/"))
 		if err := cmd.Start(); err != nil {
 			fmt.Printf("Failed to open browser: %v\n", err)
 			return
@@ -770,28 +1104,71 @@ func Shutdown() {
 	browserMutex.Unlock()
 
 	imageMutex.Lock()
-	latestImage = ""
+	latestImage = nil
 	imageHistory = nil
 	imageMutex.Unlock()
 }
 
+// SetAddress sets the host or IP address and the port the server listens on
+// from its next Start. An empty host means 127.0.0.1; "0.0.0.0" listens on
+// every interface, which lets other machines reach the preview with the
+// session token. Port 0 means 8765.
+func SetAddress(host string, port int) error {
+	if port < 0 || port > 65535 {
+		return fmt.Errorf("port %d is out of range", port)
+	}
+	serverMutex.Lock()
+	defer serverMutex.Unlock()
+	if host == "" {
+		host = defaultHost
+	}
+	if port == 0 {
+		port = defaultPort
+	}
+	listenHost = host
+	listenPort = port
+	return nil
+}
+
+// SetTLS serves the preview over HTTPS with the given certificate and key
+// files from its next Start. Empty paths mean plain HTTP.
+func SetTLS(certFile, keyFile string) {
+	serverMutex.Lock()
+	defer serverMutex.Unlock()
+	tlsCertFile = certFile
+	tlsKeyFile = keyFile
+}
+
+// urlHost is the host to browse to for a server listening on host. Browsers
+// on this machine reach a wildcard address through loopback.
+func urlHost(host string) string {
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		return defaultHost
+	}
+	return host
+}
+
+// SetImageFormat sets the encoding /image serves. Browsers must be able to
+// display it; formats that are not BrowserSafe are rejected.
+func SetImageFormat(f imageformat.Format) error {
+	if !f.BrowserSafe() {
+		return fmt.Errorf("browsers cannot display %s", f)
+	}
+	formatMutex.Lock()
+	defer formatMutex.Unlock()
+	imageFormat = f
+	return nil
+}
+
+func getImageFormat() imageformat.Format {
+	formatMutex.RLock()
+	defer formatMutex.RUnlock()
+	return imageFormat
+}
+
 func OpenSettings() {
-	go openBrowserWindow()
 	go func() {
-		time.Sleep(100 * time.Millisecond)
-		var cmd *exec.Cmd
-		switch runtime.GOOS {
-		case "windows":
-			cmd = exec.Command("cmd", "/c", "start", serverURL+"/settings")
-			cmd.SysProcAttr = &syscall.SysProcAttr{
-				HideWindow:    true,
-				CreationFlags: 0x08000000,
-			}
-		case "darwin":
-			cmd = exec.Command("open", serverURL+"/settings")
-		default:
-			cmd = exec.Command("xdg-open", serverURL+"/settings")
-		}
+		cmd := browserCommand(browserURL("/settings"))
 		if err := cmd.Start(); err != nil {
 			fmt.Printf("Failed to open settings: %v\n", err)
 			return
@@ -800,7 +1177,112 @@ func OpenSettings() {
 	}()
 }
 
-func GetHotkeyChangeChan() chan string {
+func GetHotkeyChangeChan() <-chan HotkeyChange {
 	return hotkeyChangeChan
 }
 
+// applyHotkeyChange validates hotkey and hands it to whoever reads
+// GetHotkeyChangeChan, waiting for the real outcome.
+func applyHotkeyChange(hotkey string) error {
+	normalized, err := shortcut.Normalize(hotkey)
+	if err != nil {
+		return err
+	}
+
+	change := HotkeyChange{Hotkey: normalized, Result: make(chan error, 1)}
+	select {
+	case hotkeyChangeChan <- change:
+	default:
+		return fmt.Errorf("hotkey changes are not being processed")
+	}
+
+	select {
+	case err := <-change.Result:
+		return err
+	case <-time.After(10 * time.Second):
+		return fmt.Errorf("timed out waiting for the hotkey to be applied")
+	}
+}
+
+func GetSaveDirChangeChan() <-chan SaveDirChange {
+	return saveDirChangeChan
+}
+
+// applySaveDirChange hands dir to whoever reads GetSaveDirChangeChan and
+// waits for the outcome.
+func applySaveDirChange(dir string) error {
+	change := SaveDirChange{Dir: dir, Result: make(chan error, 1)}
+	select {
+	case saveDirChangeChan <- change:
+	default:
+		return fmt.Errorf("folder changes are not being processed")
+	}
+
+	select {
+	case err := <-change.Result:
+		return err
+	case <-time.After(10 * time.Second):
+		return fmt.Errorf("timed out waiting for the folder to be applied")
+	}
+}
+
+// SetSaveDirStatus records the auto-save folder and whether it is usable.
+// A non-nil err is shown as a warning on preview pages until cleared.
+func SetSaveDirStatus(dir string, err error) {
+	saveDirMutex.Lock()
+	saveDir = dir
+	saveDirErr = err
+	saveDirMutex.Unlock()
+
+	msg := ""
+	if err != nil {
+		msg = strings.ReplaceAll(err.Error(), "\n", " ")
+	}
+	notifyEvent("savedir", msg)
+}
+
+func getSaveDirStatus() (string, error) {
+	saveDirMutex.RLock()
+	defer saveDirMutex.RUnlock()
+	return saveDir, saveDirErr
+}
+
+// saveDirWarning renders the end of the warning banner's opening tag and
+// its text, hiding the banner while the folder is fine.
+func saveDirWarning() string {
+	_, err := getSaveDirStatus()
+	if err == nil {
+		return ` style="display:none">`
+	}
+	return `>` + html.EscapeString(err.Error())
+}
+
+// jsString quotes s as a JavaScript string inside a <script> block. JSON
+// escapes <, > and &, so s cannot close the block.
+func jsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// jsAttr quotes s as a JavaScript string inside an HTML attribute.
+func jsAttr(s string) string {
+	return html.EscapeString(jsString(s))
+}
+
+// errNoShot reports a screenshot ID that is not in the session.
+var errNoShot = errors.New("no screenshot")
+
+// writeJSONResult reports the outcome of a page action. A screenshot that
+// is not found fails with 404 and any other error with status.
+func writeJSONResult(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		if errors.Is(err, errNoShot) || errors.Is(err, history.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]any{"success": false, "error": err.Error()})
+		return
+	}
+	w.Write([]byte(`{"success": true}`))
+}
@@ -0,0 +1,98 @@
+package preview
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"snaphook/internal/capture"
+	"snaphook/internal/history"
+)
+
+func TestSessionHistoryCapsPinnedShots(t *testing.T) {
+	t.Cleanup(func() {
+		for _, shot := range imageHistory {
+			shot.SetPinned(false)
+		}
+		imageHistory, latestImage = nil, nil
+	})
+
+	var shots []*capture.Shot
+	for i := range maxHistorySize + 3 {
+		shot := &capture.Shot{ID: fmt.Sprintf("shot%02d", i)}
+		// Every shot but the third is pinned.
+		shot.SetPinned(i != 2)
+		shots = append(shots, shot)
+		ShowInBrowser(shot)
+	}
+
+	if len(imageHistory) != maxHistorySize {
+		t.Fatalf("session holds %d shots, want %d", len(imageHistory), maxHistorySize)
+	}
+	// The unpinned shot goes first, then the oldest pinned ones.
+	for _, dropped := range []int{0, 1, 2} {
+		if findSessionShot(shots[dropped].ID) != nil {
+			t.Errorf("%s is still in the session", shots[dropped].ID)
+		}
+	}
+	if shots[0].Pinned() || shots[1].Pinned() {
+		t.Error("a pinned shot dropped from the session is still pinned in memory")
+	}
+	if imageHistory[0] != shots[3] || latestImage != shots[len(shots)-1] {
+		t.Errorf("session runs from %s to %s", imageHistory[0].ID, latestImage.ID)
+	}
+}
+
+func TestJSString(t *testing.T) {
+	tests := []struct {
+		in, want, attr string
+	}{
+		{"20261017-120000-ab12", `"20261017-120000-ab12"`, `&#34;20261017-120000-ab12&#34;`},
+		{`it's "quoted"`, `"it's \"quoted\""`, `&#34;it&#39;s \&#34;quoted\&#34;&#34;`},
+		{"</script><script>alert(1)</script>", `"\u003c/script\u003e\u003cscript\u003ealert(1)\u003c/script\u003e"`,
+			`&#34;\u003c/script\u003e\u003cscript\u003ealert(1)\u003c/script\u003e&#34;`},
+		{"a&b", `"a\u0026b"`, `&#34;a\u0026b&#34;`},
+	}
+	for _, tt := range tests {
+		if got := jsString(tt.in); got != tt.want {
+			t.Errorf("jsString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+		if got := jsAttr(tt.in); got != tt.attr {
+			t.Errorf("jsAttr(%q) = %s, want %s", tt.in, got, tt.attr)
+		}
+	}
+}
+
+func TestWriteJSONResult(t *testing.T) {
+	tests := []struct {
+		status int
+		err    error
+		want   int
+	}{
+		{http.StatusBadRequest, nil, http.StatusOK},
+		{http.StatusBadRequest, errors.New("bad hotkey"), http.StatusBadRequest},
+		{http.StatusInternalServerError, errors.New("disk full"), http.StatusInternalServerError},
+		{http.StatusInternalServerError, fmt.Errorf("%w %s", errNoShot, "x"), http.StatusNotFound},
+		{http.StatusInternalServerError, history.ErrNotFound, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		writeJSONResult(rec, tt.status, tt.err)
+		if rec.Code != tt.want {
+			t.Errorf("writeJSONResult(%d, %v) status = %d, want %d", tt.status, tt.err, rec.Code, tt.want)
+		}
+		var result struct {
+			Success bool   `json:"success"`
+			Error   string `json:"error"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatalf("body %q: %v", rec.Body, err)
+		}
+		if result.Success != (tt.err == nil) || tt.err != nil && result.Error != tt.err.Error() {
+			t.Errorf("writeJSONResult(%d, %v) body = %s", tt.status, tt.err, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Package retention decides which stored screenshots a policy lets go.
+package retention
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy limits what is kept. Zero fields impose no limit.
+type Policy struct {
+	MaxAge   time.Duration
+	MaxCount int
+	MaxBytes int64
+}
+
+// IsZero reports whether p keeps everything.
+func (p Policy) IsZero() bool {
+	return p == Policy{}
+}
+
+func (p Policy) String() string {
+	var limits []string
+	if p.MaxAge > 0 {
+		limits = append(limits, "max age "+p.MaxAge.String())
+	}
+	if p.MaxCount > 0 {
+		limits = append(limits, fmt.Sprintf("max %d files", p.MaxCount))
+	}
+	if p.MaxBytes > 0 {
+		limits = append(limits, fmt.Sprintf("max %d bytes", p.MaxBytes))
+	}
+	if len(limits) == 0 {
+		return "keep everything"
+	}
+	return strings.Join(limits, ", ")
+}
+
+// Item is one stored screenshot.
+type Item struct {
+	Path   string
+	Time   time.Time
+	Size   int64
+	Pinned bool
+	// ID is the caller's handle for the item, if it has one.
+	ID string
+}
+
+// Select returns the items p removes at now: everything older than MaxAge,
+// then the oldest of the rest until at most MaxCount remain and they total at
+// most MaxBytes. Pinned items are always kept and do not count toward the
+// limits.
+func (p Policy) Select(items []Item, now time.Time) []Item {
+	var candidates []Item
+	for _, item := range items {
+		if !item.Pinned {
+			candidates = append(candidates, item)
+		}
+	}
+	// Newest first, so the ones kept are a prefix.
+	slices.SortStableFunc(candidates, func(a, b Item) int {
+		return b.Time.Compare(a.Time)
+	})
+
+	var removed []Item
+	var total int64
+	kept := 0
+	full := false
+	for _, item := range candidates {
+		// Once one item does not fit, older ones go too, even if smaller.
+		full = full ||
+			p.MaxCount > 0 && kept >= p.MaxCount ||
+			p.MaxBytes > 0 && total+item.Size > p.MaxBytes
+		if full || p.MaxAge > 0 && now.Sub(item.Time) > p.MaxAge {
+			removed = append(removed, item)
+			continue
+		}
+		kept++
+		total += item.Size
+	}
+	return removed
+}
+
+// ParseAge parses a Go duration such as "36h", also accepting whole days
+// ("30d") and weeks ("2w"). An empty string means no limit.
+func ParseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
+
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"TB", 1 << 40},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// ParseSize parses a byte count such as "500MB" or "2G". Units are binary;
+// a bare number is bytes. An empty string means no limit.
+func ParseSize(s string) (int64, error) {
+	number := strings.ToUpper(strings.TrimSpace(s))
+	if number == "" {
+		return 0, nil
+	}
+
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if n, ok := strings.CutSuffix(number, u.suffix); ok {
+			number, unit = strings.TrimSpace(n), u.bytes
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(unit)), nil
+}
@@ -0,0 +1,142 @@
+package shortcut
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Key is the canonical name of a non-modifier key. Letters are "A"-"Z",
+// digits "0"-"9" and function keys "F1"-"F24"; the rest are the constants
+// below.
+type Key string
+
+const (
+	Space       Key = "Space"
+	Enter       Key = "Enter"
+	Tab         Key = "Tab"
+	Escape      Key = "Escape"
+	Backspace   Key = "Backspace"
+	Insert      Key = "Insert"
+	Delete      Key = "Delete"
+	Home        Key = "Home"
+	End         Key = "End"
+	PageUp      Key = "PageUp"
+	PageDown    Key = "PageDown"
+	Up          Key = "Up"
+	Down        Key = "Down"
+	Left        Key = "Left"
+	Right       Key = "Right"
+	PrintScreen Key = "PrintScreen"
+	Pause       Key = "Pause"
+	ScrollLock  Key = "ScrollLock"
+
+	Minus        Key = "Minus"
+	Equals       Key = "Equals" // the =/+ key, also spelled "Plus"
+	Comma        Key = "Comma"
+	Period       Key = "Period"
+	Slash        Key = "Slash"
+	Backslash    Key = "Backslash"
+	Semicolon    Key = "Semicolon"
+	Quote        Key = "Quote"
+	BracketLeft  Key = "BracketLeft"
+	BracketRight Key = "BracketRight"
+	Backquote    Key = "Backquote"
+)
+
+type keyInfo struct {
+	// standalone keys may be bound without Ctrl, Alt or Win because they do
+	// not produce text.
+	standalone bool
+}
+
+var (
+	keyInfos   = map[Key]keyInfo{}
+	keyAliases = map[string]Key{}
+)
+
+func addKey(k Key, standalone bool, aliases ...string) {
+	keyInfos[k] = keyInfo{standalone: standalone}
+	keyAliases[strings.ToLower(string(k))] = k
+	for _, alias := range aliases {
+		keyAliases[strings.ToLower(alias)] = k
+	}
+}
+
+func init() {
+	for c := 'A'; c <= 'Z'; c++ {
+		addKey(Key(string(c)), false)
+	}
+	for c := '0'; c <= '9'; c++ {
+		addKey(Key(string(c)), false)
+	}
+	for n := 1; n <= 24; n++ {
+		addKey(Key(fmt.Sprintf("F%d", n)), true)
+	}
+
+	addKey(Space, false, "Spacebar")
+	addKey(Enter, false, "Return")
+	addKey(Tab, false)
+	addKey(Escape, false, "Esc")
+	addKey(Backspace, false, "Back")
+	addKey(Insert, false, "Ins")
+	addKey(Delete, false, "Del")
+	addKey(Home, false)
+	addKey(End, false)
+	addKey(PageUp, false, "PgUp", "Prior")
+	addKey(PageDown, false, "PgDn", "Next")
+	addKey(Up, false, "ArrowUp")
+	addKey(Down, false, "ArrowDown")
+	addKey(Left, false, "ArrowLeft")
+	addKey(Right, false, "ArrowRight")
+	addKey(PrintScreen, true, "PrtSc", "PrtScn", "PrintScrn", "Print", "Snapshot")
+	addKey(Pause, true, "Break")
+	addKey(ScrollLock, true, "Scroll")
+
+	addKey(Minus, false, "-", "Hyphen")
+	// Plus is Shift+Equals on most layouts and the same key to every
+	// backend, so both names parse to one key and cannot be bound twice.
+	addKey(Equals, false, "=", "Equal", "Plus")
+	addKey(Comma, false, ",")
+	addKey(Period, false, ".", "Dot")
+	addKey(Slash, false, "/")
+	addKey(Backslash, false, "\\")
+	addKey(Semicolon, false, ";")
+	addKey(Quote, false, "'", "Apostrophe")
+	addKey(BracketLeft, false, "[", "LeftBracket")
+	addKey(BracketRight, false, "]", "RightBracket")
+	addKey(Backquote, false, "`", "Grave", "Tilde")
+}
+
+func lookupKey(name string) (Key, bool) {
+	k, ok := keyAliases[strings.ToLower(name)]
+	return k, ok
+}
+
+// Letter returns the upper-case letter for "A"-"Z".
+func (k Key) Letter() (byte, bool) {
+	if len(k) == 1 && k[0] >= 'A' && k[0] <= 'Z' {
+		return k[0], true
+	}
+	return 0, false
+}
+
+// Digit returns the ASCII digit for "0"-"9".
+func (k Key) Digit() (byte, bool) {
+	if len(k) == 1 && k[0] >= '0' && k[0] <= '9' {
+		return k[0], true
+	}
+	return 0, false
+}
+
+// Function returns n for function key "Fn".
+func (k Key) Function() (int, bool) {
+	if len(k) < 2 || k[0] != 'F' {
+		return 0, false
+	}
+	n, err := strconv.Atoi(string(k[1:]))
+	if err != nil || n < 1 || n > 24 {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,125 @@
+// Package shortcut parses and normalizes global hotkey strings such as
+// "Ctrl+Shift+F7". It knows nothing about any platform; each hotkey backend
+// maps Combo values to its own native codes.
+package shortcut
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Modifier uint8
+
+const (
+	Ctrl Modifier = 1 << iota
+	Alt
+	Shift
+	Win
+)
+
+// modifierOrder is the order modifiers appear in normalized strings.
+var modifierOrder = []struct {
+	mod  Modifier
+	name string
+}{
+	{Ctrl, "Ctrl"},
+	{Alt, "Alt"},
+	{Shift, "Shift"},
+	{Win, "Win"},
+}
+
+var modifierNames = map[string]Modifier{
+	"ctrl":    Ctrl,
+	"control": Ctrl,
+	"ctl":     Ctrl,
+	"alt":     Alt,
+	"option":  Alt,
+	"shift":   Shift,
+	"win":     Win,
+	"windows": Win,
+	"super":   Win,
+	"meta":    Win,
+	"cmd":     Win,
+}
+
+func (m Modifier) String() string {
+	var parts []string
+	for _, o := range modifierOrder {
+		if m&o.mod != 0 {
+			parts = append(parts, o.name)
+		}
+	}
+	return strings.Join(parts, "+")
+}
+
+// Combo is a parsed hotkey: a set of modifiers plus exactly one key.
+type Combo struct {
+	Modifiers Modifier
+	Key       Key
+}
+
+// String returns the normalized form, e.g. "Ctrl+Shift+F7". Parse(c.String())
+// always yields c.
+func (c Combo) String() string {
+	if c.Modifiers == 0 {
+		return string(c.Key)
+	}
+	return c.Modifiers.String() + "+" + string(c.Key)
+}
+
+// Parse reads a hotkey made of modifiers and one key joined by "+". Names are
+// case-insensitive and common aliases are accepted ("Control", "Super",
+// "Esc", "PgUp", "ArrowLeft", "-"). Aliases of one key normalize to the same
+// Combo, so "Ctrl+Plus" and "Ctrl+=" are both "Ctrl+Equals". A plus key is
+// written "Plus".
+func Parse(s string) (Combo, error) {
+	if strings.TrimSpace(s) == "" {
+		return Combo{}, fmt.Errorf("hotkey is empty")
+	}
+
+	var c Combo
+	for _, part := range strings.Split(s, "+") {
+		name := strings.TrimSpace(part)
+		if name == "" {
+			return Combo{}, fmt.Errorf("hotkey %q has an empty part; write a plus key as \"Plus\"", s)
+		}
+
+		if mod, ok := modifierNames[strings.ToLower(name)]; ok {
+			if c.Modifiers&mod != 0 {
+				return Combo{}, fmt.Errorf("hotkey %q repeats the %s modifier", s, mod)
+			}
+			c.Modifiers |= mod
+			continue
+		}
+
+		key, ok := lookupKey(name)
+		if !ok {
+			return Combo{}, fmt.Errorf("hotkey %q: unknown key %q", s, name)
+		}
+		if c.Key == key {
+			return Combo{}, fmt.Errorf("hotkey %q repeats the %s key", s, key)
+		}
+		if c.Key != "" {
+			return Combo{}, fmt.Errorf("hotkey %q has more than one key (%s and %s)", s, c.Key, key)
+		}
+		c.Key = key
+	}
+
+	if c.Key == "" {
+		return Combo{}, fmt.Errorf("hotkey %q has modifiers but no key", s)
+	}
+	if !keyInfos[c.Key].standalone && c.Modifiers&^Shift == 0 {
+		return Combo{}, fmt.Errorf("hotkey %q needs Ctrl, Alt or Win, or it would swallow normal typing", s)
+	}
+
+	return c, nil
+}
+
+// Normalize parses s and returns its canonical spelling.
+func Normalize(s string) (string, error) {
+	c, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return c.String(), nil
+}
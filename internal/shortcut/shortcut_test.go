@@ -0,0 +1,154 @@
+package shortcut
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Combo
+	}{
+		{"Ctrl+Shift+S", Combo{Ctrl | Shift, "S"}},
+		{"shift+ctrl+s", Combo{Ctrl | Shift, "S"}},
+		{" Control + Alt + Del ", Combo{Ctrl | Alt, Delete}},
+		{"Super+PgUp", Combo{Win, PageUp}},
+		{"Cmd+Option+ArrowLeft", Combo{Win | Alt, Left}},
+		{"Ctrl+-", Combo{Ctrl, Minus}},
+		{"Ctrl+Esc", Combo{Ctrl, Escape}},
+		{"Win+7", Combo{Win, "7"}},
+		{"F7", Combo{0, "F7"}},
+		{"Shift+F24", Combo{Shift, "F24"}},
+		{"PrtSc", Combo{0, PrintScreen}},
+		{"Alt+Print", Combo{Alt, PrintScreen}},
+		{"Ctrl+`", Combo{Ctrl, Backquote}},
+		{"Ctrl+Tilde", Combo{Ctrl, Backquote}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// Aliases for the same physical key must parse to one canonical Combo, or
+// the same hotkey could be bound twice under different names.
+func TestParseCanonicalAliases(t *testing.T) {
+	groups := [][]string{
+		{"Ctrl+Equals", "Ctrl+Plus", "Ctrl+=", "ctrl+equal"},
+		{"Ctrl+Minus", "Ctrl+-", "Ctrl+Hyphen"},
+		{"Alt+PageDown", "Alt+PgDn", "Alt+Next"},
+		{"Ctrl+Enter", "Ctrl+Return"},
+		{"Win+Pause", "Meta+Break"},
+	}
+	for _, group := range groups {
+		first, err := Parse(group[0])
+		if err != nil {
+			t.Fatalf("Parse(%q) error: %v", group[0], err)
+		}
+		for _, alias := range group[1:] {
+			got, err := Parse(alias)
+			if err != nil {
+				t.Errorf("Parse(%q) error: %v", alias, err)
+				continue
+			}
+			if got != first {
+				t.Errorf("Parse(%q) = %v, want %v like %q", alias, got, first, group[0])
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", "empty"},
+		{"   ", "empty"},
+		{"Ctrl++", "empty part"},
+		{"Ctrl+Shift", "no key"},
+		{"Ctrl+Hyper+S", "unknown key"},
+		{"Ctrl+Control+S", "repeats the Ctrl modifier"},
+		{"Ctrl+A+B", "more than one key"},
+		{"Ctrl+Plus+Equals", "repeats the Equals key"},
+		{"Ctrl+=+Plus", "repeats the Equals key"},
+		{"Ctrl+Esc+Escape", "repeats the Escape key"},
+		{"S", "needs Ctrl, Alt or Win"},
+		{"Shift+S", "needs Ctrl, Alt or Win"},
+		{"Shift+Space", "needs Ctrl, Alt or Win"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.in)
+		if err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", tt.in)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %q, want it to mention %q", tt.in, err, tt.want)
+		}
+	}
+}
+
+func TestComboString(t *testing.T) {
+	tests := []struct {
+		c    Combo
+		want string
+	}{
+		{Combo{Ctrl | Shift, "S"}, "Ctrl+Shift+S"},
+		{Combo{Win | Shift | Alt | Ctrl, "F1"}, "Ctrl+Alt+Shift+Win+F1"},
+		{Combo{Alt, Equals}, "Alt+Equals"},
+		{Combo{0, PrintScreen}, "PrintScreen"},
+	}
+	for _, tt := range tests {
+		if got := tt.c.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.c, got, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"shift+ctrl+s", "Ctrl+Shift+S"},
+		{"Ctrl+Plus", "Ctrl+Equals"},
+		{"meta+alt+esc", "Alt+Win+Escape"},
+		{"Ctrl+[", "Ctrl+BracketLeft"},
+	}
+	for _, tt := range tests {
+		got, err := Normalize(tt.in)
+		if err != nil {
+			t.Errorf("Normalize(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// Every key, under every alias, must survive Parse(String()).
+func TestRoundTrip(t *testing.T) {
+	for alias, key := range keyAliases {
+		for _, mods := range []Modifier{Ctrl, Alt | Shift, Ctrl | Alt | Shift | Win} {
+			in := Combo{Modifiers: mods, Key: key}.String()
+			got, err := Parse(in)
+			if err != nil {
+				t.Errorf("Parse(%q) (key alias %q) error: %v", in, alias, err)
+				continue
+			}
+			if got.Modifiers != mods || got.Key != key {
+				t.Errorf("Parse(%q) = %v, want %v", in, got, Combo{mods, key})
+			}
+			if again := got.String(); again != in {
+				t.Errorf("String of Parse(%q) = %q", in, again)
+			}
+		}
+	}
+}